@@ -0,0 +1,356 @@
+package activitypub
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/httpsig"
+)
+
+const (
+	Context         = "https://www.w3.org/ns/activitystreams"
+	SecurityContext = "https://w3id.org/security/v1"
+	Public          = "https://www.w3.org/ns/activitystreams#Public"
+	MimeType        = "application/activity+json"
+	LDMimeType      = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+)
+
+var (
+	ErrNotEmbedded = errors.New("activitypub: reference doesn't contain an embedded object")
+)
+
+// Ref is a property that can hold either a bare IRI or an embedded object.
+// Embedded objects are kept as raw JSON so they can be decoded once their
+// type is known.
+type Ref struct {
+	ID  string
+	Raw json.RawMessage
+}
+
+func NewRef(id string) *Ref {
+	return &Ref{ID: id}
+}
+
+func Embed(v interface{}) (*Ref, error) {
+	d, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "Embed")
+	}
+
+	var r Ref
+	if err := r.UnmarshalJSON(d); err != nil {
+		return nil, errors.Wrap(err, "Embed")
+	}
+
+	return &r, nil
+}
+
+func (r *Ref) UnmarshalJSON(d []byte) error {
+	d = bytes.TrimSpace(d)
+
+	switch {
+	case len(d) == 0 || bytes.Equal(d, []byte("null")):
+		return nil
+	case d[0] == '"':
+		return json.Unmarshal(d, &r.ID)
+	case d[0] == '[':
+		// some servers send single-valued properties as arrays; the first
+		// entry is the one that matters
+		var l []Ref
+		if err := json.Unmarshal(d, &l); err != nil {
+			return err
+		}
+		if len(l) > 0 {
+			*r = l[0]
+		}
+		return nil
+	}
+
+	var v struct {
+		ID   string `json:"id"`
+		Href string `json:"href"`
+	}
+	if err := json.Unmarshal(d, &v); err != nil {
+		return err
+	}
+
+	r.ID = v.ID
+	if r.ID == "" {
+		r.ID = v.Href
+	}
+	r.Raw = append(json.RawMessage(nil), d...)
+
+	return nil
+}
+
+func (r Ref) MarshalJSON() ([]byte, error) {
+	if len(r.Raw) > 0 {
+		return r.Raw, nil
+	}
+
+	return json.Marshal(r.ID)
+}
+
+// Type returns the type of an embedded object, or an empty string if the
+// reference is a bare IRI.
+func (r *Ref) Type() string {
+	if r == nil || len(r.Raw) == 0 {
+		return ""
+	}
+
+	var v struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(r.Raw, &v); err != nil {
+		return ""
+	}
+
+	return v.Type
+}
+
+func (r *Ref) Decode(v interface{}) error {
+	if r == nil || len(r.Raw) == 0 {
+		return errors.Wrap(ErrNotEmbedded, "Ref.Decode")
+	}
+
+	return errors.Wrap(json.Unmarshal(r.Raw, v), "Ref.Decode")
+}
+
+func (r *Ref) GetID() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.ID
+}
+
+// Refs is a list of references that may be sent as a single value.
+type Refs []Ref
+
+func (l *Refs) UnmarshalJSON(d []byte) error {
+	d = bytes.TrimSpace(d)
+
+	if len(d) == 0 || bytes.Equal(d, []byte("null")) {
+		return nil
+	}
+
+	if d[0] != '[' {
+		var r Ref
+		if err := r.UnmarshalJSON(d); err != nil {
+			return err
+		}
+
+		*l = Refs{r}
+
+		return nil
+	}
+
+	var v []Ref
+	if err := json.Unmarshal(d, &v); err != nil {
+		return err
+	}
+
+	*l = Refs(v)
+
+	return nil
+}
+
+// IRIs is a list of IRIs that may be sent as a single string.
+type IRIs []string
+
+func (l *IRIs) UnmarshalJSON(d []byte) error {
+	d = bytes.TrimSpace(d)
+
+	if len(d) > 0 && d[0] == '"' {
+		var s string
+		if err := json.Unmarshal(d, &s); err != nil {
+			return err
+		}
+
+		*l = IRIs{s}
+
+		return nil
+	}
+
+	var v []string
+	if err := json.Unmarshal(d, &v); err != nil {
+		return err
+	}
+
+	*l = IRIs(v)
+
+	return nil
+}
+
+func (l IRIs) Contains(s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Object struct {
+	Context      interface{} `json:"@context,omitempty"`
+	ID           string      `json:"id,omitempty"`
+	Type         string      `json:"type"`
+	Name         string      `json:"name,omitempty"`
+	Summary      string      `json:"summary,omitempty"`
+	Content      string      `json:"content,omitempty"`
+	URL          *Ref        `json:"url,omitempty"`
+	AttributedTo *Ref        `json:"attributedTo,omitempty"`
+	InReplyTo    *Ref        `json:"inReplyTo,omitempty"`
+	Icon         *Ref        `json:"icon,omitempty"`
+	Attachment   Refs        `json:"attachment,omitempty"`
+	Tag          Refs        `json:"tag,omitempty"`
+	MediaType    string      `json:"mediaType,omitempty"`
+	Width        int         `json:"width,omitempty"`
+	Height       int         `json:"height,omitempty"`
+	Duration     string      `json:"duration,omitempty"`
+	Sensitive    bool        `json:"sensitive,omitempty"`
+	StartTime    *time.Time  `json:"startTime,omitempty"`
+	EndTime      *time.Time  `json:"endTime,omitempty"`
+	Published    *time.Time  `json:"published,omitempty"`
+	Updated      *time.Time  `json:"updated,omitempty"`
+	To           IRIs        `json:"to,omitempty"`
+	Cc           IRIs        `json:"cc,omitempty"`
+}
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type Endpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+type Actor struct {
+	Object
+
+	PreferredUsername string     `json:"preferredUsername,omitempty"`
+	Inbox             string     `json:"inbox"`
+	Outbox            string     `json:"outbox,omitempty"`
+	Followers         string     `json:"followers,omitempty"`
+	Following         string     `json:"following,omitempty"`
+	Endpoints         *Endpoints `json:"endpoints,omitempty"`
+	PublicKey         *PublicKey `json:"publicKey,omitempty"`
+}
+
+// GetInbox returns the shared inbox if the actor has one, falling back to
+// their personal inbox.
+func (a *Actor) GetInbox() string {
+	if a.Endpoints != nil && a.Endpoints.SharedInbox != "" {
+		return a.Endpoints.SharedInbox
+	}
+
+	return a.Inbox
+}
+
+type Activity struct {
+	Context   interface{} `json:"@context,omitempty"`
+	ID        string      `json:"id,omitempty"`
+	Type      string      `json:"type"`
+	Summary   string      `json:"summary,omitempty"`
+	Actor     *Ref        `json:"actor,omitempty"`
+	Object    *Ref        `json:"object,omitempty"`
+	Target    *Ref        `json:"target,omitempty"`
+	Published *time.Time  `json:"published,omitempty"`
+	To        IRIs        `json:"to,omitempty"`
+	Cc        IRIs        `json:"cc,omitempty"`
+}
+
+// Collection covers both OrderedCollection and OrderedCollectionPage.
+type Collection struct {
+	Context      interface{} `json:"@context,omitempty"`
+	ID           string      `json:"id,omitempty"`
+	Type         string      `json:"type"`
+	TotalItems   *int        `json:"totalItems,omitempty"`
+	First        *Ref        `json:"first,omitempty"`
+	PartOf       string      `json:"partOf,omitempty"`
+	Next         string      `json:"next,omitempty"`
+	Prev         string      `json:"prev,omitempty"`
+	OrderedItems []Ref       `json:"orderedItems,omitempty"`
+	Items        []Ref       `json:"items,omitempty"`
+}
+
+func Parse(d []byte, v interface{}) error {
+	return errors.Wrap(json.Unmarshal(d, v), "activitypub.Parse")
+}
+
+func Fetch(u string, v interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return errors.Wrap(err, "activitypub.Fetch")
+	}
+	req.Header.Set("accept", MimeType+", "+LDMimeType)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "activitypub.Fetch")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("activitypub.Fetch: invalid status code; expected 200 but got %d", res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return errors.Wrap(err, "activitypub.Fetch")
+	}
+
+	return nil
+}
+
+func FetchActor(u string) (*Actor, error) {
+	var a Actor
+	if err := Fetch(u, &a); err != nil {
+		return nil, errors.Wrap(err, "activitypub.FetchActor")
+	}
+
+	return &a, nil
+}
+
+// Post delivers an activity to an inbox. Most servers won't accept
+// deliveries that aren't signed, but s can be nil.
+func Post(inbox string, v interface{}, s *httpsig.Signer) error {
+	d, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "activitypub.Post")
+	}
+
+	req, err := http.NewRequest("POST", inbox, bytes.NewReader(d))
+	if err != nil {
+		return errors.Wrap(err, "activitypub.Post")
+	}
+	req.Header.Set("content-type", MimeType)
+
+	if s != nil {
+		if err := s.Sign(req, d); err != nil {
+			return errors.Wrap(err, "activitypub.Post")
+		}
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "activitypub.Post")
+	}
+	defer res.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("activitypub.Post: invalid status code; expected 2xx but got %d", res.StatusCode)
+	}
+
+	return nil
+}
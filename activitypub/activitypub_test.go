@@ -0,0 +1,60 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCreate(t *testing.T) {
+	var act Activity
+	assert.NoError(t, Parse([]byte(fixtureMastodonCreate), &act))
+
+	assert.Equal(t, "Create", act.Type)
+	assert.Equal(t, "https://mastodon.example/users/alice", act.Actor.GetID())
+	assert.Equal(t, "https://mastodon.example/users/alice/statuses/1", act.Object.GetID())
+	assert.Equal(t, "Note", act.Object.Type())
+	assert.True(t, act.To.Contains(Public))
+
+	var o Object
+	assert.NoError(t, act.Object.Decode(&o))
+	assert.Equal(t, "<p>hello world</p>", o.Content)
+	assert.Equal(t, "https://mastodon.example/@alice/1", o.URL.GetID())
+	assert.Equal(t, "https://don.example/users/bob/statuses/abc", o.InReplyTo.GetID())
+	assert.NotNil(t, o.Published)
+}
+
+func TestParseActor(t *testing.T) {
+	var actor Actor
+	assert.NoError(t, Parse([]byte(fixtureActor), &actor))
+
+	assert.Equal(t, "carol", actor.PreferredUsername)
+	assert.Equal(t, "https://pleroma.example/@carol", actor.URL.GetID())
+	assert.Equal(t, "https://pleroma.example/inbox", actor.GetInbox())
+	assert.Equal(t, "Image", actor.Icon.Type())
+	assert.Equal(t, "https://pleroma.example/users/carol#main-key", actor.PublicKey.ID)
+}
+
+func TestRefBareIRI(t *testing.T) {
+	var act Activity
+	assert.NoError(t, Parse([]byte(`{"type":"Like","actor":["https://a.example/u"],"object":"https://b.example/n","to":"https://c.example/x"}`), &act))
+
+	assert.Equal(t, "https://a.example/u", act.Actor.GetID())
+	assert.Equal(t, "https://b.example/n", act.Object.GetID())
+	assert.Equal(t, "", act.Object.Type())
+	assert.Equal(t, IRIs{"https://c.example/x"}, act.To)
+
+	var o Object
+	assert.Error(t, act.Object.Decode(&o))
+}
+
+func TestRefRoundTrip(t *testing.T) {
+	r, err := Embed(&Object{ID: "https://a.example/n", Type: "Note", Content: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://a.example/n", r.GetID())
+
+	d, err := json.Marshal(&Activity{Type: "Create", Actor: NewRef("https://a.example/u"), Object: r})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type":"Create","actor":"https://a.example/u","object":{"id":"https://a.example/n","type":"Note","content":"hi"}}`, string(d))
+}
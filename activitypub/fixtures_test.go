@@ -0,0 +1,45 @@
+package activitypub
+
+const fixtureMastodonCreate = `{
+  "@context": [
+    "https://www.w3.org/ns/activitystreams",
+    "https://w3id.org/security/v1",
+    {"sensitive": "as:sensitive"}
+  ],
+  "id": "https://mastodon.example/users/alice/statuses/1/activity",
+  "type": "Create",
+  "actor": "https://mastodon.example/users/alice",
+  "published": "2017-04-10T06:58:01Z",
+  "to": ["https://www.w3.org/ns/activitystreams#Public"],
+  "cc": ["https://mastodon.example/users/alice/followers"],
+  "object": {
+    "id": "https://mastodon.example/users/alice/statuses/1",
+    "type": "Note",
+    "summary": null,
+    "content": "<p>hello world</p>",
+    "inReplyTo": "https://don.example/users/bob/statuses/abc",
+    "published": "2017-04-10T06:58:01Z",
+    "url": "https://mastodon.example/@alice/1",
+    "attributedTo": "https://mastodon.example/users/alice",
+    "to": ["https://www.w3.org/ns/activitystreams#Public"],
+    "cc": ["https://mastodon.example/users/alice/followers"]
+  }
+}`
+
+const fixtureActor = `{
+  "@context": ["https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"],
+  "id": "https://pleroma.example/users/carol",
+  "type": "Person",
+  "preferredUsername": "carol",
+  "name": "Carol",
+  "inbox": "https://pleroma.example/users/carol/inbox",
+  "outbox": "https://pleroma.example/users/carol/outbox",
+  "endpoints": {"sharedInbox": "https://pleroma.example/inbox"},
+  "icon": {"type": "Image", "url": "https://pleroma.example/media/carol.png"},
+  "url": {"type": "Link", "href": "https://pleroma.example/@carol"},
+  "publicKey": {
+    "id": "https://pleroma.example/users/carol#main-key",
+    "owner": "https://pleroma.example/users/carol",
+    "publicKeyPem": "-----BEGIN PUBLIC KEY-----\n-----END PUBLIC KEY-----\n"
+  }
+}`
@@ -34,22 +34,12 @@ func (a *Activity) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	}
 
 	if n := a.baseActivity.Object; n != nil {
+		var objectType string
 		if c := n.GetChildByTagName(xml.Name{Space: "http://activitystrea.ms/spec/1.0/", Local: "object-type"}); c != nil {
-			switch c.Text() {
-			case "http://activitystrea.ms/schema/1.0/activity":
-				a.Object = &Activity{}
-			case "http://activitystrea.ms/schema/1.0/note":
-				a.Object = &Note{}
-			case "http://activitystrea.ms/schema/1.0/comment":
-				a.Object = &Comment{}
-			case "http://activitystrea.ms/schema/1.0/person":
-				a.Object = &Author{}
-			}
+			objectType = c.Text()
 		}
 
-		if a.Object == nil {
-			a.Object = &GenericObject{}
-		}
+		a.Object = newObject(objectType)
 
 		if err := n.UnmarshalInto(a.Object); err != nil {
 			return err
@@ -108,3 +98,30 @@ func (a *Activity) GetTitle() string {
 func (a *Activity) GetInReplyTo() *InReplyTo {
 	return a.InReplyTo
 }
+
+func (a *Activity) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	objectType := a.ObjectType
+	if objectType == "" {
+		objectType = "http://activitystrea.ms/schema/1.0/activity"
+	}
+
+	v := entryXML{
+		ObjectType: objectType,
+		ID:         a.ID,
+		Title:      a.Title,
+		Summary:    a.Summary,
+		Content:    a.Content,
+		Author:     a.Author,
+		Link:       a.Link,
+		Verb:       a.Verb,
+		InReplyTo:  a.InReplyTo,
+		Published:  formatTime(a.Published),
+		Updated:    formatTime(a.Updated),
+	}
+
+	if a.Object != nil {
+		v.Object = a.Object
+	}
+
+	return e.EncodeElement(v, start)
+}
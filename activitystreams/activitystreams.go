@@ -1,6 +1,11 @@
 package activitystreams
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -8,6 +13,11 @@ import (
 	"fknsrs.biz/p/don/commonxml"
 )
 
+const (
+	nsAtom = "http://www.w3.org/2005/Atom"
+	nsRDF  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
 func Fetch(u string) (*Feed, error) {
 	var f Feed
 	if err := commonxml.Fetch(u, &f); err != nil {
@@ -17,13 +27,133 @@ func Fetch(u string) (*Feed, error) {
 	return &f, nil
 }
 
+// Parse decodes an Atom, RSS 2.0 or RSS 1.0 (RDF) document, picking the
+// format based on the root element.
 func Parse(d []byte) (*Feed, error) {
-	var f Feed
-	if err := commonxml.Parse(d, &f); err != nil {
+	name, err := rootElement(d)
+	if err != nil {
 		return nil, errors.Wrap(err, "activitystreams.Parse")
 	}
 
-	return &f, nil
+	switch {
+	case name.Space == nsAtom && name.Local == "feed":
+		var f Feed
+		if err := commonxml.Parse(d, &f); err != nil {
+			return nil, errors.Wrap(err, "activitystreams.Parse")
+		}
+
+		return &f, nil
+	case name.Local == "rss":
+		f, err := ParseRSS(d)
+		if err != nil {
+			return nil, errors.Wrap(err, "activitystreams.Parse")
+		}
+
+		return f, nil
+	case name.Space == nsRDF && name.Local == "RDF":
+		f, err := ParseRDF(d)
+		if err != nil {
+			return nil, errors.Wrap(err, "activitystreams.Parse")
+		}
+
+		return f, nil
+	}
+
+	return nil, errors.Errorf("activitystreams.Parse: unrecognised root element %q", name.Local)
+}
+
+func rootElement(d []byte) (xml.Name, error) {
+	dec := xml.NewDecoder(bytes.NewReader(d))
+
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return xml.Name{}, errors.Wrap(err, "rootElement: couldn't find root element")
+		}
+
+		if s, ok := t.(xml.StartElement); ok {
+			return s.Name, nil
+		}
+	}
+}
+
+// ParseAny decodes a feed in any of the supported formats: Atom, RSS 2.0,
+// RSS 1.0 (RDF), JSON Feed or ActivityStreams 2.0 JSON. The content type is
+// used when it's specific enough, otherwise the body is sniffed.
+func ParseAny(contentType string, d []byte) (*Feed, error) {
+	mt, _, _ := mime.ParseMediaType(contentType)
+
+	var f *Feed
+	var err error
+
+	switch mt {
+	case "application/feed+json":
+		f, err = ParseJSONFeed(d)
+	case "application/activity+json", "application/ld+json":
+		f, err = ParseAS2(d)
+	case "application/atom+xml", "application/rss+xml", "application/rdf+xml":
+		f, err = Parse(d)
+	default:
+		f, err = sniff(d)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "activitystreams.ParseAny")
+	}
+
+	return f, nil
+}
+
+func sniff(d []byte) (*Feed, error) {
+	t := bytes.TrimSpace(d)
+	if len(t) == 0 {
+		return nil, errors.New("sniff: empty document")
+	}
+
+	if t[0] != '{' {
+		return Parse(d)
+	}
+
+	var v struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(t, &v); err != nil {
+		return nil, errors.Wrap(err, "sniff: couldn't decode json")
+	}
+
+	if strings.HasPrefix(v.Version, "https://jsonfeed.org/version/") {
+		return ParseJSONFeed(d)
+	}
+
+	return ParseAS2(d)
+}
+
+func Serialize(f *Feed) ([]byte, error) {
+	var b bytes.Buffer
+
+	if _, err := b.WriteString(xml.Header); err != nil {
+		return nil, errors.Wrap(err, "activitystreams.Serialize")
+	}
+
+	if err := xml.NewEncoder(&b).Encode(f); err != nil {
+		return nil, errors.Wrap(err, "activitystreams.Serialize")
+	}
+
+	return b.Bytes(), nil
+}
+
+func SerializeEntry(e *Entry) ([]byte, error) {
+	var b bytes.Buffer
+
+	if _, err := b.WriteString(xml.Header); err != nil {
+		return nil, errors.Wrap(err, "activitystreams.SerializeEntry")
+	}
+
+	if err := xml.NewEncoder(&b).Encode(e); err != nil {
+		return nil, errors.Wrap(err, "activitystreams.SerializeEntry")
+	}
+
+	return b.Bytes(), nil
 }
 
 type ObjectLike interface {
@@ -200,3 +200,230 @@ func TestDecodeFavoriteActivity(t *testing.T) {
 	assert.Equal(t, "https://freezepeach.xyz/notice/2223055", object.GetPermalink(), "Activity.GetObject.GetPermalink")
 	assert.Equal(t, "@<a href=\"https://social.heldscal.la/user/23211\" class=\"h-card mention\" title=\"Constance Variable\">lambadalambda</a>\u00a0 <a href=\"https://freezepeach.xyz/file/2f735f572e4e6a937fd5d28cf42917da8ecf8350b189ed2636fe3c6f5ee330b1.jpg\" title=\"https://freezepeach.xyz/file/2f735f572e4e6a937fd5d28cf42917da8ecf8350b189ed2636fe3c6f5ee330b1.jpg\" class=\"attachment thumbnail\" rel=\"nofollow\">https://freezepeach.xyz/attachment/432218</a>", object.GetContent(), "Comment.GetContent")
 }
+
+func TestSerializeRoundTrip(t *testing.T) {
+	f1, err := Parse([]byte(fixtureNested))
+	if err != nil {
+		panic(err)
+	}
+
+	d, err := Serialize(f1)
+	if err != nil {
+		panic(err)
+	}
+
+	f2, err := Parse(d)
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, f1.Title, f2.Title, "Feed.Title")
+	assert.Equal(t, f1.ID, f2.ID, "Feed.ID")
+	assert.Equal(t, f1.Updated.Format(time.RFC3339), f2.Updated.Format(time.RFC3339), "Feed.Updated")
+	assert.Equal(t, f1.GetHub(), f2.GetHub(), "Feed.GetHub")
+	assert.Equal(t, f1.GetSalmon(), f2.GetSalmon(), "Feed.GetSalmon")
+
+	assert.Equal(t, f1.Author.GetPermalink(), f2.Author.GetPermalink(), "Author.GetPermalink")
+	assert.Equal(t, f1.Author.PreferredUsername, f2.Author.PreferredUsername, "Author.PreferredUsername")
+	assert.Equal(t, f1.Author.GetBestAvatar(), f2.Author.GetBestAvatar(), "Author.GetBestAvatar")
+
+	activities := f2.GetActivities()
+	assert.Len(t, activities, 1)
+
+	activity := activities[0]
+	assert.Equal(t, "http://activitystrea.ms/schema/1.0/share", activity.GetVerb(), "Entry.GetVerb")
+	assert.Equal(t, "2017-04-13T06:57:43Z", activity.GetTime().Format(time.RFC3339), "Entry.GetTime")
+
+	object1 := activity.GetObject().(ActivityLike)
+	assert.Equal(t, "tag:gnusocial.no,2017-04-13:noticeId=1938446:objectType=note", object1.GetID(), "Activity.GetObject.GetID")
+	assert.Equal(t, "http://activitystrea.ms/schema/1.0/activity", object1.GetObjectType(), "Activity.GetObject.GetObjectType")
+
+	object2 := object1.GetObject().(ActivityLike)
+	object3 := object2.GetObject().(NoteLike)
+	assert.Equal(t, "tag:social.heldscal.la,2017-04-13:noticeId=1661724:objectType=note", object3.GetID(), "NoteLike.GetID")
+	assert.Equal(t, "https://social.heldscal.la/notice/1661724", object3.GetPermalink(), "NoteLike.GetPermalink")
+	assert.Equal(t, f1.GetActivities()[0].GetObject().(ActivityLike).GetObject().(ActivityLike).GetObject().(NoteLike).GetContent(), object3.GetContent(), "NoteLike.GetContent")
+}
+
+func TestParseRSS1(t *testing.T) {
+	f, err := Parse([]byte(fixtureRSS1))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Example Podcast", f.Title, "Feed.Title")
+	assert.Equal(t, "https://podcast.example.com/", f.ID, "Feed.ID")
+	assert.Equal(t, "2017-04-15T04:12:30Z", f.Updated.Format(time.RFC3339), "Feed.Updated")
+	assert.Equal(t, "https://hub.example.com/", f.GetHub(), "Feed.GetHub")
+
+	activities := f.GetActivities()
+	assert.Len(t, activities, 2)
+
+	activity := activities[0]
+	assert.Equal(t, "https://podcast.example.com/#episode-1", activity.GetID(), "Entry.GetID")
+	assert.Equal(t, "Episode 1", activity.GetTitle(), "Entry.GetTitle")
+	assert.Equal(t, "https://podcast.example.com/episodes/1", activity.GetPermalink(), "Entry.GetPermalink")
+	assert.Equal(t, "2017-04-14T10:00:00Z", activity.GetTime().UTC().Format(time.RFC3339), "Entry.GetTime")
+	assert.Equal(t, "http://activitystrea.ms/schema/1.0/post", activity.GetVerb(), "Entry.GetVerb")
+
+	actor := activity.GetActor()
+	assert.NotNil(t, actor, "Entry.GetActor")
+	assert.Equal(t, "Example Podcast", actor.DisplayName, "Author.DisplayName")
+	assert.Equal(t, "https://podcast.example.com/", actor.GetPermalink(), "Author.GetPermalink")
+	assert.Equal(t, "https://podcast.example.com/logo.png", actor.GetBestAvatar(), "Author.GetBestAvatar")
+
+	note := activity.GetObject().(NoteLike)
+	assert.Equal(t, "<p>The <b>first</b> one</p>", note.GetContent(), "Entry.GetContent")
+
+	enclosure := f.Activities[0].GetLink("enclosure")
+	assert.NotNil(t, enclosure, "enclosure link")
+	assert.Equal(t, "https://podcast.example.com/episodes/1.mp3", enclosure.Href, "enclosure.Href")
+	assert.Equal(t, "audio/mpeg", enclosure.Type, "enclosure.Type")
+	assert.Equal(t, uint(12345), enclosure.Length, "enclosure.Length")
+
+	assert.Equal(t, "https://podcast.example.com/episodes/0", activities[1].GetID(), "Entry.GetID")
+	assert.Equal(t, "https://podcast.example.com/episodes/0", activities[1].GetPermalink(), "Entry.GetPermalink")
+	assert.Equal(t, "2017-04-06T08:00:00Z", activities[1].GetTime().UTC().Format(time.RFC3339), "Entry.GetTime")
+}
+
+func TestParseRDF1(t *testing.T) {
+	f, err := Parse([]byte(fixtureRDF1))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Example News", f.Title, "Feed.Title")
+	assert.Equal(t, "https://news.example.org/", f.ID, "Feed.ID")
+
+	activities := f.GetActivities()
+	assert.Len(t, activities, 1)
+
+	activity := activities[0]
+	assert.Equal(t, "https://news.example.org/stories/42", activity.GetID(), "Entry.GetID")
+	assert.Equal(t, "Something happened", activity.GetTitle(), "Entry.GetTitle")
+	assert.Equal(t, "2017-04-15T04:12:24Z", activity.GetTime().UTC().Format(time.RFC3339), "Entry.GetTime")
+	assert.Equal(t, "Example News", activity.GetActor().GetName(), "Author.GetName")
+	assert.Equal(t, "It really did", activity.GetObject().(NoteLike).GetContent(), "Entry.GetContent")
+}
+
+func TestParseAnyJSONFeed1(t *testing.T) {
+	f, err := ParseAny("application/feed+json", []byte(fixtureJSONFeed1))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Example Blog", f.Title, "Feed.Title")
+	assert.Equal(t, "https://blog.example.net/feed.json", f.ID, "Feed.ID")
+	assert.Equal(t, "https://hub.example.net/", f.GetHub(), "Feed.GetHub")
+
+	activities := f.GetActivities()
+	assert.Len(t, activities, 2)
+
+	activity := activities[0]
+	assert.Equal(t, "https://blog.example.net/feed.json#2", activity.GetID(), "Entry.GetID")
+	assert.Equal(t, "https://blog.example.net/posts/2", activity.GetPermalink(), "Entry.GetPermalink")
+	assert.Equal(t, "2017-04-15T04:12:24Z", activity.GetTime().UTC().Format(time.RFC3339), "Entry.GetTime")
+	assert.Equal(t, "<p>Hello again</p>", activity.GetObject().(NoteLike).GetContent(), "Entry.GetContent")
+	assert.Equal(t, "Jo Example", activity.GetActor().GetName(), "Author.GetName")
+	assert.Equal(t, "https://blog.example.net/jo.png", activity.GetActor().GetBestAvatar(), "Author.GetBestAvatar")
+	assert.Equal(t, uint(2048), f.Activities[0].GetLink("enclosure").Length, "enclosure.Length")
+
+	assert.Equal(t, "https://blog.example.net/feed.json#1", activities[1].GetID(), "Entry.GetID")
+	assert.Equal(t, "Hello", activities[1].GetObject().(NoteLike).GetContent(), "Entry.GetContent")
+	assert.Equal(t, "Guest", activities[1].GetActor().GetName(), "Author.GetName")
+}
+
+func TestParseAnyAS2Outbox1(t *testing.T) {
+	f, err := ParseAny("application/activity+json", []byte(fixtureAS2Outbox1))
+	assert.NoError(t, err)
+
+	activities := f.GetActivities()
+	assert.Len(t, activities, 2)
+
+	activity := activities[0]
+	assert.Equal(t, "https://social.example.com/users/alice/statuses/1", activity.GetID(), "Entry.GetID")
+	assert.Equal(t, "http://activitystrea.ms/schema/1.0/post", activity.GetVerb(), "Entry.GetVerb")
+	assert.Equal(t, "http://activitystrea.ms/schema/1.0/note", activity.GetObjectType(), "Entry.GetObjectType")
+	assert.Equal(t, "https://social.example.com/@alice/1", activity.GetPermalink(), "Entry.GetPermalink")
+	assert.Equal(t, "<p>Look at this</p>", activity.GetObject().(NoteLike).GetContent(), "Entry.GetContent")
+	assert.Equal(t, "https://other.example.org/notes/9", activity.GetObject().(HasInReplyTo).GetInReplyTo().Ref, "Entry.GetInReplyTo")
+
+	actor := activity.GetActor()
+	assert.NotNil(t, actor, "Entry.GetActor")
+	assert.Equal(t, "alice", actor.GetName(), "Author.GetName")
+	assert.Equal(t, "Alice", actor.DisplayName, "Author.DisplayName")
+	assert.Equal(t, "https://social.example.com/@alice", actor.GetPermalink(), "Author.GetPermalink")
+	assert.Equal(t, "https://social.example.com/alice.png", actor.GetBestAvatar(), "Author.GetBestAvatar")
+
+	enclosure := f.Activities[0].GetLink("enclosure")
+	assert.NotNil(t, enclosure, "enclosure link")
+	assert.Equal(t, "https://social.example.com/media/1.png", enclosure.Href, "enclosure.Href")
+	assert.Equal(t, "image/png", enclosure.Type, "enclosure.Type")
+
+	share := activities[1]
+	assert.Equal(t, "http://activitystrea.ms/schema/1.0/share", share.GetVerb(), "Entry.GetVerb")
+	assert.Equal(t, "https://other.example.org/notes/10", share.GetObject().GetID(), "Entry.GetObject")
+}
+
+func TestParseAnySniff(t *testing.T) {
+	for name, d := range map[string]string{
+		"atom":     fixtureImpliedActivity2,
+		"rss":      fixtureRSS1,
+		"rdf":      fixtureRDF1,
+		"jsonfeed": fixtureJSONFeed1,
+		"as2":      fixtureAS2Outbox1,
+	} {
+		f, err := ParseAny("text/plain", []byte(d))
+		assert.NoError(t, err, name)
+		assert.NotNil(t, f, name)
+	}
+}
+
+func TestDecodeTypedObjects1(t *testing.T) {
+	f, err := Parse([]byte(fixtureTypedObjects1))
+	assert.NoError(t, err)
+
+	activities := f.GetActivities()
+	assert.Len(t, activities, 2)
+
+	image, ok := activities[0].GetObject().(*Image)
+	assert.True(t, ok, "Image")
+	assert.Equal(t, "https://photos.example.com/photos/1.jpg", image.GetMediaURL(), "Image.GetMediaURL")
+	assert.Equal(t, "image/jpeg", image.GetMediaType(), "Image.GetMediaType")
+	assert.Equal(t, 800, image.GetWidth(), "Image.GetWidth")
+	assert.Equal(t, 600, image.GetHeight(), "Image.GetHeight")
+	assert.Equal(t, "https://photos.example.com/photos/1.jpg", image.GetRepresentativeImage(), "Image.GetRepresentativeImage")
+
+	event, ok := activities[1].GetObject().(HasTimeRange)
+	assert.True(t, ok, "HasTimeRange")
+	assert.Equal(t, "2017-05-01T09:00:00Z", event.GetStartTime().Format(time.RFC3339), "Event.GetStartTime")
+	assert.Equal(t, "2017-05-01T12:00:00Z", event.GetEndTime().Format(time.RFC3339), "Event.GetEndTime")
+}
+
+func TestGetAttachments(t *testing.T) {
+	f, err := Parse([]byte(fixtureRSS1))
+	assert.NoError(t, err)
+
+	attachments := f.Activities[0].GetAttachments()
+	assert.Len(t, attachments, 1)
+	assert.Equal(t, Attachment{URL: "https://podcast.example.com/episodes/1.mp3", MediaType: "audio/mpeg", Length: 12345}, attachments[0])
+
+	f, err = ParseAS2([]byte(fixtureAS2Outbox1))
+	assert.NoError(t, err)
+
+	attachments = f.Activities[0].GetAttachments()
+	assert.Len(t, attachments, 1)
+	assert.Equal(t, Attachment{URL: "https://social.example.com/media/1.png", MediaType: "image/png", Width: 640, Height: 480, Description: "a cat"}, attachments[0])
+}
+
+func TestGetMentions(t *testing.T) {
+	f, err := Parse([]byte(fixtureMentions1))
+	assert.NoError(t, err)
+
+	mentions := f.Activities[0].GetMentions()
+	assert.Len(t, mentions, 3)
+	assert.Equal(t, Mention{Href: "https://other.example.com/users/lee", Kind: MentionKindPerson}, mentions[0])
+	assert.Equal(t, Mention{Href: "https://other.example.com/groups/cats", Kind: MentionKindGroup}, mentions[1])
+	assert.Equal(t, Mention{Href: "http://activityschema.org/collection/public", Kind: MentionKindCollection}, mentions[2])
+
+	f, err = ParseAS2([]byte(fixtureAS2Outbox1))
+	assert.NoError(t, err)
+
+	mentions = f.Activities[0].GetMentions()
+	assert.Len(t, mentions, 1)
+	assert.Equal(t, Mention{Href: "https://other.example.org/users/bob", Kind: MentionKindPerson}, mentions[0])
+}
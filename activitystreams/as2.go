@@ -0,0 +1,347 @@
+package activitystreams
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/activitypub"
+	"fknsrs.biz/p/don/commonxml"
+)
+
+// ParseAS2 decodes an ActivityStreams 2.0 document. Collections (including
+// the first page, if it's embedded), single activities and bare objects are
+// all accepted. Nothing is fetched, so only embedded objects come through.
+func ParseAS2(d []byte) (*Feed, error) {
+	var r activitypub.Ref
+	if err := json.Unmarshal(d, &r); err != nil {
+		return nil, errors.Wrap(err, "activitystreams.ParseAS2")
+	}
+
+	var f Feed
+
+	switch r.Type() {
+	case "":
+		return nil, errors.Errorf("activitystreams.ParseAS2: document has no type")
+	case "Collection", "OrderedCollection", "CollectionPage", "OrderedCollectionPage":
+		var c activitypub.Collection
+		if err := r.Decode(&c); err != nil {
+			return nil, errors.Wrap(err, "activitystreams.ParseAS2")
+		}
+
+		f.ID = c.ID
+
+		if c.First != nil {
+			var page activitypub.Collection
+			if err := c.First.Decode(&page); err == nil {
+				c = page
+			}
+		}
+
+		for _, item := range append(c.OrderedItems, c.Items...) {
+			if e := as2Entry(&item); e != nil {
+				f.Activities = append(f.Activities, *e)
+			}
+		}
+	default:
+		f.ID = r.GetID()
+
+		if e := as2Entry(&r); e != nil {
+			f.Activities = append(f.Activities, *e)
+		}
+	}
+
+	return &f, nil
+}
+
+// ObjectTypeForAS2 maps an ActivityStreams 2.0 type onto the equivalent 1.0
+// object type.
+func ObjectTypeForAS2(t string) string {
+	switch t {
+	case "Document":
+		return "http://activitystrea.ms/schema/1.0/file"
+	default:
+		return "http://activitystrea.ms/schema/1.0/" + strings.ToLower(t)
+	}
+}
+
+// VerbForAS2 maps an ActivityStreams 2.0 activity type onto the equivalent
+// 1.0 verb.
+func VerbForAS2(t string) string {
+	switch t {
+	case "Create":
+		return "http://activitystrea.ms/schema/1.0/post"
+	case "Announce":
+		return "http://activitystrea.ms/schema/1.0/share"
+	case "Like":
+		return "http://activitystrea.ms/schema/1.0/favorite"
+	default:
+		return "http://activitystrea.ms/schema/1.0/" + strings.ToLower(t)
+	}
+}
+
+func isAS2Activity(t string) bool {
+	switch t {
+	case "Create", "Update", "Delete", "Announce", "Like", "Follow", "Undo", "Accept", "Reject", "Add", "Remove", "Block":
+		return true
+	}
+
+	return false
+}
+
+func as2Entry(r *activitypub.Ref) *Entry {
+	t := r.Type()
+
+	if t == "" {
+		return nil
+	}
+
+	if !isAS2Activity(t) {
+		var o activitypub.Object
+		if err := r.Decode(&o); err != nil {
+			return nil
+		}
+
+		return ObjectEntry(&o)
+	}
+
+	var act activitypub.Activity
+	if err := r.Decode(&act); err != nil {
+		return nil
+	}
+
+	if act.Type == "Create" {
+		var o activitypub.Object
+		if err := act.Object.Decode(&o); err != nil {
+			return nil
+		}
+
+		e := ObjectEntry(&o)
+		if e.Author == nil {
+			e.Author = as2Author(act.Actor)
+		}
+
+		return e
+	}
+
+	var e Entry
+
+	e.ID = act.ID
+	e.Verb = VerbForAS2(act.Type)
+	e.ObjectType = "http://activitystrea.ms/schema/1.0/activity"
+	e.Summary = act.Summary
+	e.Author = as2Author(act.Actor)
+	e.Link = []commonxml.Link{{Rel: "alternate", Type: "text/html", Href: act.ID}}
+
+	if act.Published != nil {
+		e.Published = *act.Published
+	} else {
+		e.Published = time.Now()
+	}
+	e.Updated = e.Published
+
+	if o := as2Entry(act.Object); o != nil {
+		e.Object = o
+	} else if id := act.Object.GetID(); id != "" {
+		e.Object = &GenericObject{ID: id}
+	}
+
+	return &e
+}
+
+// ObjectEntry converts an ActivityStreams 2.0 object into an Entry that
+// posts it.
+func ObjectEntry(o *activitypub.Object) *Entry {
+	var e Entry
+
+	e.ID = o.ID
+	e.Title = o.Name
+	e.Summary = o.Summary
+	e.Verb = "http://activitystrea.ms/schema/1.0/post"
+	e.ObjectType = ObjectTypeForAS2(o.Type)
+	e.Author = as2Author(o.AttributedTo)
+
+	if o.Content != "" {
+		e.Content = []Content{{Type: "html", Body: o.Content}}
+	}
+
+	if o.Published != nil {
+		e.Published = *o.Published
+		e.Updated = *o.Published
+	}
+	if o.Updated != nil {
+		e.Updated = *o.Updated
+	}
+	if e.Published.IsZero() {
+		e.Published = time.Now()
+	}
+
+	if o.StartTime != nil {
+		e.StartTime = o.StartTime.Format(time.RFC3339)
+	}
+	if o.EndTime != nil {
+		e.EndTime = o.EndTime.Format(time.RFC3339)
+	}
+
+	// for media objects the url is the media itself rather than a page
+	// about it
+	if isMediaObjectType(e.ObjectType) {
+		e.Link = []commonxml.Link{{Rel: "alternate", Type: "text/html", Href: o.ID}}
+
+		if l := as2MediaLink(o); l != nil {
+			e.Link = append(e.Link, *l)
+		}
+	} else {
+		permalink := o.URL.GetID()
+		if permalink == "" {
+			permalink = o.ID
+		}
+		e.Link = []commonxml.Link{{Rel: "alternate", Type: "text/html", Href: permalink}}
+	}
+
+	for _, r := range o.Attachment {
+		var a activitypub.Object
+		if err := r.Decode(&a); err != nil {
+			continue
+		}
+
+		if l := as2MediaLink(&a); l != nil {
+			// sensitivity is set on the object, but it's the attachments
+			// that need hiding
+			if o.Sensitive {
+				l.Attributes = append(l.Attributes, xml.Attr{Name: xml.Name{Space: nsMastodon, Local: "sensitive"}, Value: "true"})
+			}
+
+			e.Link = append(e.Link, *l)
+		}
+	}
+
+	for _, r := range o.Tag {
+		var t struct {
+			Type string `json:"type"`
+			Href string `json:"href"`
+		}
+		if err := r.Decode(&t); err != nil || t.Type != "Mention" || t.Href == "" {
+			continue
+		}
+
+		e.Link = append(e.Link, commonxml.Link{
+			HasAttributes: commonxml.HasAttributes{Attributes: []xml.Attr{{Name: xml.Name{Space: nsOStatus, Local: "object-type"}, Value: "http://activitystrea.ms/schema/1.0/person"}}},
+			Rel:           "mentioned",
+			Href:          t.Href,
+		})
+	}
+
+	if id := o.InReplyTo.GetID(); id != "" {
+		e.InReplyTo = &InReplyTo{Ref: id, Href: id}
+	}
+
+	return &e
+}
+
+func as2MediaLink(o *activitypub.Object) *commonxml.Link {
+	href := o.URL.GetID()
+	if href == "" {
+		href = o.ID
+	}
+	if href == "" {
+		return nil
+	}
+
+	l := commonxml.Link{Rel: "enclosure", Type: o.MediaType, Href: href, Title: o.Name}
+	if o.Width != 0 {
+		l.Attributes = append(l.Attributes, mediaAttr("width", o.Width))
+	}
+	if o.Height != 0 {
+		l.Attributes = append(l.Attributes, mediaAttr("height", o.Height))
+	}
+	if d := parseISODuration(o.Duration); d != 0 {
+		l.Attributes = append(l.Attributes, mediaAttr("duration", int(d/time.Second)))
+	}
+
+	return &l
+}
+
+// parseISODuration handles the subset of ISO 8601 durations that show up in
+// practice, e.g. "PT1H2M3S".
+func parseISODuration(s string) time.Duration {
+	if !strings.HasPrefix(s, "PT") {
+		return 0
+	}
+
+	var d time.Duration
+	var num string
+
+	for _, c := range s[2:] {
+		if (c >= '0' && c <= '9') || c == '.' {
+			num += string(c)
+			continue
+		}
+
+		n, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return 0
+		}
+		num = ""
+
+		switch c {
+		case 'H':
+			d += time.Duration(n * float64(time.Hour))
+		case 'M':
+			d += time.Duration(n * float64(time.Minute))
+		case 'S':
+			d += time.Duration(n * float64(time.Second))
+		default:
+			return 0
+		}
+	}
+
+	return d
+}
+
+func as2Author(r *activitypub.Ref) *Author {
+	if r.GetID() == "" {
+		return nil
+	}
+
+	var actor activitypub.Actor
+	if err := r.Decode(&actor); err != nil {
+		return &Author{
+			ID:         r.GetID(),
+			URI:        r.GetID(),
+			ObjectType: "http://activitystrea.ms/schema/1.0/person",
+		}
+	}
+
+	a := Author{
+		ID:                actor.ID,
+		URI:               actor.ID,
+		Name:              actor.PreferredUsername,
+		PreferredUsername: actor.PreferredUsername,
+		DisplayName:       actor.Name,
+		Summary:           actor.Summary,
+		Note:              actor.Summary,
+		ObjectType:        "http://activitystrea.ms/schema/1.0/person",
+	}
+
+	if u := actor.URL.GetID(); u != "" {
+		a.Link = append(a.Link, commonxml.Link{Rel: "alternate", Type: "text/html", Href: u})
+	}
+
+	var icon activitypub.Object
+	if err := actor.Icon.Decode(&icon); err == nil && icon.URL.GetID() != "" {
+		a.Link = append(a.Link, commonxml.Link{Rel: "avatar", Type: icon.MediaType, Href: icon.URL.GetID()})
+	} else if id := actor.Icon.GetID(); id != "" {
+		a.Link = append(a.Link, commonxml.Link{Rel: "avatar", Href: id})
+	}
+
+	return &a
+}
+
+func mediaAttr(name string, v int) xml.Attr {
+	return xml.Attr{Name: xml.Name{Space: nsAtomMedia, Local: name}, Value: strconv.Itoa(v)}
+}
@@ -0,0 +1,58 @@
+package activitystreams
+
+import (
+	"encoding/xml"
+
+	"fknsrs.biz/p/don/commonxml"
+)
+
+const nsMastodon = "http://mastodon.social/schema/1.0"
+
+type Attachment struct {
+	URL         string
+	MediaType   string
+	Length      uint
+	Width       int
+	Height      int
+	Description string
+	Sensitive   bool
+}
+
+type HasAttachments interface {
+	GetAttachments() []Attachment
+}
+
+func attachmentsFromLinks(l []commonxml.Link) []Attachment {
+	var r []Attachment
+
+	for _, e := range l {
+		if e.Rel != "enclosure" || e.Href == "" {
+			continue
+		}
+
+		a := Attachment{
+			URL:         e.Href,
+			MediaType:   e.Type,
+			Length:      e.Length,
+			Width:       mediaAttrInt(&e, "width"),
+			Height:      mediaAttrInt(&e, "height"),
+			Description: e.Title,
+		}
+
+		if attr := e.GetAttribute(xml.Name{Space: nsMastodon, Local: "sensitive"}); attr != nil {
+			a.Sensitive = attr.Value == "true"
+		}
+
+		r = append(r, a)
+	}
+
+	return r
+}
+
+func (o *GenericObject) GetAttachments() []Attachment {
+	return attachmentsFromLinks(o.Link)
+}
+
+func (e *Entry) GetAttachments() []Attachment {
+	return attachmentsFromLinks(e.Link)
+}
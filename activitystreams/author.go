@@ -24,6 +24,14 @@ type Author struct {
 	URLs              []AuthorURL    `xml:"http://portablecontacts.net/spec/1.0 urls" json:"urls,omitempty"`
 	Address           *AuthorAddress `xml:"http://portablecontacts.net/spec/1.0 address" json:"address,omitempty"`
 	Scope             string         `xml:"http://mastodon.social/schema/1.0 scope" json:"scope,omitempty"`
+
+	// FromFeed is set for authors made up from feed metadata, for formats
+	// like RSS that have no proper author. They won't have an account to
+	// find through webfinger.
+	FromFeed bool `xml:"-" json:"-"`
+	// FetchedFrom is the url the feed that made up this author was fetched
+	// from. Unlike anything in the feed itself, it can't be forged.
+	FetchedFrom string `xml:"-" json:"-"`
 }
 
 type AuthorURL struct {
@@ -94,3 +102,37 @@ func (a *Author) GetBestAvatar() string {
 
 	return best
 }
+
+type authorXML struct {
+	ObjectType        string           `xml:"http://activitystrea.ms/spec/1.0/ object-type,omitempty"`
+	ID                string           `xml:"http://www.w3.org/2005/Atom id,omitempty"`
+	URI               string           `xml:"http://www.w3.org/2005/Atom uri,omitempty"`
+	Name              string           `xml:"http://www.w3.org/2005/Atom name,omitempty"`
+	Email             string           `xml:"http://www.w3.org/2005/Atom email,omitempty"`
+	Summary           string           `xml:"http://www.w3.org/2005/Atom summary,omitempty"`
+	Link              []commonxml.Link `xml:"http://www.w3.org/2005/Atom link,omitempty"`
+	PreferredUsername string           `xml:"http://portablecontacts.net/spec/1.0 preferredUsername,omitempty"`
+	DisplayName       string           `xml:"http://portablecontacts.net/spec/1.0 displayName,omitempty"`
+	Note              string           `xml:"http://portablecontacts.net/spec/1.0 note,omitempty"`
+	URLs              []AuthorURL      `xml:"http://portablecontacts.net/spec/1.0 urls,omitempty"`
+	Address           *AuthorAddress   `xml:"http://portablecontacts.net/spec/1.0 address,omitempty"`
+	Scope             string           `xml:"http://mastodon.social/schema/1.0 scope,omitempty"`
+}
+
+func (a *Author) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(authorXML{
+		ObjectType:        a.GetObjectType(),
+		ID:                a.ID,
+		URI:               a.URI,
+		Name:              a.Name,
+		Email:             a.Email,
+		Summary:           a.Summary,
+		Link:              a.Link,
+		PreferredUsername: a.PreferredUsername,
+		DisplayName:       a.DisplayName,
+		Note:              a.Note,
+		URLs:              a.URLs,
+		Address:           a.Address,
+		Scope:             a.Scope,
+	}, start)
+}
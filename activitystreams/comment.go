@@ -1,6 +1,7 @@
 package activitystreams
 
 import (
+	"encoding/xml"
 	"html"
 	"strings"
 )
@@ -24,3 +25,10 @@ func (c *Comment) GetContent() string {
 
 	return ""
 }
+
+func (c *Comment) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	v := c.GenericObject.toXML()
+	v.Content = c.Content
+
+	return e.EncodeElement(v, start)
+}
@@ -2,6 +2,7 @@ package activitystreams
 
 import (
 	"encoding/xml"
+	"time"
 )
 
 type Content struct {
@@ -14,3 +15,11 @@ type InReplyTo struct {
 	Ref     string   `xml:"ref,attr" json:"ref"`
 	Href    string   `xml:"href,attr" json:"href"`
 }
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
@@ -11,6 +11,7 @@ import (
 
 type baseEntry struct {
 	commonxml.HasLinks
+	EventTimes
 
 	feed *Feed `xml:"-" json:"-"`
 
@@ -40,22 +41,12 @@ func (a *Entry) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	}
 
 	if n := a.baseEntry.Object; n != nil {
+		var objectType string
 		if c := n.GetChildByTagName(xml.Name{Space: "http://activitystrea.ms/spec/1.0/", Local: "object-type"}); c != nil {
-			switch c.Text() {
-			case "http://activitystrea.ms/schema/1.0/activity":
-				a.Object = &Activity{}
-			case "http://activitystrea.ms/schema/1.0/note":
-				a.Object = &Note{}
-			case "http://activitystrea.ms/schema/1.0/comment":
-				a.Object = &Comment{}
-			case "http://activitystrea.ms/schema/1.0/person":
-				a.Object = &Author{}
-			}
+			objectType = c.Text()
 		}
 
-		if a.Object == nil {
-			a.Object = &GenericObject{}
-		}
+		a.Object = newObject(objectType)
 
 		if err := n.UnmarshalInto(a.Object); err != nil {
 			return err
@@ -160,3 +151,99 @@ func (e *Entry) GetContent() string {
 func (e *Entry) GetInReplyTo() *InReplyTo {
 	return e.InReplyTo
 }
+
+// the media accessors only apply when the entry is itself the media object;
+// a note with an enclosure is still a note
+
+func (e *Entry) GetMediaURL() string {
+	if l := mediaLink(&e.HasLinks); l != nil && isMediaObjectType(e.ObjectType) {
+		return l.Href
+	}
+
+	return ""
+}
+
+func (e *Entry) GetMediaType() string {
+	if l := mediaLink(&e.HasLinks); l != nil && isMediaObjectType(e.ObjectType) {
+		return l.Type
+	}
+
+	return ""
+}
+
+func (e *Entry) GetWidth() int {
+	if !isMediaObjectType(e.ObjectType) {
+		return 0
+	}
+
+	return mediaAttrInt(mediaLink(&e.HasLinks), "width")
+}
+
+func (e *Entry) GetHeight() int {
+	if !isMediaObjectType(e.ObjectType) {
+		return 0
+	}
+
+	return mediaAttrInt(mediaLink(&e.HasLinks), "height")
+}
+
+func (e *Entry) GetDuration() time.Duration {
+	if !isMediaObjectType(e.ObjectType) {
+		return 0
+	}
+
+	return time.Duration(mediaAttrInt(mediaLink(&e.HasLinks), "duration")) * time.Second
+}
+
+func (e *Entry) GetTargetURL() string {
+	if e.ObjectType != "http://activitystrea.ms/schema/1.0/bookmark" {
+		return ""
+	}
+
+	if l := e.GetLink("related"); l != nil {
+		return l.Href
+	}
+
+	return ""
+}
+
+type entryXML struct {
+	ObjectType string           `xml:"http://activitystrea.ms/spec/1.0/ object-type,omitempty"`
+	ID         string           `xml:"http://www.w3.org/2005/Atom id"`
+	Title      string           `xml:"http://www.w3.org/2005/Atom title"`
+	Summary    string           `xml:"http://www.w3.org/2005/Atom summary,omitempty"`
+	Content    []Content        `xml:"http://www.w3.org/2005/Atom content,omitempty"`
+	Author     *Author          `xml:"http://www.w3.org/2005/Atom author,omitempty"`
+	Link       []commonxml.Link `xml:"http://www.w3.org/2005/Atom link,omitempty"`
+	Verb       string           `xml:"http://activitystrea.ms/spec/1.0/ verb,omitempty"`
+	Object     ObjectLike       `xml:"http://activitystrea.ms/spec/1.0/ object,omitempty"`
+	InReplyTo  *InReplyTo       `xml:"http://purl.org/syndication/thread/1.0 in-reply-to,omitempty"`
+	Published  string           `xml:"http://www.w3.org/2005/Atom published,omitempty"`
+	Updated    string           `xml:"http://www.w3.org/2005/Atom updated,omitempty"`
+	StartTime  string           `xml:"urn:ietf:params:xml:ns:xcal dtstart,omitempty"`
+	EndTime    string           `xml:"urn:ietf:params:xml:ns:xcal dtend,omitempty"`
+}
+
+func (a *Entry) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	v := entryXML{
+		ObjectType: a.ObjectType,
+		ID:         a.ID,
+		Title:      a.Title,
+		Summary:    a.Summary,
+		Content:    a.Content,
+		Author:     a.Author,
+		Link:       a.Link,
+		Verb:       a.Verb,
+		InReplyTo:  a.InReplyTo,
+		Published:  formatTime(a.Published),
+		Updated:    formatTime(a.Updated),
+		StartTime:  a.StartTime,
+		EndTime:    a.EndTime,
+	}
+
+	if a.Object != nil {
+		v.Object = a.Object
+	}
+
+	return e.EncodeElement(v, start)
+}
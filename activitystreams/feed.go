@@ -2,6 +2,7 @@ package activitystreams
 
 import (
 	"encoding/xml"
+	"net/url"
 	"time"
 
 	"fknsrs.biz/p/don/commonxml"
@@ -32,6 +33,37 @@ func (f *Feed) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	return nil
 }
 
+// scopedID makes an item id from a feed that doesn't have proper ids, like
+// RSS or JSON Feed, safe to use globally. Those ids are often only unique
+// within their own feed ("1", "42", a slug), so unless the id is already an
+// absolute uri it's hung off the feed's id.
+func scopedID(feedID, id string) string {
+	if feedID == "" || id == "" {
+		return id
+	}
+
+	if u, err := url.Parse(id); err == nil && u.Scheme != "" {
+		return id
+	}
+
+	return feedID + "#" + id
+}
+
+// SetFetchedFrom records where a feed came from on the authors that were
+// made up from it. Those authors are only saved once this is set.
+func (f *Feed) SetFetchedFrom(u string) {
+	set := func(a *Author) {
+		if a != nil && a.FromFeed {
+			a.FetchedFrom = u
+		}
+	}
+
+	set(f.Author)
+	for i := range f.Activities {
+		set(f.Activities[i].Author)
+	}
+}
+
 func (f *Feed) GetActivities() []ActivityLike {
 	a := make([]ActivityLike, len(f.Activities))
 
@@ -57,3 +89,24 @@ func (f *Feed) GetSalmon() string {
 
 	return ""
 }
+
+type feedXML struct {
+	XMLName xml.Name         `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string           `xml:"http://www.w3.org/2005/Atom id"`
+	Title   string           `xml:"http://www.w3.org/2005/Atom title"`
+	Updated string           `xml:"http://www.w3.org/2005/Atom updated,omitempty"`
+	Author  *Author          `xml:"http://www.w3.org/2005/Atom author,omitempty"`
+	Link    []commonxml.Link `xml:"http://www.w3.org/2005/Atom link,omitempty"`
+	Entries []Entry          `xml:"http://www.w3.org/2005/Atom entry,omitempty"`
+}
+
+func (f *Feed) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.Encode(feedXML{
+		ID:      f.ID,
+		Title:   f.Title,
+		Updated: formatTime(f.Updated),
+		Author:  f.Author,
+		Link:    f.Link,
+		Entries: f.Activities,
+	})
+}
@@ -317,3 +317,175 @@ const fixtureFavorite = `
   </entry>
 </feed>
 `
+
+const fixtureRSS1 = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+  <channel>
+    <title>Example Podcast</title>
+    <link>https://podcast.example.com/</link>
+    <description>Talking about things</description>
+    <atom:link href="https://podcast.example.com/feed.xml" rel="self" type="application/rss+xml"/>
+    <atom:link href="https://hub.example.com/" rel="hub"/>
+    <image>
+      <url>https://podcast.example.com/logo.png</url>
+      <title>Example Podcast</title>
+      <link>https://podcast.example.com/</link>
+    </image>
+    <lastBuildDate>Sat, 15 Apr 2017 04:12:30 +0000</lastBuildDate>
+    <item>
+      <title>Episode 1</title>
+      <link>https://podcast.example.com/episodes/1</link>
+      <guid isPermaLink="false">episode-1</guid>
+      <description>The first one</description>
+      <content:encoded><![CDATA[<p>The <b>first</b> one</p>]]></content:encoded>
+      <pubDate>Fri, 14 Apr 2017 10:00:00 GMT</pubDate>
+      <enclosure url="https://podcast.example.com/episodes/1.mp3" length="12345" type="audio/mpeg"/>
+    </item>
+    <item>
+      <title>Episode 0</title>
+      <guid>https://podcast.example.com/episodes/0</guid>
+      <description>A pilot</description>
+      <pubDate>Thu, 6 Apr 2017 10:00:00 +0200</pubDate>
+    </item>
+  </channel>
+</rss>
+`
+
+const fixtureRDF1 = `<?xml version="1.0" encoding="UTF-8"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel rdf:about="https://news.example.org/rss">
+    <title>Example News</title>
+    <link>https://news.example.org/</link>
+    <description>All the news</description>
+  </channel>
+  <item rdf:about="https://news.example.org/stories/42">
+    <title>Something happened</title>
+    <link>https://news.example.org/stories/42</link>
+    <description>It really did</description>
+    <dc:date>2017-04-15T04:12:24+00:00</dc:date>
+  </item>
+</rdf:RDF>
+`
+
+const fixtureJSONFeed1 = `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Example Blog",
+  "home_page_url": "https://blog.example.net/",
+  "feed_url": "https://blog.example.net/feed.json",
+  "hubs": [{"type": "WebSub", "url": "https://hub.example.net/"}],
+  "authors": [{"name": "Jo Example", "url": "https://blog.example.net/about", "avatar": "https://blog.example.net/jo.png"}],
+  "items": [
+    {
+      "id": "2",
+      "url": "https://blog.example.net/posts/2",
+      "title": "Second post",
+      "content_html": "<p>Hello again</p>",
+      "date_published": "2017-04-15T04:12:24+00:00",
+      "attachments": [{"url": "https://blog.example.net/posts/2.jpg", "mime_type": "image/jpeg", "size_in_bytes": 2048}]
+    },
+    {
+      "id": 1,
+      "url": "https://blog.example.net/posts/1",
+      "content_text": "Hello",
+      "date_published": "2017-04-14T04:12:24+00:00",
+      "authors": [{"name": "Guest", "url": "https://guest.example.org/"}]
+    }
+  ]
+}`
+
+const fixtureAS2Outbox1 = `{
+  "@context": "https://www.w3.org/ns/activitystreams",
+  "id": "https://social.example.com/users/alice/outbox?page=true",
+  "type": "OrderedCollectionPage",
+  "orderedItems": [
+    {
+      "id": "https://social.example.com/users/alice/statuses/1/activity",
+      "type": "Create",
+      "actor": {
+        "id": "https://social.example.com/users/alice",
+        "type": "Person",
+        "preferredUsername": "alice",
+        "name": "Alice",
+        "url": "https://social.example.com/@alice",
+        "icon": {"type": "Image", "mediaType": "image/png", "url": "https://social.example.com/alice.png"},
+        "inbox": "https://social.example.com/users/alice/inbox"
+      },
+      "object": {
+        "id": "https://social.example.com/users/alice/statuses/1",
+        "type": "Note",
+        "content": "<p>Look at this</p>",
+        "url": "https://social.example.com/@alice/1",
+        "published": "2017-04-15T04:12:24Z",
+        "inReplyTo": "https://other.example.org/notes/9",
+        "attachment": [
+          {"type": "Document", "mediaType": "image/png", "url": "https://social.example.com/media/1.png", "name": "a cat", "width": 640, "height": 480}
+        ],
+        "tag": [
+          {"type": "Mention", "href": "https://other.example.org/users/bob", "name": "@bob@other.example.org"},
+          {"type": "Hashtag", "href": "https://social.example.com/tags/cats", "name": "#cats"}
+        ]
+      }
+    },
+    {
+      "id": "https://social.example.com/users/alice/statuses/2/activity",
+      "type": "Announce",
+      "actor": "https://social.example.com/users/alice",
+      "published": "2017-04-16T04:12:24Z",
+      "object": "https://other.example.org/notes/10"
+    }
+  ]
+}`
+
+const fixtureTypedObjects1 = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:activity="http://activitystrea.ms/spec/1.0/" xmlns:media="http://purl.org/syndication/atommedia" xmlns:xcal="urn:ietf:params:xml:ns:xcal">
+  <id>https://photos.example.com/users/sam.atom</id>
+  <title>sam</title>
+  <entry>
+    <id>https://photos.example.com/activities/1</id>
+    <title>sam posted a photo</title>
+    <activity:verb>http://activitystrea.ms/schema/1.0/post</activity:verb>
+    <published>2017-04-15T04:12:24Z</published>
+    <activity:object>
+      <activity:object-type>http://activitystrea.ms/schema/1.0/image</activity:object-type>
+      <id>https://photos.example.com/photos/1</id>
+      <title>A sunset</title>
+      <link rel="alternate" type="text/html" href="https://photos.example.com/photos/1"/>
+      <link rel="enclosure" type="image/jpeg" href="https://photos.example.com/photos/1.jpg" media:width="800" media:height="600"/>
+    </activity:object>
+  </entry>
+  <entry>
+    <id>https://photos.example.com/activities/2</id>
+    <title>sam posted an event</title>
+    <activity:verb>http://activitystrea.ms/schema/1.0/post</activity:verb>
+    <published>2017-04-16T04:12:24Z</published>
+    <activity:object>
+      <activity:object-type>http://activitystrea.ms/schema/1.0/event</activity:object-type>
+      <id>https://photos.example.com/events/1</id>
+      <title>Photo walk</title>
+      <xcal:dtstart>2017-05-01T09:00:00Z</xcal:dtstart>
+      <xcal:dtend>2017-05-01T12:00:00Z</xcal:dtend>
+    </activity:object>
+  </entry>
+</feed>
+`
+
+const fixtureMentions1 = `
+<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:activity="http://activitystrea.ms/spec/1.0/" xmlns:ostatus="http://ostatus.org/schema/1.0">
+  <id>https://social.example.com/users/kim.atom</id>
+  <title>kim</title>
+  <entry>
+    <id>https://social.example.com/statuses/1</id>
+    <title>kim posted a note</title>
+    <activity:object-type>http://activitystrea.ms/schema/1.0/note</activity:object-type>
+    <activity:verb>http://activitystrea.ms/schema/1.0/post</activity:verb>
+    <published>2017-04-15T04:12:24Z</published>
+    <content type="html">hi @lee and !cats</content>
+    <link rel="alternate" type="text/html" href="https://social.example.com/statuses/1"/>
+    <link rel="ostatus:attention" ostatus:object-type="http://activitystrea.ms/schema/1.0/person" href="https://other.example.com/users/lee"/>
+    <link rel="mentioned" ostatus:object-type="http://activitystrea.ms/schema/1.0/person" href="https://other.example.com/users/lee"/>
+    <link rel="mentioned" ostatus:object-type="http://activitystrea.ms/schema/1.0/group" href="https://other.example.com/groups/cats"/>
+    <link rel="mentioned" ostatus:object-type="http://activitystrea.ms/schema/1.0/collection" href="http://activityschema.org/collection/public"/>
+  </entry>
+</feed>
+`
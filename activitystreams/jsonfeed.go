@@ -0,0 +1,227 @@
+package activitystreams
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/commonxml"
+)
+
+// jsonFeedID is a string, but some generators send numbers.
+type jsonFeedID string
+
+func (i *jsonFeedID) UnmarshalJSON(d []byte) error {
+	d = bytes.TrimSpace(d)
+
+	if len(d) > 0 && d[0] == '"' {
+		var s string
+		if err := json.Unmarshal(d, &s); err != nil {
+			return err
+		}
+
+		*i = jsonFeedID(s)
+
+		return nil
+	}
+
+	if bytes.Equal(d, []byte("null")) {
+		return nil
+	}
+
+	*i = jsonFeedID(d)
+
+	return nil
+}
+
+type jsonFeedAuthor struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Avatar string `json:"avatar"`
+}
+
+type jsonFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	Title       string `json:"title"`
+	SizeInBytes uint   `json:"size_in_bytes"`
+}
+
+type jsonFeedHub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type jsonFeedItem struct {
+	ID            jsonFeedID           `json:"id"`
+	URL           string               `json:"url"`
+	ExternalURL   string               `json:"external_url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	Image         string               `json:"image"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Author        *jsonFeedAuthor      `json:"author"`
+	Authors       []jsonFeedAuthor     `json:"authors"`
+	Attachments   []jsonFeedAttachment `json:"attachments"`
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description"`
+	NextURL     string           `json:"next_url"`
+	Icon        string           `json:"icon"`
+	Author      *jsonFeedAuthor  `json:"author"`
+	Authors     []jsonFeedAuthor `json:"authors"`
+	Hubs        []jsonFeedHub    `json:"hubs"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+// ParseJSONFeed decodes a JSON Feed (1.0 or 1.1) document and maps it onto
+// a Feed.
+func ParseJSONFeed(d []byte) (*Feed, error) {
+	var v jsonFeed
+	if err := json.Unmarshal(d, &v); err != nil {
+		return nil, errors.Wrap(err, "activitystreams.ParseJSONFeed")
+	}
+
+	if !strings.HasPrefix(v.Version, "https://jsonfeed.org/version/") {
+		return nil, errors.Errorf("activitystreams.ParseJSONFeed: unrecognised version %q", v.Version)
+	}
+
+	var f Feed
+
+	f.ID = v.FeedURL
+	if f.ID == "" {
+		f.ID = v.HomePageURL
+	}
+	f.Title = v.Title
+
+	if v.HomePageURL != "" {
+		f.Link = append(f.Link, commonxml.Link{Rel: "alternate", Type: "text/html", Href: v.HomePageURL})
+	}
+	if v.FeedURL != "" {
+		f.Link = append(f.Link, commonxml.Link{Rel: "self", Type: "application/feed+json", Href: v.FeedURL})
+	}
+	if v.NextURL != "" {
+		f.Link = append(f.Link, commonxml.Link{Rel: "next", Type: "application/feed+json", Href: v.NextURL})
+	}
+	for _, h := range v.Hubs {
+		if strings.EqualFold(h.Type, "websub") || strings.EqualFold(h.Type, "pubsubhubbub") {
+			f.Link = append(f.Link, commonxml.Link{Rel: "hub", Href: h.URL})
+		}
+	}
+
+	// like RSS, a feed without an author is represented by the feed itself
+	if a := jsonFeedFirstAuthor(v.Author, v.Authors); a != nil {
+		f.Author = jsonFeedMakeAuthor(a, v.Icon)
+	} else {
+		f.Author = jsonFeedMakeAuthor(&jsonFeedAuthor{Name: v.Title, URL: v.HomePageURL}, v.Icon)
+		f.Author.Summary = v.Description
+	}
+
+	for _, it := range v.Items {
+		e := jsonFeedEntry(f.ID, &it)
+
+		// items can have their own authors, so rather than pointing entries
+		// back at the feed the author is copied over
+		if a := jsonFeedFirstAuthor(it.Author, it.Authors); a != nil {
+			e.Author = jsonFeedMakeAuthor(a, "")
+		} else {
+			e.Author = f.Author
+		}
+
+		f.Activities = append(f.Activities, e)
+	}
+
+	for _, e := range f.Activities {
+		if e.Updated.After(f.Updated) {
+			f.Updated = e.Updated
+		}
+	}
+
+	return &f, nil
+}
+
+func jsonFeedFirstAuthor(a *jsonFeedAuthor, l []jsonFeedAuthor) *jsonFeedAuthor {
+	if len(l) > 0 {
+		return &l[0]
+	}
+
+	return a
+}
+
+func jsonFeedMakeAuthor(v *jsonFeedAuthor, fallbackAvatar string) *Author {
+	a := Author{
+		ID:          v.URL,
+		URI:         v.URL,
+		Name:        v.Name,
+		DisplayName: v.Name,
+		ObjectType:  "http://activitystrea.ms/schema/1.0/person",
+		FromFeed:    true,
+	}
+
+	if v.URL != "" {
+		a.Link = append(a.Link, commonxml.Link{Rel: "alternate", Type: "text/html", Href: v.URL})
+	}
+
+	if avatar := v.Avatar; avatar != "" {
+		a.Link = append(a.Link, commonxml.Link{Rel: "avatar", Href: avatar})
+	} else if fallbackAvatar != "" {
+		a.Link = append(a.Link, commonxml.Link{Rel: "avatar", Href: fallbackAvatar})
+	}
+
+	return &a
+}
+
+func jsonFeedEntry(feedID string, it *jsonFeedItem) Entry {
+	var e Entry
+
+	e.ID = scopedID(feedID, string(it.ID))
+	if e.ID == "" {
+		e.ID = it.URL
+	}
+	e.Title = it.Title
+	e.Summary = it.Summary
+	e.Verb = "http://activitystrea.ms/schema/1.0/post"
+	e.ObjectType = "http://activitystrea.ms/schema/1.0/note"
+
+	e.Published, _ = time.Parse(time.RFC3339, it.DatePublished)
+	e.Updated, _ = time.Parse(time.RFC3339, it.DateModified)
+	if e.Updated.IsZero() {
+		e.Updated = e.Published
+	}
+
+	if it.URL != "" {
+		e.Link = append(e.Link, commonxml.Link{Rel: "alternate", Type: "text/html", Href: it.URL})
+	}
+	if it.ExternalURL != "" {
+		e.Link = append(e.Link, commonxml.Link{Rel: "related", Href: it.ExternalURL})
+	}
+	if it.Image != "" {
+		e.Link = append(e.Link, commonxml.Link{Rel: "preview", Href: it.Image})
+	}
+	for _, a := range it.Attachments {
+		if a.URL == "" {
+			continue
+		}
+
+		e.Link = append(e.Link, commonxml.Link{Rel: "enclosure", Type: a.MimeType, Href: a.URL, Title: a.Title, Length: a.SizeInBytes})
+	}
+
+	if it.ContentHTML != "" {
+		e.Content = append(e.Content, Content{Type: "html", Body: it.ContentHTML})
+	} else if it.ContentText != "" {
+		e.Content = append(e.Content, Content{Type: "text", Body: it.ContentText})
+	}
+
+	return e
+}
@@ -0,0 +1,288 @@
+package activitystreams
+
+import (
+	"encoding/xml"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"fknsrs.biz/p/don/commonxml"
+)
+
+const (
+	nsAtomMedia = "http://purl.org/syndication/atommedia"
+	nsXCal      = "urn:ietf:params:xml:ns:xcal"
+)
+
+type HasMedia interface {
+	GetMediaURL() string
+	GetMediaType() string
+}
+
+type HasDimensions interface {
+	GetWidth() int
+	GetHeight() int
+}
+
+type HasDuration interface {
+	GetDuration() time.Duration
+}
+
+type HasTimeRange interface {
+	GetStartTime() time.Time
+	GetEndTime() time.Time
+}
+
+type HasTargetURL interface {
+	GetTargetURL() string
+}
+
+// newObject returns an empty object of the right type to decode something
+// with the given object type into.
+func newObject(objectType string) ObjectLike {
+	switch objectType {
+	case "http://activitystrea.ms/schema/1.0/activity":
+		return &Activity{}
+	case "http://activitystrea.ms/schema/1.0/note":
+		return &Note{}
+	case "http://activitystrea.ms/schema/1.0/comment":
+		return &Comment{}
+	case "http://activitystrea.ms/schema/1.0/person":
+		return &Author{}
+	case "http://activitystrea.ms/schema/1.0/image", "http://activitystrea.ms/schema/1.0/photo":
+		return &Image{}
+	case "http://activitystrea.ms/schema/1.0/video":
+		return &Video{}
+	case "http://activitystrea.ms/schema/1.0/audio":
+		return &Audio{}
+	case "http://activitystrea.ms/schema/1.0/file":
+		return &File{}
+	case "http://activitystrea.ms/schema/1.0/bookmark":
+		return &Bookmark{}
+	case "http://activitystrea.ms/schema/1.0/event":
+		return &Event{}
+	case "http://activitystrea.ms/schema/1.0/group":
+		return &Group{}
+	case "http://activitystrea.ms/schema/1.0/collection":
+		return &Collection{}
+	}
+
+	return &GenericObject{}
+}
+
+func isMediaObjectType(objectType string) bool {
+	switch objectType {
+	case "http://activitystrea.ms/schema/1.0/image",
+		"http://activitystrea.ms/schema/1.0/photo",
+		"http://activitystrea.ms/schema/1.0/video",
+		"http://activitystrea.ms/schema/1.0/audio",
+		"http://activitystrea.ms/schema/1.0/file":
+		return true
+	}
+
+	return false
+}
+
+func htmlContent(l []Content) string {
+	for _, c := range l {
+		if c.Type == "html" {
+			return c.Body
+		}
+	}
+
+	for _, c := range l {
+		return strings.Replace(html.EscapeString(c.Body), "\n", "<br>", -1)
+	}
+
+	return ""
+}
+
+// mediaLink finds the link pointing at the actual media for an object.
+// Enclosures are preferred, but some servers only give a non-html
+// alternate link.
+func mediaLink(v *commonxml.HasLinks) *commonxml.Link {
+	if l := v.GetLink("enclosure"); l != nil {
+		return l
+	}
+
+	for _, l := range v.GetLinks("alternate") {
+		if l.Type != "" && l.Type != "text/html" {
+			return &l
+		}
+	}
+
+	return nil
+}
+
+func mediaAttrInt(l *commonxml.Link, name string) int {
+	if l == nil {
+		return 0
+	}
+
+	attr := l.GetAttribute(xml.Name{Space: nsAtomMedia, Local: name})
+	if attr == nil {
+		return 0
+	}
+
+	n, err := strconv.Atoi(attr.Value)
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
+
+// MediaObject is the base for the object types that are mostly a pointer to
+// a file somewhere.
+type MediaObject struct {
+	GenericObject
+
+	Content []Content `xml:"http://www.w3.org/2005/Atom content,omitempty" json:"content,omitempty"`
+}
+
+func (o *MediaObject) GetContent() string {
+	return htmlContent(o.Content)
+}
+
+func (o *MediaObject) GetMediaURL() string {
+	if l := mediaLink(&o.HasLinks); l != nil {
+		return l.Href
+	}
+
+	return ""
+}
+
+func (o *MediaObject) GetMediaType() string {
+	if l := mediaLink(&o.HasLinks); l != nil {
+		return l.Type
+	}
+
+	return ""
+}
+
+func (o *MediaObject) GetWidth() int {
+	return mediaAttrInt(mediaLink(&o.HasLinks), "width")
+}
+
+func (o *MediaObject) GetHeight() int {
+	return mediaAttrInt(mediaLink(&o.HasLinks), "height")
+}
+
+func (o *MediaObject) GetDuration() time.Duration {
+	return time.Duration(mediaAttrInt(mediaLink(&o.HasLinks), "duration")) * time.Second
+}
+
+func (o *MediaObject) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	v := o.GenericObject.toXML()
+	v.Content = o.Content
+
+	return e.EncodeElement(v, start)
+}
+
+type Image struct{ MediaObject }
+
+func (o *Image) GetRepresentativeImage() string {
+	if s := o.GenericObject.GetRepresentativeImage(); s != "" {
+		return s
+	}
+
+	return o.GetMediaURL()
+}
+
+type Video struct{ MediaObject }
+
+type Audio struct{ MediaObject }
+
+type File struct{ MediaObject }
+
+type Bookmark struct {
+	GenericObject
+
+	Content []Content `xml:"http://www.w3.org/2005/Atom content,omitempty" json:"content,omitempty"`
+}
+
+func (o *Bookmark) GetContent() string {
+	return htmlContent(o.Content)
+}
+
+func (o *Bookmark) GetTargetURL() string {
+	if l := o.GetLink("related"); l != nil {
+		return l.Href
+	}
+
+	return ""
+}
+
+func (o *Bookmark) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	v := o.GenericObject.toXML()
+	v.Content = o.Content
+
+	return e.EncodeElement(v, start)
+}
+
+// EventTimes holds the xCal start and end times used by events.
+type EventTimes struct {
+	StartTime string `xml:"urn:ietf:params:xml:ns:xcal dtstart,omitempty" json:"startTime,omitempty"`
+	EndTime   string `xml:"urn:ietf:params:xml:ns:xcal dtend,omitempty" json:"endTime,omitempty"`
+}
+
+var eventTimeFormats = []string{
+	time.RFC3339,
+	"20060102T150405Z0700",
+	"20060102T150405",
+	"2006-01-02",
+	"20060102",
+}
+
+func parseEventTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+
+	for _, f := range eventTimeFormats {
+		if t, err := time.Parse(f, s); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (t *EventTimes) GetStartTime() time.Time {
+	return parseEventTime(t.StartTime)
+}
+
+func (t *EventTimes) GetEndTime() time.Time {
+	return parseEventTime(t.EndTime)
+}
+
+type Event struct {
+	GenericObject
+	EventTimes
+
+	Content []Content `xml:"http://www.w3.org/2005/Atom content,omitempty" json:"content,omitempty"`
+}
+
+func (o *Event) GetContent() string {
+	return htmlContent(o.Content)
+}
+
+func (o *Event) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	v := o.GenericObject.toXML()
+	v.Content = o.Content
+	v.StartTime = o.StartTime
+	v.EndTime = o.EndTime
+
+	return e.EncodeElement(v, start)
+}
+
+type Group struct{ GenericObject }
+
+func (o *Group) GetRepresentativeImage() string {
+	if l := o.GetLink("avatar"); l != nil {
+		return l.Href
+	}
+
+	return o.GenericObject.GetRepresentativeImage()
+}
+
+type Collection struct{ GenericObject }
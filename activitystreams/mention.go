@@ -0,0 +1,79 @@
+package activitystreams
+
+import (
+	"encoding/xml"
+
+	"fknsrs.biz/p/don/commonxml"
+)
+
+const nsOStatus = "http://ostatus.org/schema/1.0"
+
+const (
+	MentionKindPerson     = "person"
+	MentionKindGroup      = "group"
+	MentionKindCollection = "collection"
+)
+
+type Mention struct {
+	Href string
+	Kind string
+}
+
+type HasMentions interface {
+	GetMentions() []Mention
+}
+
+func isMentionRel(rel string) bool {
+	switch rel {
+	case "mentioned", "ostatus:attention", nsOStatus + "/attention":
+		return true
+	}
+
+	return false
+}
+
+// mentionKind works out what sort of thing a mention points at. Links
+// without an object type are almost always people, so that's the default.
+func mentionKind(l *commonxml.Link) string {
+	attr := l.GetAttribute(xml.Name{Space: nsOStatus, Local: "object-type"})
+	if attr == nil {
+		return MentionKindPerson
+	}
+
+	switch attr.Value {
+	case "http://activitystrea.ms/schema/1.0/group":
+		return MentionKindGroup
+	case "http://activitystrea.ms/schema/1.0/collection":
+		return MentionKindCollection
+	}
+
+	return MentionKindPerson
+}
+
+// mentionsFromLinks collects mentioned and attention links. Servers
+// usually send both for the same target, so each href is only returned
+// once.
+func mentionsFromLinks(l []commonxml.Link) []Mention {
+	var r []Mention
+
+	seen := make(map[string]bool)
+	for _, e := range l {
+		if !isMentionRel(e.Rel) || e.Href == "" || seen[e.Href] {
+			continue
+		}
+
+		seen[e.Href] = true
+
+		r = append(r, Mention{Href: e.Href, Kind: mentionKind(&e)})
+	}
+
+	return r
+}
+
+func (o *GenericObject) GetMentions() []Mention {
+	return mentionsFromLinks(o.Link)
+}
+
+func (e *Entry) GetMentions() []Mention {
+	return mentionsFromLinks(e.Link)
+}
@@ -1,6 +1,7 @@
 package activitystreams
 
 import (
+	"encoding/xml"
 	"html"
 	"strings"
 )
@@ -24,3 +25,10 @@ func (n *Note) GetContent() string {
 
 	return ""
 }
+
+func (n *Note) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	v := n.GenericObject.toXML()
+	v.Content = n.Content
+
+	return e.EncodeElement(v, start)
+}
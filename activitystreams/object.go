@@ -51,3 +51,28 @@ func (o *GenericObject) GetPermalink() string {
 
 	return ""
 }
+
+type genericObjectXML struct {
+	ObjectType string           `xml:"http://activitystrea.ms/spec/1.0/ object-type,omitempty"`
+	ID         string           `xml:"http://www.w3.org/2005/Atom id,omitempty"`
+	Title      string           `xml:"http://www.w3.org/2005/Atom title,omitempty"`
+	Summary    string           `xml:"http://www.w3.org/2005/Atom summary,omitempty"`
+	Content    []Content        `xml:"http://www.w3.org/2005/Atom content,omitempty"`
+	Link       []commonxml.Link `xml:"http://www.w3.org/2005/Atom link,omitempty"`
+	StartTime  string           `xml:"urn:ietf:params:xml:ns:xcal dtstart,omitempty"`
+	EndTime    string           `xml:"urn:ietf:params:xml:ns:xcal dtend,omitempty"`
+}
+
+func (o *GenericObject) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(o.toXML(), start)
+}
+
+func (o *GenericObject) toXML() genericObjectXML {
+	return genericObjectXML{
+		ObjectType: o.ObjectType,
+		ID:         o.ID,
+		Title:      o.Title,
+		Summary:    o.Summary,
+		Link:       o.Link,
+	}
+}
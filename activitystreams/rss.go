@@ -0,0 +1,231 @@
+package activitystreams
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/commonxml"
+)
+
+const nsRSS1 = "http://purl.org/rss/1.0/"
+
+// rssText is used for the plain RSS elements. encoding/xml matches a field
+// with no namespace against elements in any namespace, so without this
+// things like <media:title> would clobber <title>. Namespaced fields have to
+// come before the plain ones for the same reason.
+type rssText struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+func pickText(l []rssText) string {
+	for _, e := range l {
+		if e.XMLName.Space == "" || e.XMLName.Space == nsRSS1 {
+			return strings.TrimSpace(e.Value)
+		}
+	}
+
+	return ""
+}
+
+type rssImage struct {
+	URL string `xml:"url"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length uint   `xml:"length,attr"`
+}
+
+type rssChannel struct {
+	About       string           `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       []rssText        `xml:"title"`
+	AtomLinks   []commonxml.Link `xml:"http://www.w3.org/2005/Atom link"`
+	Link        []rssText        `xml:"link"`
+	Description []rssText        `xml:"description"`
+	Image       *rssImage        `xml:"image"`
+	PubDate     string           `xml:"pubDate"`
+	LastBuild   string           `xml:"lastBuildDate"`
+	DCDate      string           `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Items       []rssItem        `xml:"item"`
+}
+
+type rssItem struct {
+	About       string         `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       []rssText      `xml:"title"`
+	Link        []rssText      `xml:"link"`
+	Description []rssText      `xml:"description"`
+	Encoded     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	GUID        *rssGUID       `xml:"guid"`
+	PubDate     string         `xml:"pubDate"`
+	DCDate      string         `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Enclosures  []rssEnclosure `xml:"enclosure"`
+}
+
+type rssXML struct {
+	XMLName xml.Name   `xml:"rss"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rdfXML covers RSS 1.0, where items are siblings of the channel rather than
+// children of it.
+type rdfXML struct {
+	XMLName xml.Name   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# RDF"`
+	Channel rssChannel `xml:"http://purl.org/rss/1.0/ channel"`
+	Image   *rssImage  `xml:"http://purl.org/rss/1.0/ image"`
+	Items   []rssItem  `xml:"http://purl.org/rss/1.0/ item"`
+}
+
+// ParseRSS decodes an RSS 2.0 document and maps it onto a Feed.
+func ParseRSS(d []byte) (*Feed, error) {
+	var v rssXML
+	if err := commonxml.Parse(d, &v); err != nil {
+		return nil, errors.Wrap(err, "activitystreams.ParseRSS")
+	}
+
+	return rssToFeed(&v.Channel, v.Channel.Image, v.Channel.Items), nil
+}
+
+// ParseRDF decodes an RSS 1.0 (RDF) document and maps it onto a Feed.
+func ParseRDF(d []byte) (*Feed, error) {
+	var v rdfXML
+	if err := commonxml.Parse(d, &v); err != nil {
+		return nil, errors.Wrap(err, "activitystreams.ParseRDF")
+	}
+
+	img := v.Image
+	if img == nil {
+		img = v.Channel.Image
+	}
+
+	return rssToFeed(&v.Channel, img, v.Items), nil
+}
+
+func rssToFeed(c *rssChannel, img *rssImage, items []rssItem) *Feed {
+	link := pickText(c.Link)
+
+	f := Feed{}
+	f.Title = pickText(c.Title)
+	f.ID = link
+	if f.ID == "" {
+		f.ID = c.About
+	}
+	f.Updated = parseRSSTime(c.LastBuild, c.PubDate, c.DCDate)
+	f.Link = c.AtomLinks
+
+	// RSS has no real concept of an author, so the channel stands in for one
+	author := Author{
+		ID:          link,
+		URI:         link,
+		Name:        f.Title,
+		DisplayName: f.Title,
+		Summary:     pickText(c.Description),
+		ObjectType:  "http://activitystrea.ms/schema/1.0/person",
+		FromFeed:    true,
+	}
+	if link != "" {
+		author.Link = append(author.Link, commonxml.Link{Rel: "alternate", Type: "text/html", Href: link})
+	}
+	if img != nil && strings.TrimSpace(img.URL) != "" {
+		author.Link = append(author.Link, commonxml.Link{Rel: "avatar", Href: strings.TrimSpace(img.URL)})
+	}
+	f.Author = &author
+
+	for _, it := range items {
+		f.Activities = append(f.Activities, rssItemToEntry(f.ID, &it))
+	}
+
+	for i := range f.Activities {
+		f.Activities[i].feed = &f
+	}
+
+	return &f
+}
+
+func rssItemToEntry(feedID string, it *rssItem) Entry {
+	var e Entry
+
+	link := pickText(it.Link)
+
+	var guid string
+	if it.GUID != nil {
+		guid = strings.TrimSpace(it.GUID.Value)
+		// guids are permalinks unless they explicitly say otherwise
+		if link == "" && guid != "" && it.GUID.IsPermaLink != "false" {
+			link = guid
+		}
+	}
+
+	switch {
+	case guid != "":
+		e.ID = scopedID(feedID, guid)
+	case it.About != "":
+		e.ID = it.About
+	default:
+		e.ID = link
+	}
+
+	e.Title = pickText(it.Title)
+	e.Verb = "http://activitystrea.ms/schema/1.0/post"
+	e.ObjectType = "http://activitystrea.ms/schema/1.0/note"
+	e.Published = parseRSSTime(it.PubDate, it.DCDate)
+	e.Updated = e.Published
+
+	if link != "" {
+		e.Link = append(e.Link, commonxml.Link{Rel: "alternate", Type: "text/html", Href: link})
+	}
+
+	for _, enc := range it.Enclosures {
+		if enc.URL == "" {
+			continue
+		}
+
+		e.Link = append(e.Link, commonxml.Link{Rel: "enclosure", Type: enc.Type, Href: enc.URL, Length: enc.Length})
+	}
+
+	if body := strings.TrimSpace(it.Encoded); body != "" {
+		e.Content = append(e.Content, Content{Type: "html", Body: body})
+	} else if body := pickText(it.Description); body != "" {
+		e.Content = append(e.Content, Content{Type: "html", Body: body})
+	}
+
+	return e
+}
+
+var rssTimeFormats = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
+func parseRSSTime(values ...string) time.Time {
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		for _, f := range rssTimeFormats {
+			if t, err := time.Parse(f, v); err == nil {
+				return t
+			}
+		}
+	}
+
+	return time.Time{}
+}
@@ -4,12 +4,12 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
-	"encoding/xml"
 	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httputil"
 	"sync"
 	"time"
 
@@ -22,6 +22,8 @@ import (
 	"github.com/timewasted/go-accept-headers"
 
 	"fknsrs.biz/p/don/activitystreams"
+	"fknsrs.biz/p/don/nodeinfo"
+	"fknsrs.biz/p/don/poller"
 	"fknsrs.biz/p/don/pubsub"
 	"fknsrs.biz/p/don/react"
 )
@@ -39,6 +41,17 @@ type App struct {
 
 	AccountURLCache *bcache.Cache
 	FeedCache       *bcache.Cache
+
+	Hub    *pubsub.Hub
+	PubSub *pubsub.Client
+	Poller *poller.Poller
+
+	nodeInfoUsage   *nodeinfo.Usage
+	nodeInfoUpdated time.Time
+	nodeInfoLock    sync.Mutex
+
+	backfillsRunning map[string]bool
+	backfillLock     sync.Mutex
 }
 
 func NewApp(sqlDB *sql.DB, boltDB *bolt.DB, store sessions.Store, renderer react.Renderer, template *template.Template, buildBox *rice.Box) (*App, error) {
@@ -75,8 +88,10 @@ func NewApp(sqlDB *sql.DB, boltDB *bolt.DB, store sessions.Store, renderer react
 		return nil, err
 	}
 
+	// the whole response is cached, not just the body, since hubs can be
+	// advertised in the headers
 	a.FeedCache = bcache.New(
-		"feed",
+		"feed_response",
 		bcache.SetDB(boltDB),
 		bcache.SetWorker(func(key string, _ interface{}) ([]byte, error) {
 			res, err := http.Get(key)
@@ -89,9 +104,9 @@ func NewApp(sqlDB *sql.DB, boltDB *bolt.DB, store sessions.Store, renderer react
 				return nil, errors.Errorf("feedFetch: invalid status code; expected 200 but got %d", res.StatusCode)
 			}
 
-			d, err := ioutil.ReadAll(res.Body)
+			d, err := httputil.DumpResponse(res, true)
 			if err != nil {
-				return nil, errors.Wrap(err, "feedFetch: couldn't make request")
+				return nil, errors.Wrap(err, "feedFetch: couldn't read response")
 			}
 
 			return d, nil
@@ -148,48 +163,63 @@ func (a *App) Emit(ev *ActivityEvent) error {
 }
 
 func (a *App) OnMessage(id string, s *pubsub.Subscription, rd io.ReadCloser) {
-	var f activitystreams.Feed
+	if s == nil {
+		logrus.WithField("id", id).Warn("pubsub: dropping message for unknown subscription")
+		return
+	}
 
-	if *recordDocuments {
-		d, err := ioutil.ReadAll(rd)
-		if err != nil {
-			logrus.WithField("id", id).WithError(err).Debug("pubsub: couldn't read message")
-			return
-		}
+	d, err := ioutil.ReadAll(rd)
+	if err != nil {
+		logrus.WithField("id", id).WithError(err).Debug("pubsub: couldn't read message")
+		return
+	}
 
-		if err := xml.NewDecoder(bytes.NewReader(d)).Decode(&f); err != nil {
-			logrus.WithField("id", id).WithError(err).Debug("pubsub: couldn't parse body")
-			return
-		}
+	f, err := activitystreams.ParseAny("", d)
+	if err != nil {
+		logrus.WithField("id", id).WithError(err).Debug("pubsub: couldn't parse body")
+		return
+	}
 
+	f.SetFetchedFrom(s.Topic)
+
+	if *recordDocuments {
 		if _, err := a.SQLDB.Exec("insert into pubsub_documents (created_at, xml) values ($1, $2)", time.Now(), string(d)); err != nil {
 			logrus.WithField("id", id).WithError(err).Debug("pubsub: couldn't save document")
 			return
 		}
-	} else {
-		if err := xml.NewDecoder(rd).Decode(&f); err != nil {
-			logrus.WithField("id", id).WithError(err).Debug("pubsub: couldn't parse body")
-			return
+	}
+
+	l := logrus.WithFields(logrus.Fields{
+		"id":    s.ID,
+		"hub":   s.Hub,
+		"topic": s.Topic,
+	})
+
+	for _, e := range f.Activities {
+		if err := a.saveActivity(&e); err != nil {
+			l.WithError(err).Debug("pubsub: couldn't save entry")
+		} else {
+			l.Debug("pubsub: saved entry")
 		}
 	}
+}
 
-	var l *logrus.Entry
+func (a *App) OnPoll(feedURL string, body []byte) {
+	l := logrus.WithField("url", feedURL)
 
-	if s == nil {
-		l = logrus.WithField("id", id)
-	} else {
-		l = logrus.WithFields(logrus.Fields{
-			"id":    s.ID,
-			"hub":   s.Hub,
-			"topic": s.Topic,
-		})
+	f, err := activitystreams.ParseAny("", body)
+	if err != nil {
+		l.WithError(err).Debug("poller: couldn't parse feed")
+		return
 	}
 
+	f.SetFetchedFrom(feedURL)
+
 	for _, e := range f.Activities {
 		if err := a.saveActivity(&e); err != nil {
-			l.WithError(err).Debug("pubsub: couldn't save entry")
+			l.WithError(err).Debug("poller: couldn't save entry")
 		} else {
-			l.Debug("pubsub: saved entry")
+			l.Debug("poller: saved entry")
 		}
 	}
 }
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"crypto/rsa"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/don/acct"
+	"fknsrs.biz/p/don/activitypub"
+	"fknsrs.biz/p/don/activitystreams"
+	"fknsrs.biz/p/don/commonxml"
+	"fknsrs.biz/p/don/httpsig"
+	"fknsrs.biz/p/don/webfinger"
+)
+
+var (
+	errActivityPubUnsupported    = errors.New("unsupported activity type")
+	errActivityPubActorMissing   = errors.New("activity doesn't have an actor")
+	errActivityPubActorMismatch  = errors.New("object doesn't belong to the activity's actor")
+	errActivityPubObjectMissing  = errors.New("activity doesn't have an object")
+	errActivityPubNoUsername     = errors.New("actor doesn't have a preferred username")
+	errActivityPubFollowNotLocal = errors.New("follow isn't for a local user")
+	errActivityPubKeyMismatch    = errors.New("key document doesn't belong to the actor that publishes it")
+)
+
+var activityPubContext = []interface{}{activitypub.Context, activitypub.SecurityContext}
+
+func makeUserActor(u *User, publicKeyPEM string) *activitypub.Actor {
+	actor := activitypub.Actor{
+		Object: activitypub.Object{
+			Context: activityPubContext,
+			ID:      userProfileURL(u.Username),
+			Type:    "Person",
+			Name:    u.Username,
+			URL:     activitypub.NewRef(userProfileURL(u.Username)),
+		},
+		PreferredUsername: u.Username,
+		Inbox:             userInboxURL(u.Username),
+		Outbox:            userOutboxURL(u.Username),
+		Endpoints:         &activitypub.Endpoints{SharedInbox: sharedInboxURL()},
+		PublicKey: &activitypub.PublicKey{
+			ID:           userKeyID(u.Username),
+			Owner:        userProfileURL(u.Username),
+			PublicKeyPem: publicKeyPEM,
+		},
+	}
+
+	if u.DisplayName != nil && *u.DisplayName != "" {
+		actor.Name = *u.DisplayName
+	}
+
+	if u.Avatar != nil && *u.Avatar != "" {
+		actor.Icon, _ = activitypub.Embed(map[string]string{"type": "Image", "url": *u.Avatar})
+	}
+
+	return &actor
+}
+
+func makeInstanceActor(publicKeyPEM string) *activitypub.Actor {
+	return &activitypub.Actor{
+		Object: activitypub.Object{
+			Context: activityPubContext,
+			ID:      instanceActorURL(),
+			Type:    "Application",
+			Name:    publicHost(),
+			URL:     activitypub.NewRef(*publicURL),
+		},
+		PreferredUsername: publicHost(),
+		Inbox:             sharedInboxURL(),
+		PublicKey: &activitypub.PublicKey{
+			ID:           instanceKeyID(),
+			Owner:        instanceActorURL(),
+			PublicKeyPem: publicKeyPEM,
+		},
+	}
+}
+
+// resolveActorKey fetches the actor that owns keyID and returns the key along
+// with the actor's id. The document has to be served from its own id, and
+// the key has to name it as the owner, otherwise anyone could publish a key
+// that claims to be someone else's.
+func resolveActorKey(keyID string) (*rsa.PublicKey, string, error) {
+	actorURL := strings.SplitN(keyID, "#", 2)[0]
+
+	actor, err := activitypub.FetchActor(actorURL)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "resolveActorKey")
+	}
+
+	if actor.PublicKey == nil || actor.PublicKey.ID != keyID {
+		return nil, "", errors.Errorf("resolveActorKey: actor %q doesn't publish key %q", actor.ID, keyID)
+	}
+
+	if actor.ID != actorURL || actor.PublicKey.Owner != actor.ID {
+		return nil, "", errors.Wrapf(errActivityPubKeyMismatch, "resolveActorKey: key %q is served by %q and owned by %q", keyID, actor.ID, actor.PublicKey.Owner)
+	}
+
+	k, err := httpsig.ParsePublicKeyPEM(actor.PublicKey.PublicKeyPem)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "resolveActorKey")
+	}
+
+	return k, actor.ID, nil
+}
+
+// verifyActivityPubRequest checks the http signature on r and returns the id
+// of the actor that signed it.
+func verifyActivityPubRequest(r *http.Request, body []byte) (string, error) {
+	var owner string
+
+	v := httpsig.NewVerifier(httpsig.KeyResolverFunc(func(keyID string) (*rsa.PublicKey, error) {
+		k, o, err := resolveActorKey(keyID)
+		owner = o
+		return k, err
+	}))
+
+	if _, err := v.Verify(r, body); err != nil {
+		return "", errors.Wrap(err, "verifyActivityPubRequest")
+	}
+
+	return owner, nil
+}
+
+func makeNote(u *User, activity *Activity) *activitypub.Object {
+	note := activitypub.Object{
+		ID:           activity.Permalink,
+		Type:         "Note",
+		URL:          activitypub.NewRef(activity.Permalink),
+		AttributedTo: activitypub.NewRef(userProfileURL(u.Username)),
+		Published:    &activity.Time,
+		To:           activitypub.IRIs{activitypub.Public},
+	}
+
+	if activity.Object.ObjectType != nil && strings.HasSuffix(*activity.Object.ObjectType, "/article") {
+		note.Type = "Article"
+	}
+	if activity.Object.Name != nil {
+		note.Name = *activity.Object.Name
+	}
+	if activity.Object.Summary != nil {
+		note.Summary = *activity.Object.Summary
+	}
+	if activity.Object.Content != nil {
+		note.Content = *activity.Object.Content
+	}
+
+	if activity.InReplyToURL != nil && *activity.InReplyToURL != "" {
+		note.InReplyTo = activitypub.NewRef(*activity.InReplyToURL)
+	} else if activity.InReplyToID != nil && *activity.InReplyToID != "" {
+		note.InReplyTo = activitypub.NewRef(*activity.InReplyToID)
+	}
+
+	return &note
+}
+
+func makeCreate(u *User, activity *Activity) (*activitypub.Activity, error) {
+	object, err := activitypub.Embed(makeNote(u, activity))
+	if err != nil {
+		return nil, errors.Wrap(err, "makeCreate")
+	}
+
+	return &activitypub.Activity{
+		ID:        activity.Permalink + "/activity",
+		Type:      "Create",
+		Actor:     activitypub.NewRef(userProfileURL(u.Username)),
+		Object:    object,
+		Published: &activity.Time,
+		To:        activitypub.IRIs{activitypub.Public},
+	}, nil
+}
+
+// deliverUserActivity sends a post to the inboxes of a user's ActivityPub
+// followers. Followers on the same server usually share an inbox, so each
+// inbox only gets one copy. Failed deliveries are logged and skipped.
+func (a *App) deliverUserActivity(u *User, activity *Activity) error {
+	create, err := makeCreate(u, activity)
+	if err != nil {
+		return errors.Wrap(err, "App.deliverUserActivity")
+	}
+	create.Context = activitypub.Context
+
+	rows, err := a.SQLDB.Query("select distinct inbox from followers where user_id = $1 and inbox != ''", u.ID)
+	if err != nil {
+		return errors.Wrap(err, "App.deliverUserActivity")
+	}
+	defer rows.Close()
+
+	var inboxes []string
+	for rows.Next() {
+		var inbox string
+		if err := rows.Scan(&inbox); err != nil {
+			return errors.Wrap(err, "App.deliverUserActivity")
+		}
+
+		inboxes = append(inboxes, inbox)
+	}
+	if len(inboxes) == 0 {
+		return nil
+	}
+
+	signer, err := a.getUserSigner(u)
+	if err != nil {
+		return errors.Wrap(err, "App.deliverUserActivity")
+	}
+
+	for _, inbox := range inboxes {
+		if err := activitypub.Post(inbox, create, signer); err != nil {
+			logrus.WithFields(logrus.Fields{"id": create.ID, "inbox": inbox}).WithError(err).Warn("activitypub: couldn't deliver activity")
+		}
+	}
+
+	return nil
+}
+
+// refURL finds the URL of an embedded object like an Image, or returns the
+// reference itself if it's a bare IRI.
+func refURL(r *activitypub.Ref) string {
+	if r == nil {
+		return ""
+	}
+
+	var v struct {
+		URL *activitypub.Ref `json:"url"`
+	}
+	if err := r.Decode(&v); err == nil && v.URL.GetID() != "" {
+		return v.URL.GetID()
+	}
+
+	return r.ID
+}
+
+func (a *App) saveActor(actor *activitypub.Actor) (*Person, error) {
+	if actor.PreferredUsername == "" {
+		return nil, errors.Wrap(errActivityPubNoUsername, "App.saveActor")
+	}
+
+	u, err := url.Parse(actor.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.saveActor")
+	}
+
+	permalink := actor.URL.GetID()
+	if permalink == "" {
+		permalink = actor.ID
+	}
+
+	person, err := a.storePerson(&acct.URL{User: actor.PreferredUsername, Host: u.Host}, permalink, personProtocolActivityPub, actor.Name, actor.Summary, refURL(actor.Icon))
+	if err != nil {
+		return nil, errors.Wrap(err, "App.saveActor")
+	}
+
+	return person, nil
+}
+
+// resolveObject returns the object a reference points at. Embedded objects
+// are only taken at their word when they come from the same host as the
+// actor that sent them; anything else is fetched from where its id says it
+// lives, so nobody can put words in someone else's mouth.
+func resolveObject(r *activitypub.Ref, actorID string) (*activitypub.Object, error) {
+	var o activitypub.Object
+
+	if sameHost(r.GetID(), actorID) {
+		if err := r.Decode(&o); err == nil {
+			return &o, nil
+		} else if errors.Cause(err) != activitypub.ErrNotEmbedded {
+			return nil, errors.Wrap(err, "resolveObject")
+		}
+	}
+
+	if err := activitypub.Fetch(r.GetID(), &o); err != nil {
+		return nil, errors.Wrap(err, "resolveObject")
+	}
+
+	if o.ID != r.GetID() {
+		return nil, errors.Errorf("resolveObject: fetched %q but got %q", r.GetID(), o.ID)
+	}
+
+	return &o, nil
+}
+
+// sameHost reports whether two urls are on the same host.
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || ua.Host == "" {
+		return false
+	}
+
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(ua.Host, ub.Host)
+}
+
+func (a *App) receiveActivity(act *activitypub.Activity) error {
+	if act.Actor.GetID() == "" {
+		return errors.Wrap(errActivityPubActorMissing, "App.receiveActivity")
+	}
+	if act.Object.GetID() == "" && act.Object.Type() == "" {
+		return errors.Wrap(errActivityPubObjectMissing, "App.receiveActivity")
+	}
+
+	actor, err := activitypub.FetchActor(act.Actor.GetID())
+	if err != nil {
+		return errors.Wrap(err, "App.receiveActivity: couldn't fetch actor")
+	}
+
+	person, err := a.saveActor(actor)
+	if err != nil {
+		return errors.Wrap(err, "App.receiveActivity")
+	}
+
+	switch act.Type {
+	case "Create":
+		err = a.receiveCreate(act, person)
+	case "Like":
+		err = a.receiveLike(act, person)
+	case "Announce":
+		err = a.receiveReaction(act, person)
+	case "Update":
+		err = a.receiveUpdate(act, actor, person)
+	case "Delete":
+		err = a.receiveDelete(act, person)
+	case "Follow":
+		err = a.receiveFollow(act, actor, person)
+	case "Undo":
+		err = a.receiveUndo(act, person)
+	case "Accept", "Reject":
+		err = a.receiveFollowResponse(act, person)
+	default:
+		err = errActivityPubUnsupported
+	}
+
+	return errors.Wrap(err, "App.receiveActivity")
+}
+
+func (a *App) receiveCreate(act *activitypub.Activity, person *Person) error {
+	o, err := resolveObject(act.Object, act.Actor.GetID())
+	if err != nil {
+		return errors.Wrap(err, "App.receiveCreate")
+	}
+
+	if id := o.AttributedTo.GetID(); id != "" && id != act.Actor.GetID() {
+		return errors.Wrap(errActivityPubActorMismatch, "App.receiveCreate")
+	}
+
+	if _, err := a.storeActivity(activitystreams.ObjectEntry(o), person); err != nil {
+		return errors.Wrap(err, "App.receiveCreate")
+	}
+
+	return nil
+}
+
+// receiveLike records a favourite. These don't go on the timeline, since
+// they don't add anything to read.
+func (a *App) receiveLike(act *activitypub.Activity, person *Person) error {
+	t := time.Now()
+	if act.Published != nil {
+		t = *act.Published
+	}
+
+	if err := a.storeLike(person, act.Object.GetID(), act.ID, t); err != nil {
+		return errors.Wrap(err, "App.receiveLike")
+	}
+
+	return nil
+}
+
+func (a *App) receiveReaction(act *activitypub.Activity, person *Person) error {
+	var e activitystreams.Entry
+
+	e.ID = act.ID
+	e.ObjectType = "http://activitystrea.ms/schema/1.0/activity"
+	e.Link = []commonxml.Link{{Rel: "alternate", Type: "text/html", Href: act.ID}}
+
+	e.Verb = "http://activitystrea.ms/schema/1.0/share"
+	e.Title = person.ID + " shared " + act.Object.GetID()
+
+	if act.Published != nil {
+		e.Published = *act.Published
+	} else {
+		e.Published = time.Now()
+	}
+	e.Updated = e.Published
+
+	// a placeholder would stop the real object from being saved later, so
+	// shares of things we can't see are dropped
+	o, err := resolveObject(act.Object, act.Actor.GetID())
+	if err != nil {
+		return errors.Wrap(err, "App.receiveReaction")
+	}
+	e.Object = activitystreams.ObjectEntry(o)
+
+	if _, err := a.storeActivity(&e, person); err != nil {
+		return errors.Wrap(err, "App.receiveReaction")
+	}
+
+	return nil
+}
+
+func (a *App) receiveUpdate(act *activitypub.Activity, actor *activitypub.Actor, person *Person) error {
+	if act.Object.GetID() == actor.ID {
+		// the actor was fetched fresh in receiveActivity, so the person record
+		// is already up to date
+		return nil
+	}
+
+	var o activitypub.Object
+	if err := act.Object.Decode(&o); err != nil {
+		return errors.Wrap(err, "App.receiveUpdate")
+	}
+
+	if o.AttributedTo.GetID() != act.Actor.GetID() {
+		return errors.Wrap(errActivityPubActorMismatch, "App.receiveUpdate")
+	}
+
+	if err := a.reviseObject(activitystreams.ObjectEntry(&o), person); err != nil {
+		return errors.Wrap(err, "App.receiveUpdate")
+	}
+
+	return nil
+}
+
+// receiveDelete tombstones the deleted object, the same as an OStatus delete
+// would. Some servers send the id of the Create rather than the object, so
+// that's looked up first.
+func (a *App) receiveDelete(act *activitypub.Activity, person *Person) error {
+	id := act.Object.GetID()
+
+	if id == act.Actor.GetID() {
+		logrus.WithField("actor", id).Info("activitypub: ignoring actor deletion")
+		return nil
+	}
+
+	var objectID string
+	if err := a.SQLDB.QueryRow("select object from activities where id = $1 and object != id", id).Scan(&objectID); err == nil {
+		id = objectID
+	} else if err != sql.ErrNoRows {
+		return errors.Wrap(err, "App.receiveDelete")
+	}
+
+	if err := a.tombstoneObject(id, person); err != nil {
+		return errors.Wrap(err, "App.receiveDelete")
+	}
+
+	return nil
+}
+
+func (a *App) localUserForURL(s string) (*User, error) {
+	if !strings.HasPrefix(s, userProfileURL("")) {
+		return nil, nil
+	}
+
+	u, err := a.getUserByUsername(strings.TrimPrefix(s, userProfileURL("")))
+	if err != nil {
+		return nil, errors.Wrap(err, "App.localUserForURL")
+	}
+
+	return u, nil
+}
+
+func (a *App) receiveFollow(act *activitypub.Activity, actor *activitypub.Actor, person *Person) error {
+	u, err := a.localUserForURL(act.Object.GetID())
+	if err != nil {
+		return errors.Wrap(err, "App.receiveFollow")
+	}
+	if u == nil {
+		return errors.Wrap(errActivityPubFollowNotLocal, "App.receiveFollow")
+	}
+
+	if _, err := a.SQLDB.Exec("delete from followers where user_id = $1 and person_id = $2", u.ID, person.ID); err != nil {
+		return errors.Wrap(err, "App.receiveFollow")
+	}
+
+	if _, err := a.SQLDB.Exec("insert into followers (user_id, person_id, created_at, follow_id, inbox) values ($1, $2, $3, $4, $5)", u.ID, person.ID, time.Now(), act.ID, actor.GetInbox()); err != nil {
+		return errors.Wrap(err, "App.receiveFollow")
+	}
+
+	object, err := activitypub.Embed(act)
+	if err != nil {
+		return errors.Wrap(err, "App.receiveFollow")
+	}
+
+	accept := activitypub.Activity{
+		Context: activitypub.Context,
+		ID:      userProfileURL(u.Username) + "#accepts/follows/" + uuid.NewV4().String(),
+		Type:    "Accept",
+		Actor:   activitypub.NewRef(userProfileURL(u.Username)),
+		Object:  object,
+	}
+
+	signer, err := a.getUserSigner(u)
+	if err != nil {
+		return errors.Wrap(err, "App.receiveFollow")
+	}
+
+	go func() {
+		if err := activitypub.Post(actor.Inbox, &accept, signer); err != nil {
+			logrus.WithField("inbox", actor.Inbox).WithError(err).Warn("activitypub: couldn't deliver accept")
+		}
+	}()
+
+	return nil
+}
+
+func (a *App) receiveUndo(act *activitypub.Activity, person *Person) error {
+	id := act.Object.GetID()
+
+	var inner activitypub.Activity
+	if err := act.Object.Decode(&inner); err == nil {
+		if inner.Actor.GetID() != "" && inner.Actor.GetID() != act.Actor.GetID() {
+			return errors.Wrap(errActivityPubActorMismatch, "App.receiveUndo")
+		}
+
+		if inner.Type == "Follow" {
+			u, err := a.localUserForURL(inner.Object.GetID())
+			if err != nil {
+				return errors.Wrap(err, "App.receiveUndo")
+			}
+
+			if u != nil {
+				if _, err := a.SQLDB.Exec("delete from followers where user_id = $1 and person_id = $2", u.ID, person.ID); err != nil {
+					return errors.Wrap(err, "App.receiveUndo")
+				}
+
+				return nil
+			}
+		}
+	}
+
+	if _, err := a.SQLDB.Exec("delete from followers where follow_id = $1 and person_id = $2", id, person.ID); err != nil {
+		return errors.Wrap(err, "App.receiveUndo")
+	}
+
+	if _, err := a.SQLDB.Exec("delete from likes where activity_id = $1 and person_id = $2", id, person.ID); err != nil {
+		return errors.Wrap(err, "App.receiveUndo")
+	}
+
+	if _, err := a.SQLDB.Exec("delete from activities where id = $1 and actor = $2", id, person.ID); err != nil {
+		return errors.Wrap(err, "App.receiveUndo")
+	}
+
+	return nil
+}
+
+// receiveFollowResponse handles a remote actor accepting or rejecting one of
+// our follows. Accepts don't need anything doing, since the follow was
+// recorded when it was sent.
+func (a *App) receiveFollowResponse(act *activitypub.Activity, person *Person) error {
+	id := act.Object.GetID()
+
+	var inner activitypub.Activity
+	if err := act.Object.Decode(&inner); err == nil && inner.Type != "Follow" {
+		return errors.Wrap(errActivityPubUnsupported, "App.receiveFollowResponse")
+	}
+
+	if act.Type == "Accept" {
+		logrus.WithFields(logrus.Fields{"person": person.ID, "follow": id}).Info("activitypub: follow accepted")
+		return nil
+	}
+
+	if _, err := a.SQLDB.Exec("delete from follows where follow_id = $1 and person_id = $2", id, person.ID); err != nil {
+		return errors.Wrap(err, "App.receiveFollowResponse")
+	}
+
+	logrus.WithFields(logrus.Fields{"person": person.ID, "follow": id}).Info("activitypub: follow rejected")
+
+	return nil
+}
+
+// findActivityPubActor returns the actor url from a webfinger response, if
+// there is one.
+func findActivityPubActor(wf *webfinger.Response) string {
+	for _, l := range wf.Links {
+		if l.Rel == "self" && l.Href != "" && (l.Type == activitypub.MimeType || strings.HasPrefix(l.Type, "application/ld+json")) {
+			return l.Href
+		}
+	}
+
+	return ""
+}
+
+// backfillOutbox saves the first page of an actor's outbox so there's
+// something to look at before they post again.
+func (a *App) backfillOutbox(actor *activitypub.Actor, person *Person) error {
+	if actor.Outbox == "" {
+		return nil
+	}
+
+	if _, err := a.backfillOutboxPage(actor, person, actor.Outbox, time.Time{}); err != nil {
+		return errors.Wrap(err, "App.backfillOutbox")
+	}
+
+	return nil
+}
+
+// backfillOutboxPage saves one page of an actor's outbox. If pageURL points
+// at the outbox itself, its first page is used instead.
+func (a *App) backfillOutboxPage(actor *activitypub.Actor, person *Person, pageURL string, cutoff time.Time) (*backfillPage, error) {
+	var page activitypub.Collection
+	if err := activitypub.Fetch(pageURL, &page); err != nil {
+		return nil, errors.Wrap(err, "App.backfillOutboxPage")
+	}
+
+	if page.First != nil {
+		first := page.First
+		page = activitypub.Collection{}
+
+		if err := first.Decode(&page); err != nil {
+			if err := activitypub.Fetch(first.GetID(), &page); err != nil {
+				return nil, errors.Wrap(err, "App.backfillOutboxPage")
+			}
+		}
+	}
+
+	p := backfillPage{Next: page.Next, Count: len(page.OrderedItems)}
+
+	for _, item := range page.OrderedItems {
+		var act activitypub.Activity
+		if err := item.Decode(&act); err != nil {
+			if err := activitypub.Fetch(item.GetID(), &act); err != nil {
+				logrus.WithField("id", item.GetID()).WithError(err).Debug("activitypub: couldn't fetch outbox item")
+				continue
+			}
+		}
+
+		if act.Actor.GetID() != actor.ID {
+			continue
+		}
+
+		if act.Published != nil && act.Published.Before(cutoff) {
+			p.TooOld = true
+			continue
+		}
+
+		var err error
+		switch act.Type {
+		case "Create":
+			err = a.receiveCreate(&act, person)
+		case "Announce":
+			err = a.receiveReaction(&act, person)
+		default:
+			continue
+		}
+
+		if err != nil {
+			logrus.WithField("id", act.ID).WithError(err).Debug("activitypub: couldn't save outbox item")
+			continue
+		}
+
+		p.Saved++
+
+		if act.Published != nil && (p.Oldest == nil || act.Published.Before(*p.Oldest)) {
+			published := *act.Published
+			p.Oldest = &published
+		}
+	}
+
+	return &p, nil
+}
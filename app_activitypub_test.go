@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/don/activitypub"
+)
+
+func TestReceiveUpdateAndDelete(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	person := &Person{ID: "acct:alice@social.example.com"}
+
+	makeActivity := func(typ string, o *activitypub.Object) *activitypub.Activity {
+		r, err := activitypub.Embed(o)
+		assert.NoError(t, err)
+
+		return &activitypub.Activity{
+			ID:     o.ID + "/" + typ,
+			Type:   typ,
+			Actor:  activitypub.NewRef("https://social.example.com/users/alice"),
+			Object: r,
+		}
+	}
+
+	note := &activitypub.Object{
+		ID:           "https://social.example.com/users/alice/statuses/1",
+		Type:         "Note",
+		Content:      "<p>first</p>",
+		AttributedTo: activitypub.NewRef("https://social.example.com/users/alice"),
+	}
+
+	assert.NoError(t, a.receiveCreate(makeActivity("Create", note), person))
+
+	edited := *note
+	edited.Content = "<p>second</p>"
+	assert.NoError(t, a.receiveUpdate(makeActivity("Update", &edited), &activitypub.Actor{}, person))
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	assert.Len(t, activities, 1)
+	assert.Equal(t, "<p>second</p>", *activities[0].Object.Content)
+
+	assert.NoError(t, a.receiveDelete(makeActivity("Delete", &activitypub.Object{ID: note.ID, Type: "Tombstone"}), person))
+
+	// a late copy of the create doesn't bring it back
+	assert.NoError(t, a.receiveCreate(makeActivity("Create", note), person))
+
+	activities, err = a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	assert.Len(t, activities, 0)
+}
+
+func TestReceiveForeignObjects(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	var victim *httptest.Server
+	victim = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("content-type", activitypub.MimeType)
+		json.NewEncoder(rw).Encode(&activitypub.Object{
+			ID:           victim.URL + r.URL.Path,
+			Type:         "Note",
+			Content:      "<p>the real thing</p>",
+			AttributedTo: activitypub.NewRef(victim.URL + "/users/victim"),
+		})
+	}))
+	defer victim.Close()
+
+	const mallory = "https://evil.example.com/users/mallory"
+	person := &Person{ID: "acct:mallory@evil.example.com"}
+
+	forged := func(id string) *activitypub.Ref {
+		r, err := activitypub.Embed(&activitypub.Object{
+			ID:           id,
+			Type:         "Note",
+			Content:      "<p>forged</p>",
+			AttributedTo: activitypub.NewRef(victim.URL + "/users/victim"),
+		})
+		assert.NoError(t, err)
+
+		return r
+	}
+
+	// a share that embeds someone else's note gets the note from its owner
+	assert.NoError(t, a.receiveReaction(&activitypub.Activity{
+		ID:     mallory + "/shares/1",
+		Type:   "Announce",
+		Actor:  activitypub.NewRef(mallory),
+		Object: forged(victim.URL + "/notes/1"),
+	}, person))
+
+	var content string
+	assert.NoError(t, a.SQLDB.QueryRow("select content from objects where id = $1", victim.URL+"/notes/1").Scan(&content))
+	assert.Equal(t, "<p>the real thing</p>", content)
+
+	// a create can't claim an id on another host
+	assert.Error(t, a.receiveCreate(&activitypub.Activity{
+		ID:     mallory + "/creates/1",
+		Type:   "Create",
+		Actor:  activitypub.NewRef(mallory),
+		Object: forged(victim.URL + "/notes/2"),
+	}, person))
+
+	var count int
+	assert.NoError(t, a.SQLDB.QueryRow("select count(1) from objects where id = $1", victim.URL+"/notes/2").Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func TestDeliverUserActivity(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	var m sync.Mutex
+	received := make(map[string][]activitypub.Activity)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.NotEqual(t, "", r.Header.Get("signature"))
+
+		var act activitypub.Activity
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&act))
+
+		m.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], act)
+		m.Unlock()
+
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	_, err := a.SQLDB.Exec("insert into users (id, created_at, username, email, hash) values ('u1', $1, 'bob', 'bob@example.com', '')", time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, rotateUserKey(a.SQLDB, "bob"))
+
+	for i, e := range []struct{ person, inbox string }{
+		{"acct:alice@social.example.com", srv.URL + "/inbox"},
+		{"acct:carol@social.example.com", srv.URL + "/inbox"},
+		{"acct:dave@other.example.com", srv.URL + "/users/dave/inbox"},
+	} {
+		_, err := a.SQLDB.Exec("insert into people (id, host, first_seen, permalink, protocol) values ($1, 'example.com', $2, $1, $3)", e.person, time.Now(), personProtocolActivityPub)
+		assert.NoError(t, err)
+		_, err = a.SQLDB.Exec("insert into followers (user_id, person_id, created_at, follow_id, inbox) values ('u1', $1, $2, $3, $4)", e.person, time.Now(), fmt.Sprintf("follow-%d", i), e.inbox)
+		assert.NoError(t, err)
+	}
+
+	u, err := a.getUserByUsername("bob")
+	assert.NoError(t, err)
+
+	activity, err := a.userPostStatus(u, "hello followers", "")
+	assert.NoError(t, err)
+
+	// delivery happens in the background
+	for i := 0; i < 100; i++ {
+		m.Lock()
+		n := len(received["/inbox"]) + len(received["/users/dave/inbox"])
+		m.Unlock()
+
+		if n >= 2 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	// the shared inbox only gets one copy
+	assert.Len(t, received["/inbox"], 1)
+	assert.Len(t, received["/users/dave/inbox"], 1)
+
+	for _, l := range received {
+		for _, act := range l {
+			assert.Equal(t, "Create", act.Type)
+			assert.Equal(t, userProfileURL("bob"), act.Actor.GetID())
+			assert.Equal(t, activity.Permalink, act.Object.GetID())
+		}
+	}
+}
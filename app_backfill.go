@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/activitystreams"
+)
+
+var (
+	errBackfillRunning = errors.New("a backfill is already running for that account")
+)
+
+type Backfill struct {
+	PersonID   string     `json:"personId"`
+	FeedURL    string     `json:"feedURL"`
+	NextURL    string     `json:"nextURL,omitempty"`
+	Pages      int        `json:"pages"`
+	Entries    int        `json:"entries"`
+	Oldest     *time.Time `json:"oldest,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+}
+
+func (a *App) getBackfill(personID string) (*Backfill, error) {
+	var b Backfill
+	if err := a.SQLDB.QueryRow("select person_id, feed_url, next_url, pages, entries, oldest, created_at, updated_at, finished_at, last_error from backfills where person_id = $1", personID).Scan(&b.PersonID, &b.FeedURL, &b.NextURL, &b.Pages, &b.Entries, &b.Oldest, &b.CreatedAt, &b.UpdatedAt, &b.FinishedAt, &b.LastError); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "App.getBackfill")
+	}
+
+	return &b, nil
+}
+
+func (a *App) saveBackfill(b *Backfill) error {
+	res, err := a.SQLDB.Exec("update backfills set feed_url = $1, next_url = $2, pages = $3, entries = $4, oldest = $5, updated_at = $6, finished_at = $7, last_error = $8 where person_id = $9", b.FeedURL, b.NextURL, b.Pages, b.Entries, b.Oldest, b.UpdatedAt, b.FinishedAt, b.LastError, b.PersonID)
+	if err != nil {
+		return errors.Wrap(err, "App.saveBackfill: couldn't update backfill")
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrap(err, "App.saveBackfill: couldn't count updated rows")
+	} else if n > 0 {
+		return nil
+	}
+
+	if _, err := a.SQLDB.Exec("insert into backfills (person_id, feed_url, next_url, pages, entries, oldest, created_at, updated_at, finished_at, last_error) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)", b.PersonID, b.FeedURL, b.NextURL, b.Pages, b.Entries, b.Oldest, b.CreatedAt, b.UpdatedAt, b.FinishedAt, b.LastError); err != nil {
+		return errors.Wrap(err, "App.saveBackfill: couldn't insert backfill")
+	}
+
+	return nil
+}
+
+// startBackfill runs a backfill in the background, refusing to start a
+// second one for the same person.
+func (a *App) startBackfill(personID, feedURL string, fetchPage backfillPageFunc) error {
+	a.backfillLock.Lock()
+	defer a.backfillLock.Unlock()
+
+	if a.backfillsRunning == nil {
+		a.backfillsRunning = make(map[string]bool)
+	}
+
+	if a.backfillsRunning[personID] {
+		return errors.Wrap(errBackfillRunning, "App.startBackfill")
+	}
+
+	a.backfillsRunning[personID] = true
+
+	go func() {
+		defer func() {
+			a.backfillLock.Lock()
+			delete(a.backfillsRunning, personID)
+			a.backfillLock.Unlock()
+		}()
+
+		if err := a.backfill(personID, feedURL, fetchPage); err != nil {
+			logrus.WithFields(logrus.Fields{"person": personID, "url": feedURL}).WithError(err).Warn("backfill: couldn't backfill feed")
+		}
+	}()
+
+	return nil
+}
+
+// backfillPage is what a backfillPageFunc found on one page of history.
+type backfillPage struct {
+	Next   string
+	Count  int
+	Saved  int
+	Oldest *time.Time
+	TooOld bool
+}
+
+// backfillPageFunc fetches and saves a single page of the history that
+// starts at feedURL, skipping anything published before cutoff.
+type backfillPageFunc func(feedURL, pageURL string, cutoff time.Time) (*backfillPage, error)
+
+// backfill walks the pages of an account's history starting at feedURL,
+// saving entries as it goes. It stops after backfillMaxPages pages or once
+// it reaches entries older than backfillMaxAge, recording where it got to
+// so that the next run carries on from there.
+func (a *App) backfill(personID, feedURL string, fetchPage backfillPageFunc) error {
+	b, err := a.getBackfill(personID)
+	if err != nil {
+		return errors.Wrap(err, "App.backfill")
+	}
+
+	if b == nil || b.FeedURL != feedURL {
+		now := time.Now()
+		b = &Backfill{PersonID: personID, FeedURL: feedURL, NextURL: feedURL, CreatedAt: now, UpdatedAt: now}
+	}
+
+	if b.FinishedAt != nil {
+		return nil
+	}
+
+	cutoff := time.Now().Add(-*backfillMaxAge)
+
+	l := logrus.WithFields(logrus.Fields{"person": personID, "url": feedURL})
+
+	for i := 0; i < *backfillMaxPages && b.NextURL != ""; i++ {
+		pageURL := b.NextURL
+
+		p, err := fetchPage(feedURL, pageURL, cutoff)
+		if err != nil {
+			b.LastError = err.Error()
+			break
+		}
+
+		b.LastError = ""
+		b.Pages++
+		b.Entries += p.Saved
+		b.NextURL = ""
+
+		if p.Oldest != nil && (b.Oldest == nil || p.Oldest.Before(*b.Oldest)) {
+			b.Oldest = p.Oldest
+		}
+
+		if p.Next != "" && p.Next != pageURL && !p.TooOld && p.Count > 0 {
+			b.NextURL = p.Next
+		}
+
+		l.WithFields(logrus.Fields{"page": pageURL, "next": b.NextURL, "count": p.Count}).Debug("backfill: saved page")
+	}
+
+	b.UpdatedAt = time.Now()
+	if b.NextURL == "" && b.LastError == "" {
+		b.FinishedAt = &b.UpdatedAt
+	}
+
+	if err := a.saveBackfill(b); err != nil {
+		return errors.Wrap(err, "App.backfill")
+	}
+
+	if b.LastError != "" {
+		return errors.Errorf("App.backfill: %s", b.LastError)
+	}
+
+	return nil
+}
+
+// backfillFeedPage saves one page of an OStatus or web feed, following
+// its rel=next link.
+func (a *App) backfillFeedPage(feedURL, pageURL string, cutoff time.Time) (*backfillPage, error) {
+	h, d, err := a.getFeed(pageURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.backfillFeedPage")
+	}
+
+	feed, err := activitystreams.ParseAny(h.Get("content-type"), d)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.backfillFeedPage")
+	}
+
+	// every page belongs to the same feed, so made up authors are keyed
+	// by where the backfill started
+	feed.SetFetchedFrom(feedURL)
+
+	p := backfillPage{Count: len(feed.Activities)}
+
+	for _, e := range feed.Activities {
+		if !e.Published.IsZero() && e.Published.Before(cutoff) {
+			p.TooOld = true
+			continue
+		}
+
+		if err := a.saveActivity(&e); err != nil {
+			logrus.WithFields(logrus.Fields{"page": pageURL, "id": e.ID}).WithError(err).Debug("backfill: couldn't save entry")
+			continue
+		}
+
+		p.Saved++
+
+		if !e.Published.IsZero() && (p.Oldest == nil || e.Published.Before(*p.Oldest)) {
+			published := e.Published
+			p.Oldest = &published
+		}
+	}
+
+	if next := feed.GetLink("next"); next != nil {
+		p.Next = next.Href
+	}
+
+	return &p, nil
+}
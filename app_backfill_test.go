@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/don/activitypub"
+)
+
+// backfillServer serves a chain of pages, each linking to the next, and
+// counts how often each one is asked for.
+type backfillServer struct {
+	*httptest.Server
+
+	m    sync.Mutex
+	hits map[string]int
+}
+
+func newBackfillServer(contentType string, render func(base string, page int, next string) string, pages int) *backfillServer {
+	s := backfillServer{hits: make(map[string]int)}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var page int
+		if _, err := fmt.Sscanf(r.URL.Path, "/page/%d", &page); err != nil || page < 1 || page > pages {
+			http.NotFound(rw, r)
+			return
+		}
+
+		s.m.Lock()
+		s.hits[r.URL.Path]++
+		s.m.Unlock()
+
+		var next string
+		if page < pages {
+			next = fmt.Sprintf("%s/page/%d", s.URL, page+1)
+		}
+
+		rw.Header().Set("content-type", contentType)
+		rw.Write([]byte(render(s.URL, page, next)))
+	}))
+
+	return &s
+}
+
+func (s *backfillServer) pageURL(page int) string {
+	return fmt.Sprintf("%s/page/%d", s.URL, page)
+}
+
+func (s *backfillServer) hitCount(page int) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.hits[fmt.Sprintf("/page/%d", page)]
+}
+
+func withBackfillLimits(pages int, age time.Duration) func() {
+	oldPages, oldAge := *backfillMaxPages, *backfillMaxAge
+	*backfillMaxPages, *backfillMaxAge = pages, age
+
+	return func() {
+		*backfillMaxPages, *backfillMaxAge = oldPages, oldAge
+	}
+}
+
+// rssPage renders a page with a single item, published page days ago.
+func rssPage(base string, page int, next string) string {
+	var nextLink string
+	if next != "" {
+		nextLink = fmt.Sprintf(`<atom:link rel="next" href="%s"/>`, next)
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <title>A Blog</title>
+    <link>%[1]s/</link>
+    %[2]s
+    <item>
+      <title>Post %[3]d</title>
+      <link>%[1]s/posts/%[3]d</link>
+      <guid>%[1]s/posts/%[3]d</guid>
+      <description>Post number %[3]d</description>
+      <pubDate>%[4]s</pubDate>
+    </item>
+  </channel>
+</rss>`, base, nextLink, page, time.Now().Add(-time.Duration(page)*24*time.Hour).Format(time.RFC1123Z))
+}
+
+func TestBackfillFeedResumes(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	defer withBackfillLimits(2, 30*24*time.Hour)()
+
+	s := newBackfillServer("application/rss+xml", rssPage, 3)
+	defer s.Close()
+
+	assert.NoError(t, a.backfill("acct:blog@blog.example.com", s.pageURL(1), a.backfillFeedPage))
+
+	b, err := a.getBackfill("acct:blog@blog.example.com")
+	assert.NoError(t, err)
+	if assert.NotNil(t, b) {
+		assert.Equal(t, 2, b.Pages)
+		assert.Equal(t, 2, b.Entries)
+		assert.Equal(t, s.pageURL(3), b.NextURL)
+		assert.Nil(t, b.FinishedAt)
+		assert.Equal(t, "", b.LastError)
+	}
+
+	assert.Equal(t, 0, s.hitCount(3))
+
+	// the second run picks up where the first one stopped
+	assert.NoError(t, a.backfill("acct:blog@blog.example.com", s.pageURL(1), a.backfillFeedPage))
+
+	b, err = a.getBackfill("acct:blog@blog.example.com")
+	assert.NoError(t, err)
+	if assert.NotNil(t, b) {
+		assert.Equal(t, 3, b.Pages)
+		assert.Equal(t, 3, b.Entries)
+		assert.Equal(t, "", b.NextURL)
+		assert.NotNil(t, b.FinishedAt)
+		if assert.NotNil(t, b.Oldest) {
+			assert.True(t, b.Oldest.Before(time.Now().Add(-48*time.Hour)))
+		}
+	}
+
+	assert.Equal(t, 1, s.hitCount(1))
+	assert.Equal(t, 1, s.hitCount(3))
+
+	// a finished backfill doesn't fetch anything else
+	assert.NoError(t, a.backfill("acct:blog@blog.example.com", s.pageURL(1), a.backfillFeedPage))
+	assert.Equal(t, 1, s.hitCount(1))
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	assert.Len(t, activities, 3)
+}
+
+func TestBackfillFeedMaxAge(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	// page two is two days old, so the backfill stops there
+	defer withBackfillLimits(10, 36*time.Hour)()
+
+	s := newBackfillServer("application/rss+xml", rssPage, 3)
+	defer s.Close()
+
+	assert.NoError(t, a.backfill("acct:blog@blog.example.com", s.pageURL(1), a.backfillFeedPage))
+
+	b, err := a.getBackfill("acct:blog@blog.example.com")
+	assert.NoError(t, err)
+	if assert.NotNil(t, b) {
+		assert.Equal(t, 2, b.Pages)
+		assert.Equal(t, 1, b.Entries)
+		assert.Equal(t, "", b.NextURL)
+		assert.NotNil(t, b.FinishedAt)
+	}
+
+	assert.Equal(t, 0, s.hitCount(3))
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	assert.Len(t, activities, 1)
+}
+
+func TestBackfillFeedError(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	defer withBackfillLimits(10, 30*24*time.Hour)()
+
+	// page two links to a page three that doesn't exist
+	s := newBackfillServer("application/rss+xml", func(base string, page int, next string) string {
+		if next == "" {
+			next = fmt.Sprintf("%s/page/%d", base, page+1)
+		}
+
+		return rssPage(base, page, next)
+	}, 2)
+	defer s.Close()
+
+	assert.Error(t, a.backfill("acct:blog@blog.example.com", s.pageURL(1), a.backfillFeedPage))
+
+	b, err := a.getBackfill("acct:blog@blog.example.com")
+	assert.NoError(t, err)
+	if assert.NotNil(t, b) {
+		assert.Equal(t, 2, b.Pages)
+		assert.Equal(t, s.pageURL(3), b.NextURL)
+		assert.Nil(t, b.FinishedAt)
+		assert.True(t, strings.Contains(b.LastError, "404"))
+	}
+}
+
+func TestBackfillOutbox(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	defer withBackfillLimits(10, 30*24*time.Hour)()
+
+	var actorID string
+
+	s := newBackfillServer(activitypub.MimeType, func(base string, page int, next string) string {
+		published := time.Now().Add(-time.Duration(page) * time.Hour)
+
+		note, err := activitypub.Embed(&activitypub.Object{
+			ID:           fmt.Sprintf("%s/notes/%d", base, page),
+			Type:         "Note",
+			Content:      fmt.Sprintf("<p>note %d</p>", page),
+			AttributedTo: activitypub.NewRef(actorID),
+			Published:    &published,
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		create, err := activitypub.Embed(&activitypub.Activity{
+			ID:        fmt.Sprintf("%s/notes/%d/activity", base, page),
+			Type:      "Create",
+			Actor:     activitypub.NewRef(actorID),
+			Object:    note,
+			Published: &published,
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		d, err := json.Marshal(&activitypub.Collection{
+			ID:           fmt.Sprintf("%s/page/%d", base, page),
+			Type:         "OrderedCollectionPage",
+			Next:         next,
+			OrderedItems: []activitypub.Ref{*create},
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		return string(d)
+	}, 3)
+	defer s.Close()
+
+	actorID = s.URL + "/actor"
+
+	actor := &activitypub.Actor{Object: activitypub.Object{ID: actorID}, Outbox: s.pageURL(1)}
+	person := &Person{ID: "acct:alice@social.example.com"}
+
+	assert.NoError(t, a.backfill(person.ID, actor.Outbox, func(_, pageURL string, cutoff time.Time) (*backfillPage, error) {
+		return a.backfillOutboxPage(actor, person, pageURL, cutoff)
+	}))
+
+	b, err := a.getBackfill(person.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, b) {
+		assert.Equal(t, 3, b.Pages)
+		assert.Equal(t, 3, b.Entries)
+		assert.NotNil(t, b.FinishedAt)
+	}
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	assert.Len(t, activities, 3)
+}
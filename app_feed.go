@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/activitystreams"
+	"fknsrs.biz/p/don/commonxml"
+)
+
+// getFeed fetches a document through FeedCache, returning the response
+// headers along with the body.
+func (a *App) getFeed(u string) (http.Header, []byte, error) {
+	d, _, err := a.FeedCache.Get(u, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "App.getFeed")
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(d)), nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "App.getFeed")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "App.getFeed")
+	}
+
+	return res.Header, body, nil
+}
+
+func makeUserAuthor(u *User) *activitystreams.Author {
+	author := activitystreams.Author{
+		ObjectType:        "http://activitystrea.ms/schema/1.0/person",
+		ID:                userProfileURL(u.Username),
+		URI:               userProfileURL(u.Username),
+		Name:              u.Username,
+		PreferredUsername: u.Username,
+	}
+
+	if u.DisplayName != nil {
+		author.DisplayName = *u.DisplayName
+	}
+
+	author.Link = append(author.Link, commonxml.Link{Rel: "alternate", Type: "text/html", Href: userProfileURL(u.Username)})
+
+	if u.Avatar != nil && *u.Avatar != "" {
+		author.Link = append(author.Link, commonxml.Link{Rel: "avatar", Href: *u.Avatar})
+	}
+
+	return &author
+}
+
+func makeEntry(activity *Activity) activitystreams.Entry {
+	var e activitystreams.Entry
+
+	e.ID = activity.ID
+	e.Title = activity.Title
+	e.Verb = activity.Verb
+	e.Published = activity.Time
+	e.Updated = activity.Time
+
+	if activity.Permalink != "" {
+		e.Link = append(e.Link, commonxml.Link{Rel: "alternate", Type: "text/html", Href: activity.Permalink})
+	}
+
+	if activity.InReplyToID != nil {
+		e.InReplyTo = &activitystreams.InReplyTo{Ref: *activity.InReplyToID}
+
+		if activity.InReplyToURL != nil {
+			e.InReplyTo.Href = *activity.InReplyToURL
+		}
+	}
+
+	var content []activitystreams.Content
+	if activity.Object.Content != nil {
+		content = []activitystreams.Content{{Type: "html", Body: *activity.Object.Content}}
+	}
+
+	if activity.ObjectID == activity.ID {
+		if activity.Object.ObjectType != nil {
+			e.ObjectType = *activity.Object.ObjectType
+		}
+
+		e.Content = content
+
+		return e
+	}
+
+	o := activitystreams.GenericObject{ID: activity.Object.ID}
+
+	if activity.Object.Name != nil {
+		o.Title = *activity.Object.Name
+	}
+	if activity.Object.Summary != nil {
+		o.Summary = *activity.Object.Summary
+	}
+	if activity.Object.ObjectType != nil {
+		o.ObjectType = *activity.Object.ObjectType
+	}
+	if activity.Object.Permalink != nil {
+		o.Link = append(o.Link, commonxml.Link{Rel: "alternate", Type: "text/html", Href: *activity.Object.Permalink})
+	}
+
+	if content != nil {
+		e.Object = &activitystreams.Note{GenericObject: o, Content: content}
+	} else {
+		e.Object = &o
+	}
+
+	return e
+}
+
+func makeUserFeed(u *User, activities []Activity) *activitystreams.Feed {
+	var f activitystreams.Feed
+
+	f.ID = userFeedURL(u.Username)
+	f.Title = u.Username + " timeline"
+	f.Updated = u.CreatedAt
+	f.Author = makeUserAuthor(u)
+
+	f.Link = []commonxml.Link{
+		{Rel: "alternate", Type: "text/html", Href: userProfileURL(u.Username)},
+		{Rel: "self", Type: "application/atom+xml", Href: userFeedURL(u.Username)},
+		{Rel: "hub", Href: hubURL()},
+		{Rel: "salmon", Href: userSalmonURL(u.Username)},
+		{Rel: "http://salmon-protocol.org/ns/salmon-replies", Href: userSalmonURL(u.Username)},
+		{Rel: "http://salmon-protocol.org/ns/salmon-mention", Href: userSalmonURL(u.Username)},
+	}
+
+	for i := range activities {
+		if activities[i].Time.After(f.Updated) {
+			f.Updated = activities[i].Time
+		}
+
+		f.Activities = append(f.Activities, makeEntry(&activities[i]))
+	}
+
+	if len(activities) >= timelinePageSize {
+		f.Link = append(f.Link, commonxml.Link{
+			Rel:  "next",
+			Type: "application/atom+xml",
+			Href: userFeedURL(u.Username) + "?" + url.Values{"before": []string{activities[len(activities)-1].Time.Format(time.RFC3339Nano)}}.Encode(),
+		})
+	}
+
+	return &f
+}
+
+func isUserFeedURL(topic string) bool {
+	return strings.HasPrefix(topic, userProfileURL("")) && strings.HasSuffix(topic, "/feed.atom")
+}
+
+func (a *App) publishUserActivity(u *User, activity *Activity) error {
+	if a.Hub == nil {
+		return nil
+	}
+
+	d, err := activitystreams.Serialize(makeUserFeed(u, []Activity{*activity}))
+	if err != nil {
+		return errors.Wrap(err, "App.publishUserActivity")
+	}
+
+	if err := a.Hub.Publish(userFeedURL(u.Username), "application/atom+xml", d); err != nil {
+		return errors.Wrap(err, "App.publishUserActivity")
+	}
+
+	return nil
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fknsrs.biz/p/don/commonxml"
+	"fknsrs.biz/p/don/hostmeta"
+)
+
+func makeHostMeta() *hostmeta.Response {
+	return &hostmeta.Response{
+		HasLinks: commonxml.HasLinks{
+			Link: []commonxml.Link{
+				{Rel: "lrdd", Type: "application/xrd+xml", Template: *publicURL + "/.well-known/webfinger?resource={uri}"},
+				{Rel: "lrdd", Type: "application/jrd+json", Template: *publicURL + "/.well-known/webfinger?resource={uri}"},
+			},
+		},
+	}
+}
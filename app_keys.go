@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/httpsig"
+)
+
+const userKeyBits = 2048
+
+var (
+	errUserKeyMissing = errors.New("user doesn't have a keypair")
+)
+
+type execer interface {
+	Exec(sql string, vars ...interface{}) (sql.Result, error)
+}
+
+func keyCipher() (cipher.AEAD, error) {
+	c, err := aes.NewCipher(*keyEncryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "keyCipher")
+	}
+
+	g, err := cipher.NewGCM(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "keyCipher")
+	}
+
+	return g, nil
+}
+
+func generateUserKey() (publicKey, privateKey string, err error) {
+	k, err := rsa.GenerateKey(rand.Reader, userKeyBits)
+	if err != nil {
+		return "", "", errors.Wrap(err, "generateUserKey")
+	}
+
+	publicKeyPEM, err := encodeUserPublicKey(&k.PublicKey)
+	if err != nil {
+		return "", "", errors.Wrap(err, "generateUserKey")
+	}
+
+	g, err := keyCipher()
+	if err != nil {
+		return "", "", errors.Wrap(err, "generateUserKey")
+	}
+
+	nonce := make([]byte, g.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", errors.Wrap(err, "generateUserKey")
+	}
+
+	sealed := g.Seal(nonce, nonce, x509.MarshalPKCS1PrivateKey(k), nil)
+
+	return publicKeyPEM, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func encodeUserPublicKey(k *rsa.PublicKey) (string, error) {
+	d, err := x509.MarshalPKIXPublicKey(k)
+	if err != nil {
+		return "", errors.Wrap(err, "encodeUserPublicKey")
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: d})), nil
+}
+
+func decodeUserPublicKey(s string) (*rsa.PublicKey, error) {
+	b, _ := pem.Decode([]byte(s))
+	if b == nil {
+		return nil, errors.Errorf("decodeUserPublicKey: couldn't decode pem block")
+	}
+
+	k, err := x509.ParsePKIXPublicKey(b.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "decodeUserPublicKey")
+	}
+
+	pk, ok := k.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("decodeUserPublicKey: expected rsa key but got %T", k)
+	}
+
+	return pk, nil
+}
+
+func decodeUserPrivateKey(s string) (*rsa.PrivateKey, error) {
+	sealed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "decodeUserPrivateKey")
+	}
+
+	g, err := keyCipher()
+	if err != nil {
+		return nil, errors.Wrap(err, "decodeUserPrivateKey")
+	}
+
+	if len(sealed) < g.NonceSize() {
+		return nil, errors.Errorf("decodeUserPrivateKey: sealed key is too short")
+	}
+
+	d, err := g.Open(nil, sealed[:g.NonceSize()], sealed[g.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "decodeUserPrivateKey")
+	}
+
+	k, err := x509.ParsePKCS1PrivateKey(d)
+	if err != nil {
+		return nil, errors.Wrap(err, "decodeUserPrivateKey")
+	}
+
+	return k, nil
+}
+
+func (a *App) getUserPublicKey(userID string) (*rsa.PublicKey, error) {
+	var publicKey sql.NullString
+	if err := a.SQLDB.QueryRow("select public_key from users where id = $1", userID).Scan(&publicKey); err != nil {
+		return nil, errors.Wrap(err, "App.getUserPublicKey")
+	}
+
+	if !publicKey.Valid {
+		return nil, errors.Wrap(errUserKeyMissing, "App.getUserPublicKey")
+	}
+
+	k, err := decodeUserPublicKey(publicKey.String)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.getUserPublicKey")
+	}
+
+	return k, nil
+}
+
+func (a *App) getUserPrivateKey(userID string) (*rsa.PrivateKey, error) {
+	var privateKey sql.NullString
+	if err := a.SQLDB.QueryRow("select private_key from users where id = $1", userID).Scan(&privateKey); err != nil {
+		return nil, errors.Wrap(err, "App.getUserPrivateKey")
+	}
+
+	if !privateKey.Valid {
+		return nil, errors.Wrap(errUserKeyMissing, "App.getUserPrivateKey")
+	}
+
+	k, err := decodeUserPrivateKey(privateKey.String)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.getUserPrivateKey")
+	}
+
+	return k, nil
+}
+
+// getInstanceKey returns the key used to sign requests made on behalf of the
+// node rather than any particular user, creating it the first time.
+func (a *App) getInstanceKey() (string, *rsa.PrivateKey, error) {
+	var publicKey, privateKey string
+	if err := a.SQLDB.QueryRow("select public_key, private_key from instance_keys where id = $1", "main").Scan(&publicKey, &privateKey); err != nil {
+		if err != sql.ErrNoRows {
+			return "", nil, errors.Wrap(err, "App.getInstanceKey")
+		}
+
+		publicKey, privateKey, err = generateUserKey()
+		if err != nil {
+			return "", nil, errors.Wrap(err, "App.getInstanceKey")
+		}
+
+		if _, err := a.SQLDB.Exec("insert into instance_keys (id, created_at, public_key, private_key) values ($1, $2, $3, $4)", "main", time.Now(), publicKey, privateKey); err != nil {
+			return "", nil, errors.Wrap(err, "App.getInstanceKey")
+		}
+	}
+
+	k, err := decodeUserPrivateKey(privateKey)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "App.getInstanceKey")
+	}
+
+	return publicKey, k, nil
+}
+
+func (a *App) getUserSigner(u *User) (*httpsig.Signer, error) {
+	k, err := a.getUserPrivateKey(u.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.getUserSigner")
+	}
+
+	return httpsig.NewSigner(userKeyID(u.Username), k), nil
+}
+
+func rotateUserKey(db execer, username string) error {
+	publicKey, privateKey, err := generateUserKey()
+	if err != nil {
+		return errors.Wrap(err, "rotateUserKey")
+	}
+
+	res, err := db.Exec("update users set public_key = $1, private_key = $2 where username = $3", publicKey, privateKey, username)
+	if err != nil {
+		return errors.Wrap(err, "rotateUserKey")
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrap(err, "rotateUserKey")
+	} else if n == 0 {
+		return errors.Wrap(errUserNotFound, "rotateUserKey")
+	}
+
+	return nil
+}
+
+func backfillUserKeys(tx *sql.Tx) error {
+	rows, err := tx.Query("select username from users where public_key is null or private_key is null")
+	if err != nil {
+		return errors.Wrap(err, "backfillUserKeys")
+	}
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "backfillUserKeys")
+		}
+
+		usernames = append(usernames, username)
+	}
+	rows.Close()
+
+	for _, username := range usernames {
+		if err := rotateUserKey(tx, username); err != nil {
+			return errors.Wrap(err, "backfillUserKeys")
+		}
+	}
+
+	return nil
+}
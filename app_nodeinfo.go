@@ -0,0 +1,67 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/nodeinfo"
+)
+
+const nodeInfoUsageMaxAge = time.Minute * 15
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+func makeNodeInfo(usage nodeinfo.Usage) *nodeinfo.Document {
+	return &nodeinfo.Document{
+		Software: nodeinfo.Software{
+			Name:       "don",
+			Version:    version,
+			Repository: "https://github.com/deoxxa/don",
+			Homepage:   "https://www.fknsrs.biz/p/don",
+		},
+		Protocols:         []string{"activitypub", "ostatus"},
+		OpenRegistrations: true,
+		Usage:             usage,
+		Metadata: map[string]interface{}{
+			"nodeName": publicHost(),
+		},
+	}
+}
+
+// getNodeInfoUsage counts local users and posts. The counts are cached since
+// crawlers tend to hit this endpoint a lot and nobody needs them to be exact.
+func (a *App) getNodeInfoUsage() (nodeinfo.Usage, error) {
+	a.nodeInfoLock.Lock()
+	defer a.nodeInfoLock.Unlock()
+
+	if a.nodeInfoUsage != nil && time.Since(a.nodeInfoUpdated) < nodeInfoUsageMaxAge {
+		return *a.nodeInfoUsage, nil
+	}
+
+	var usage nodeinfo.Usage
+
+	if err := a.SQLDB.QueryRow("select count(1) from users").Scan(&usage.Users.Total); err != nil {
+		return usage, errors.Wrap(err, "App.getNodeInfoUsage: couldn't count users")
+	}
+
+	if err := a.SQLDB.QueryRow("select count(1) from activities a inner join people p on p.id = a.actor where p.host = $1 and a.verb = $2", publicHost(), "http://activitystrea.ms/schema/1.0/post").Scan(&usage.LocalPosts); err != nil {
+		return usage, errors.Wrap(err, "App.getNodeInfoUsage: couldn't count posts")
+	}
+
+	now := time.Now()
+
+	if err := a.SQLDB.QueryRow("select count(distinct a.actor) from activities a inner join people p on p.id = a.actor where p.host = $1 and a.time > $2", publicHost(), now.AddDate(0, -1, 0)).Scan(&usage.Users.ActiveMonth); err != nil {
+		return usage, errors.Wrap(err, "App.getNodeInfoUsage: couldn't count active users")
+	}
+
+	if err := a.SQLDB.QueryRow("select count(distinct a.actor) from activities a inner join people p on p.id = a.actor where p.host = $1 and a.time > $2", publicHost(), now.AddDate(0, -6, 0)).Scan(&usage.Users.ActiveHalfyear); err != nil {
+		return usage, errors.Wrap(err, "App.getNodeInfoUsage: couldn't count active users")
+	}
+
+	a.nodeInfoUsage = &usage
+	a.nodeInfoUpdated = now
+
+	return usage, nil
+}
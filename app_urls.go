@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/url"
+	"time"
+
+	"fknsrs.biz/p/don/acct"
+)
+
+func publicHost() string {
+	u, err := url.Parse(*publicURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
+
+func userProfileURL(username string) string {
+	return *publicURL + "/users/" + username
+}
+
+func userFeedURL(username string) string {
+	return userProfileURL(username) + "/feed.atom"
+}
+
+func userStatusURL(username, id string) string {
+	return userProfileURL(username) + "/statuses/" + id
+}
+
+func userSalmonURL(username string) string {
+	return *publicURL + "/salmon/user/" + username
+}
+
+func userInboxURL(username string) string {
+	return userProfileURL(username) + "/inbox"
+}
+
+func userOutboxURL(username string) string {
+	return userProfileURL(username) + "/outbox"
+}
+
+func userKeyID(username string) string {
+	return userProfileURL(username) + "#main-key"
+}
+
+func sharedInboxURL() string {
+	return *publicURL + "/inbox"
+}
+
+func instanceActorURL() string {
+	return *publicURL + "/actor"
+}
+
+func instanceKeyID() string {
+	return instanceActorURL() + "#main-key"
+}
+
+func userAccountURL(username string) *acct.URL {
+	return &acct.URL{User: username, Host: publicHost()}
+}
+
+func hubURL() string {
+	return *publicURL + "/hub"
+}
+
+func makeTagURI(t time.Time, specific string) string {
+	var host string
+	if u, err := url.Parse(*publicURL); err == nil {
+		host = u.Hostname()
+	}
+
+	return "tag:" + host + "," + t.UTC().Format("2006-01-02") + ":" + specific
+}
+
+func nodeInfoURL(version string) string {
+	return *publicURL + "/nodeinfo/" + version
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jtacoma/uritemplates"
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/acct"
+	"fknsrs.biz/p/don/activitypub"
+	"fknsrs.biz/p/don/hostmeta"
+	"fknsrs.biz/p/don/salmon"
+	"fknsrs.biz/p/don/webfinger"
+)
+
+type userWebfingerSource struct{ a *App }
+
+func (s *userWebfingerSource) Fetch(subject string, rel []string) (*webfinger.Response, error) {
+	var username string
+
+	switch {
+	case strings.HasPrefix(subject, userProfileURL("")):
+		username = strings.TrimPrefix(subject, userProfileURL(""))
+	default:
+		u, err := acct.FromString(subject)
+		if err != nil {
+			return nil, errors.Wrap(webfinger.ErrNotFound, "userWebfingerSource.Fetch")
+		}
+
+		if !strings.EqualFold(u.Host, publicHost()) {
+			return nil, errors.Wrap(webfinger.ErrNotFound, "userWebfingerSource.Fetch")
+		}
+
+		username = u.User
+	}
+
+	if username == "" || strings.Contains(username, "/") {
+		return nil, errors.Wrap(webfinger.ErrNotFound, "userWebfingerSource.Fetch")
+	}
+
+	user, err := s.a.getUserByUsername(username)
+	if err != nil {
+		return nil, errors.Wrap(err, "userWebfingerSource.Fetch")
+	}
+	if user == nil {
+		return nil, errors.Wrap(webfinger.ErrNotFound, "userWebfingerSource.Fetch")
+	}
+
+	publicKey, err := s.a.getUserPublicKey(user.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "userWebfingerSource.Fetch")
+	}
+
+	return &webfinger.Response{
+		Subject: userAccountURL(user.Username).String(),
+		Aliases: []string{userProfileURL(user.Username)},
+		Links: []webfinger.Link{
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: userProfileURL(user.Username)},
+			{Rel: "self", Type: activitypub.MimeType, Href: userProfileURL(user.Username)},
+			{Rel: "http://schemas.google.com/g/2010#updates-from", Type: "application/atom+xml", Href: userFeedURL(user.Username)},
+			{Rel: "salmon", Href: userSalmonURL(user.Username)},
+			{Rel: "http://salmon-protocol.org/ns/salmon-replies", Href: userSalmonURL(user.Username)},
+			{Rel: "http://salmon-protocol.org/ns/salmon-mention", Href: userSalmonURL(user.Username)},
+			{Rel: "http://ostatus.org/schema/1.0/subscribe", Template: *publicURL + "/find-feed?user={uri}"},
+			{Rel: salmon.MagicPublicKeyRel, Href: salmon.MagicPublicKeyDataURL(publicKey)},
+		},
+	}, nil
+}
+
+// fetchWebfinger looks up an account, falling back to the host's lrdd
+// template for servers that don't serve /.well-known/webfinger.
+func fetchWebfinger(u *acct.URL) (*webfinger.Response, error) {
+	wf, err := webfinger.Fetch(webfinger.MakeURL(u.Host, u.String(), nil))
+	if err == nil {
+		return wf, nil
+	}
+
+	hm, err := hostmeta.Fetch(u.Host)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetchWebfinger")
+	}
+
+	lrdd := hm.GetLink("lrdd")
+	if lrdd == nil {
+		return nil, errors.Errorf("fetchWebfinger: no lrdd link found in host metadata")
+	}
+
+	var lrddHref string
+	switch {
+	case lrdd.Href != "":
+		lrddHref = lrdd.Href
+	case lrdd.Template != "":
+		lrddHrefTemplate, err := uritemplates.Parse(lrdd.Template)
+		if err != nil {
+			return nil, errors.Wrap(err, "fetchWebfinger")
+		}
+
+		s, err := lrddHrefTemplate.Expand(map[string]interface{}{"uri": u.String()})
+		if err != nil {
+			return nil, errors.Wrap(err, "fetchWebfinger")
+		}
+
+		lrddHref = s
+	}
+
+	wf, err = webfinger.Fetch(lrddHref)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetchWebfinger")
+	}
+
+	return wf, nil
+}
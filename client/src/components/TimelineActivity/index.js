@@ -4,7 +4,11 @@ import classNames from 'classnames';
 import React, { Component } from 'react';
 import TimeAgo from 'react-timeago';
 
-import type { Activity } from 'ducks/publicTimeline';
+import type {
+  Activity,
+  ASAttachment,
+  ASObject,
+} from 'ducks/publicTimeline';
 
 import styles from './styles.css';
 
@@ -19,6 +23,76 @@ import styles from './styles.css';
 //   <span className={className}>{verbs[verb] || verb}</span>
 // );
 
+const Media = ({ object }: { object: ASObject }) => {
+  if (!object.mediaURL) {
+    return null;
+  }
+
+  const type = object.mediaType || '';
+
+  if (type.startsWith('video/')) {
+    return (
+      <video className={styles.media} src={object.mediaURL} controls={true} />
+    );
+  }
+
+  if (type.startsWith('audio/')) {
+    return (
+      <audio className={styles.media} src={object.mediaURL} controls={true} />
+    );
+  }
+
+  if (type.startsWith('image/') || type === '') {
+    return (
+      <a href={object.mediaURL}>
+        <img
+          className={styles.media}
+          src={object.mediaURL}
+          width={object.width}
+          height={object.height}
+        />
+      </a>
+    );
+  }
+
+  return (
+    <a className={styles.media} href={object.mediaURL}>
+      {object.name || object.mediaURL}
+    </a>
+  );
+};
+
+const Attachment = ({ attachment }: { attachment: ASAttachment }) => {
+  if (attachment.sensitive) {
+    return (
+      <a className={styles.media} href={attachment.url}>
+        sensitive content: {attachment.description || attachment.url}
+      </a>
+    );
+  }
+
+  if (attachment.mediaType.startsWith('image/')) {
+    return (
+      <a href={attachment.url}>
+        <img
+          className={styles.media}
+          src={attachment.url}
+          alt={attachment.description}
+          title={attachment.description}
+          width={attachment.width}
+          height={attachment.height}
+        />
+      </a>
+    );
+  }
+
+  return (
+    <a className={styles.media} href={attachment.url}>
+      {attachment.description || attachment.url}
+    </a>
+  );
+};
+
 export default class TimelineActivity extends Component {
   props: { activity: Activity, selected: boolean, onClick: () => void };
   state: { mounted: boolean };
@@ -99,6 +173,20 @@ export default class TimelineActivity extends Component {
               />
             : null}
 
+          <Media object={activity.object} />
+
+          {!activity.object.mediaURL && activity.object.attachments
+            ? activity.object.attachments.map(attachment => (
+                <Attachment key={attachment.url} attachment={attachment} />
+              ))
+            : null}
+
+          {activity.object.targetURL
+            ? <a className={styles.media} href={activity.object.targetURL}>
+                {activity.object.name || activity.object.targetURL}
+              </a>
+            : null}
+
           <div className={styles.footer}>
             {activity.inReplyToURL
               ? <span className={styles.inReplyTo}>
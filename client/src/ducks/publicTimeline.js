@@ -12,6 +12,16 @@ export type ASPerson = {
   summary: ?string,
 };
 
+export type ASAttachment = {
+  url: string,
+  mediaType: string,
+  length: ?number,
+  width: ?number,
+  height: ?number,
+  description: string,
+  sensitive: boolean,
+};
+
 export type ASObject = {
   id: string,
   name: ?string,
@@ -20,6 +30,15 @@ export type ASObject = {
   permalink: ?string,
   objectType: ?string,
   content: ?string,
+  mediaURL: ?string,
+  mediaType: ?string,
+  width: ?number,
+  height: ?number,
+  duration: ?number,
+  startTime: ?string,
+  endTime: ?string,
+  targetURL: ?string,
+  attachments: ?Array<ASAttachment>,
 };
 
 export type ASActivity = {
@@ -34,6 +53,7 @@ export type ASActivity = {
   title: ?string,
   inReplyToID: ?string,
   inReplyToURL: ?string,
+  sharedActivityID: ?string,
 };
 
 export type State = {
@@ -5,7 +5,7 @@ type Link struct {
 
 	Rel      string `xml:"rel,attr,omitempty" json:"rel,omitempty"`
 	Type     string `xml:"type,attr,omitempty" json:"type,omitempty"`
-	Href     string `xml:"href,attr" json:"href,omitempty"`
+	Href     string `xml:"href,attr,omitempty" json:"href,omitempty"`
 	HrefLang string `xml:"hreflang,attr,omitempty" json:"hrefLang,omitempty"`
 	Template string `xml:"template,attr,omitempty" json:"template,omitempty"`
 	Title    string `xml:"title,attr,omitempty" json:"title,omitempty"`
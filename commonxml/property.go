@@ -6,7 +6,7 @@ type Property struct {
 }
 
 type HasProperties struct {
-	Property []Property `xml:"link" json:"link,omitempty"`
+	Property []Property `xml:"Property" json:"properties,omitempty"`
 }
 
 func (v *HasProperties) GetProperty(typ string) *Property {
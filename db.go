@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"net/url"
 	"strings"
 	"time"
 
@@ -24,6 +25,7 @@ var (
 		sqlbuilder.StringColumn("display_name", nil),
 		sqlbuilder.StringColumn("avatar", nil),
 		sqlbuilder.StringColumn("summary", nil),
+		sqlbuilder.StringColumn("protocol", &sqlbuilder.ColumnOption{NotNull: true}),
 	)
 
 	objectsTable = sqlbuilder.NewTable(
@@ -37,6 +39,29 @@ var (
 		sqlbuilder.StringColumn("permalink", nil),
 		sqlbuilder.StringColumn("object_type", nil),
 		sqlbuilder.StringColumn("content", nil),
+		sqlbuilder.StringColumn("media_url", nil),
+		sqlbuilder.StringColumn("media_type", nil),
+		sqlbuilder.IntColumn("width", nil),
+		sqlbuilder.IntColumn("height", nil),
+		sqlbuilder.IntColumn("duration", nil),
+		sqlbuilder.DateColumn("start_time", nil),
+		sqlbuilder.DateColumn("end_time", nil),
+		sqlbuilder.StringColumn("target_url", nil),
+		sqlbuilder.DateColumn("deleted_at", nil),
+	)
+
+	attachmentsTable = sqlbuilder.NewTable(
+		"attachments",
+		nil,
+		sqlbuilder.StringColumn("object_id", &sqlbuilder.ColumnOption{NotNull: true}),
+		sqlbuilder.IntColumn("position", &sqlbuilder.ColumnOption{NotNull: true}),
+		sqlbuilder.StringColumn("url", &sqlbuilder.ColumnOption{NotNull: true}),
+		sqlbuilder.StringColumn("media_type", &sqlbuilder.ColumnOption{NotNull: true}),
+		sqlbuilder.IntColumn("length", nil),
+		sqlbuilder.IntColumn("width", nil),
+		sqlbuilder.IntColumn("height", nil),
+		sqlbuilder.StringColumn("description", &sqlbuilder.ColumnOption{NotNull: true}),
+		sqlbuilder.BoolColumn("sensitive", &sqlbuilder.ColumnOption{NotNull: true}),
 	)
 
 	activitiesTable = sqlbuilder.NewTable(
@@ -52,38 +77,124 @@ var (
 		sqlbuilder.StringColumn("title", nil),
 		sqlbuilder.StringColumn("in_reply_to_id", nil),
 		sqlbuilder.StringColumn("in_reply_to_url", nil),
+		sqlbuilder.StringColumn("shared_activity_id", nil),
+	)
+
+	mentionsTable = sqlbuilder.NewTable(
+		"mentions",
+		nil,
+		sqlbuilder.StringColumn("activity_id", &sqlbuilder.ColumnOption{NotNull: true}),
+		sqlbuilder.StringColumn("target", &sqlbuilder.ColumnOption{NotNull: true}),
+		sqlbuilder.StringColumn("person_id", nil),
+		sqlbuilder.StringColumn("kind", &sqlbuilder.ColumnOption{NotNull: true}),
 	)
 )
 
 func (a *App) savePerson(p *activitystreams.Author) (*Person, error) {
-	var permalink string
-	for _, l := range p.GetLinks("alternate") {
-		if l.Type == "text/html" && permalink == "" {
-			permalink = l.Href
+	if p.FromFeed {
+		if p.FetchedFrom == "" {
+			return nil, nil
 		}
+
+		person, err := a.saveFeedPerson(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "App.savePerson")
+		}
+
+		return person, nil
 	}
-	if permalink == "" {
-		permalink = p.URI
+
+	permalink, accountURL, err := a.authorAccount(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.savePerson")
+	}
+	if accountURL == nil {
+		return nil, nil
+	}
+
+	person, err := a.storePerson(accountURL, permalink, personProtocolOStatus, p.DisplayName, p.Summary, p.GetBestAvatar())
+	if err != nil {
+		return nil, errors.Wrap(err, "App.savePerson")
+	}
+
+	return person, nil
+}
+
+// authorPermalink picks the link an author is known by, preferring their
+// html profile.
+func authorPermalink(p *activitystreams.Author) string {
+	for _, l := range p.GetLinks("alternate") {
+		if l.Type == "text/html" {
+			return l.Href
+		}
 	}
 
+	return p.URI
+}
+
+// authorAccount works out which account an author will be saved as, along
+// with their permalink. The account is nil if it can't be resolved. Anything
+// that checks who wrote an entry has to go through here so that it agrees
+// with savePerson.
+func (a *App) authorAccount(p *activitystreams.Author) (string, *acct.URL, error) {
+	permalink := authorPermalink(p)
 	if permalink == "" {
-		return nil, errors.Errorf("App.savePerson: couldn't find permalink for user")
+		return "", nil, errors.Errorf("App.authorAccount: couldn't find permalink for user")
 	}
 
 	accountURLString, _, err := a.AccountURLCache.Get(permalink, p)
-
 	if err != nil || len(accountURLString) == 0 {
-		return nil, nil
+		return permalink, nil, nil
 	}
 
 	accountURL, err := acct.FromString(string(accountURLString))
 	if err != nil {
-		return nil, errors.Wrap(err, "App.savePerson: couldn't parse account url")
+		return "", nil, errors.Wrap(err, "App.authorAccount: couldn't parse account url")
 	}
 
+	return permalink, accountURL, nil
+}
+
+// saveFeedPerson records the author of a feed that doesn't have accounts,
+// like an RSS channel. There's no account to key them by, and the feed can
+// say whatever it likes about itself, so the url it was fetched from stands
+// in for one. The link the feed gives is only used as a permalink if it's
+// on the same host.
+func (a *App) saveFeedPerson(p *activitystreams.Author) (*Person, error) {
+	u, err := url.Parse(p.FetchedFrom)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.saveFeedPerson")
+	}
+
+	permalink := p.FetchedFrom
+	if l, err := url.Parse(authorPermalink(p)); err == nil && (l.Scheme == "http" || l.Scheme == "https") && strings.EqualFold(l.Host, u.Host) {
+		permalink = l.String()
+	}
+
+	person, err := a.storePersonRecord(p.FetchedFrom, u.Host, permalink, personProtocolFeed, p.DisplayName, p.Summary, p.GetBestAvatar())
+	if err != nil {
+		return nil, errors.Wrap(err, "App.saveFeedPerson")
+	}
+
+	return person, nil
+}
+
+const (
+	personProtocolOStatus     = "ostatus"
+	personProtocolActivityPub = "activitypub"
+	personProtocolFeed        = "feed"
+)
+
+// storePerson creates or updates a person record. An empty protocol leaves
+// whatever was recorded before alone.
+func (a *App) storePerson(accountURL *acct.URL, permalink, newProtocol, newDisplayName, newSummary, newAvatar string) (*Person, error) {
+	return a.storePersonRecord(accountURL.String(), accountURL.Host, permalink, newProtocol, newDisplayName, newSummary, newAvatar)
+}
+
+func (a *App) storePersonRecord(id, host, permalink, newProtocol, newDisplayName, newSummary, newAvatar string) (*Person, error) {
 	tx, err := a.SQLDB.Begin()
 	if err != nil {
-		return nil, errors.Wrap(err, "App.savePerson: couldn't begin transaction")
+		return nil, errors.Wrap(err, "App.storePersonRecord: couldn't begin transaction")
 	}
 	defer tx.Rollback()
 
@@ -92,33 +203,41 @@ func (a *App) savePerson(p *activitystreams.Author) (*Person, error) {
 		peopleTable.C("display_name"),
 		peopleTable.C("avatar"),
 		peopleTable.C("summary"),
-	).Where(peopleTable.C("id").Eq(accountURL.String()))
+		peopleTable.C("protocol"),
+	).Where(peopleTable.C("id").Eq(id))
 
 	selectQuerySQL, selectQueryVars, err := selectQuery.ToSql()
 	if err != nil {
-		return nil, errors.Wrap(err, "App.savePerson: couldn't make select query")
+		return nil, errors.Wrap(err, "App.storePersonRecord: couldn't make select query")
 	}
 
 	var firstSeen time.Time
-	var displayName, avatar, summary string
-	if err := tx.QueryRow(selectQuerySQL, selectQueryVars...).Scan(&firstSeen, &displayName, &avatar, &summary); err != nil && err != sql.ErrNoRows {
-		return nil, errors.Wrap(err, "App.savePerson: couldn't query for existing person")
+	var displayName, avatar, summary, protocol string
+	if err := tx.QueryRow(selectQuerySQL, selectQueryVars...).Scan(&firstSeen, &displayName, &avatar, &summary, &protocol); err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "App.storePersonRecord: couldn't query for existing person")
 	}
 
 	var changed bool
 
-	if newDisplayName := strings.TrimSpace(p.DisplayName); newDisplayName != "" && newDisplayName != displayName {
+	if newDisplayName := strings.TrimSpace(newDisplayName); newDisplayName != "" && newDisplayName != displayName {
 		displayName = newDisplayName
 		changed = true
 	}
-	if newSummary := strings.TrimSpace(p.Summary); newSummary != "" && newSummary != summary {
+	if newSummary := strings.TrimSpace(newSummary); newSummary != "" && newSummary != summary {
 		summary = newSummary
 		changed = true
 	}
-	if newAvatar := strings.TrimSpace(p.GetBestAvatar()); newAvatar != "" && newAvatar != avatar {
+	if newAvatar := strings.TrimSpace(newAvatar); newAvatar != "" && newAvatar != avatar {
 		avatar = newAvatar
 		changed = true
 	}
+	if newProtocol != "" && newProtocol != protocol {
+		protocol = newProtocol
+		changed = true
+	}
+	if protocol == "" {
+		protocol = personProtocolOStatus
+	}
 
 	if firstSeen.IsZero() {
 		firstSeen = time.Now()
@@ -131,52 +250,57 @@ func (a *App) savePerson(p *activitystreams.Author) (*Person, error) {
 			peopleTable.C("display_name"),
 			peopleTable.C("avatar"),
 			peopleTable.C("summary"),
-		).Values(accountURL.String(), accountURL.Host, firstSeen, permalink, displayName, avatar, summary)
+			peopleTable.C("protocol"),
+		).Values(id, host, firstSeen, permalink, displayName, avatar, summary, protocol)
 
 		insertQuerySQL, insertQueryVars, err := insertQuery.ToSql()
 		if err != nil {
-			return nil, errors.Wrap(err, "App.savePerson: couldn't make insert query")
+			return nil, errors.Wrap(err, "App.storePersonRecord: couldn't make insert query")
 		}
 
 		if _, err := tx.Exec(insertQuerySQL, insertQueryVars...); err != nil {
-			return nil, errors.Wrap(err, "App.savePerson: couldn't save person to db")
+			return nil, errors.Wrap(err, "App.storePersonRecord: couldn't save person to db")
 		}
 	} else if changed {
 		updateQuery := sqlbuilder.Update(peopleTable).
 			Set(peopleTable.C("display_name"), displayName).
 			Set(peopleTable.C("avatar"), avatar).
 			Set(peopleTable.C("summary"), summary).
-			Where(peopleTable.C("id").Eq(accountURL.String()))
+			Set(peopleTable.C("protocol"), protocol).
+			Where(peopleTable.C("id").Eq(id))
 
 		updateQuerySQL, updateQueryVars, err := updateQuery.ToSql()
 		if err != nil {
-			return nil, errors.Wrap(err, "App.savePerson: couldn't make update query")
+			return nil, errors.Wrap(err, "App.storePersonRecord: couldn't make update query")
 		}
 
 		if _, err := tx.Exec(updateQuerySQL, updateQueryVars...); err != nil {
-			return nil, errors.Wrap(err, "App.savePerson: couldn't update person in db")
+			return nil, errors.Wrap(err, "App.storePersonRecord: couldn't update person in db")
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, errors.Wrap(err, "App.savePerson: couldn't commit transaction")
+		return nil, errors.Wrap(err, "App.storePersonRecord: couldn't commit transaction")
 	}
 
 	return &Person{
-		ID:          accountURL.String(),
-		Host:        accountURL.Host,
+		ID:          id,
+		Host:        host,
 		FirstSeen:   firstSeen,
 		Permalink:   permalink,
 		DisplayName: &displayName,
 		Avatar:      &avatar,
 		Summary:     &summary,
+		Protocol:    protocol,
 	}, nil
 }
 
 func (a *App) saveActivity(e activitystreams.ActivityLike) error {
 	o := e.GetObject()
 
-	if o != e {
+	// the objects of deletes and updates are handled by the verb itself,
+	// so saving them here would resurrect or clobber things
+	if v := shortVerb(e.GetVerb()); o != e && v != "delete" && v != "update" {
 		if e2, ok := o.(activitystreams.ActivityLike); ok {
 			if err := a.saveActivity(e2); err != nil {
 				return errors.Wrap(err, "saveActivity: couldn't save nested activity")
@@ -192,36 +316,77 @@ func (a *App) saveActivity(e activitystreams.ActivityLike) error {
 
 	var person *Person
 
-	var actorID sql.NullString
 	if actor := e.GetActor(); actor != nil {
 		if p, err := a.savePerson(actor); err != nil {
 			return errors.Wrap(err, "saveActivity: couldn't save author")
 		} else if p != nil {
-			actorID.Valid = true
-			actorID.String = p.ID
-
 			person = p
 		}
 	}
 
-	object, err := a.saveObject(o)
+	if handled, err := a.handleVerb(e, person); err != nil {
+		return errors.Wrap(err, "saveActivity")
+	} else if handled {
+		return nil
+	}
+
+	if _, err := a.storeActivity(e, person); err != nil {
+		return errors.Wrap(err, "saveActivity")
+	}
+
+	return nil
+}
+
+func (a *App) storeActivity(e activitystreams.ActivityLike, person *Person) (*Activity, error) {
+	var actorID sql.NullString
+	if person != nil {
+		actorID.Valid = true
+		actorID.String = person.ID
+	}
+
+	if shortVerb(e.GetVerb()) == "post" {
+		if err := a.clearUnconfirmedTombstone(e.GetObject().GetID(), actorID); err != nil {
+			return nil, errors.Wrap(err, "storeActivity")
+		}
+	}
+
+	object, err := a.saveObject(e.GetObject())
 	if err != nil {
-		return errors.Wrap(err, "saveActivity: couldn't save object")
+		return nil, errors.Wrap(err, "storeActivity: couldn't save object")
+	}
+
+	if person != nil && shortVerb(e.GetVerb()) == "post" {
+		if err := claimObject(a.SQLDB, object.ID, person); err != nil {
+			return nil, errors.Wrap(err, "storeActivity")
+		}
 	}
 
 	if _, err := a.saveObject(e); err != nil {
-		return errors.Wrap(err, "saveActivity: couldn't save activity as object")
+		return nil, errors.Wrap(err, "storeActivity: couldn't save activity as object")
 	}
 
+	// resolving mentions can mean a webfinger request, so it has to happen
+	// before the transaction starts, and it's not worth doing for things
+	// we've already seen
+	var exists int
+	if err := a.SQLDB.QueryRow("select count(1) from activities where id = $1", e.GetID()).Scan(&exists); err != nil {
+		return nil, errors.Wrap(err, "storeActivity: couldn't query for existing activities")
+	}
+	if exists > 0 {
+		return nil, nil
+	}
+
+	mentions := a.makeMentions(e)
+
 	tx, err := a.SQLDB.Begin()
 	if err != nil {
-		return errors.Wrap(err, "saveActivity: couldn't begin transaction")
+		return nil, errors.Wrap(err, "storeActivity: couldn't begin transaction")
 	}
 	defer tx.Rollback()
 
 	var rowID sql.NullInt64
 	if err := tx.QueryRow("select ROWID from activities where id = $1", e.GetID()).Scan(&rowID); err != nil && err != sql.ErrNoRows {
-		return errors.Wrap(err, "saveActivity: couldn't query for existing activities")
+		return nil, errors.Wrap(err, "storeActivity: couldn't query for existing activities")
 	}
 
 	var inReplyToID, inReplyToURL sql.NullString
@@ -236,24 +401,35 @@ func (a *App) saveActivity(e activitystreams.ActivityLike) error {
 	}
 
 	if rowID.Valid {
-		return nil
+		return nil, nil
+	}
+
+	var sharedActivityID sql.NullString
+	if shortVerb(e.GetVerb()) == "share" {
+		if sharedActivityID, err = findSharedActivity(tx, e); err != nil {
+			return nil, errors.Wrap(err, "storeActivity")
+		}
 	}
 
-	res, err := tx.Exec("insert into activities (id, permalink, actor, object, verb, time, title, in_reply_to_id, in_reply_to_url) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)", e.GetID(), e.GetPermalink(), actorID, e.GetObject().GetID(), e.GetVerb(), e.GetTime(), e.GetTitle(), inReplyToID, inReplyToURL)
+	res, err := tx.Exec("insert into activities (id, permalink, actor, object, verb, time, title, in_reply_to_id, in_reply_to_url, shared_activity_id) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)", e.GetID(), e.GetPermalink(), actorID, e.GetObject().GetID(), e.GetVerb(), e.GetTime(), e.GetTitle(), inReplyToID, inReplyToURL, sharedActivityID)
 	if err != nil {
-		return errors.Wrap(err, "saveActivity: couldn't save activity to db")
+		return nil, errors.Wrap(err, "storeActivity: couldn't save activity to db")
 	}
 
 	insertID, err := res.LastInsertId()
 	if err != nil {
-		return errors.Wrap(err, "saveActivity: couldn't get row id")
+		return nil, errors.Wrap(err, "storeActivity: couldn't get row id")
 	}
 
 	rowID.Valid = true
 	rowID.Int64 = insertID
 
+	if err := insertMentions(tx, mentions); err != nil {
+		return nil, errors.Wrap(err, "storeActivity: couldn't save mentions")
+	}
+
 	if err := tx.Commit(); err != nil {
-		return errors.Wrap(err, "saveActivity: couldn't commit transaction")
+		return nil, errors.Wrap(err, "storeActivity: couldn't commit transaction")
 	}
 
 	activity := Activity{
@@ -277,106 +453,160 @@ func (a *App) saveActivity(e activitystreams.ActivityLike) error {
 	if inReplyToURL.Valid {
 		activity.InReplyToURL = &inReplyToURL.String
 	}
+	if sharedActivityID.Valid {
+		activity.SharedActivityID = &sharedActivityID.String
+	}
 
 	a.Emit(&ActivityEvent{RowID: rowID.Int64, Activity: &activity})
 
-	return nil
+	return &activity, nil
 }
 
-func (a *App) saveObject(o activitystreams.ObjectLike) (*Object, error) {
-	tx, err := a.SQLDB.Begin()
-	if err != nil {
-		return nil, errors.Wrap(err, "saveObject: couldn't begin transaction")
+// makeObject copies whatever an object exposes into the shape it's stored
+// in. Attachments are included, but without an object id or position.
+func makeObject(o activitystreams.ObjectLike) *Object {
+	str := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+
+		return &s
 	}
-	defer tx.Rollback()
 
-	var id, name, summary, representativeImage, permalink, objectType, content sql.NullString
-	if err := tx.QueryRow("select id, name, summary, representative_image, permalink, object_type, content from objects where id = $1", o.GetID()).Scan(&id, &name, &summary, &representativeImage, &permalink, &objectType, &content); err != nil && err != sql.ErrNoRows {
-		return nil, errors.Wrap(err, "saveObject: couldn't query for existing objects")
+	num := func(n int) *int {
+		if n == 0 {
+			return nil
+		}
+
+		return &n
 	}
 
-	if !id.Valid {
-		id.Valid = true
-		id.String = o.GetID()
+	object := Object{
+		ID:                  o.GetID(),
+		Name:                str(o.GetName()),
+		Summary:             str(o.GetSummary()),
+		RepresentativeImage: str(o.GetRepresentativeImage()),
+		Permalink:           str(o.GetPermalink()),
+		ObjectType:          str(o.GetObjectType()),
+	}
 
-		if s := o.GetName(); s != "" {
-			name.Valid = true
-			name.String = s
-		}
+	if hc, ok := o.(activitystreams.HasContent); ok {
+		object.Content = str(hc.GetContent())
+	}
 
-		if s := o.GetSummary(); s != "" {
-			summary.Valid = true
-			summary.String = s
-		}
+	if hm, ok := o.(activitystreams.HasMedia); ok {
+		object.MediaURL = str(hm.GetMediaURL())
+		object.MediaType = str(hm.GetMediaType())
+	}
 
-		if s := o.GetRepresentativeImage(); s != "" {
-			representativeImage.Valid = true
-			representativeImage.String = s
-		}
+	if hd, ok := o.(activitystreams.HasDimensions); ok {
+		object.Width = num(hd.GetWidth())
+		object.Height = num(hd.GetHeight())
+	}
 
-		if s := o.GetPermalink(); s != "" {
-			permalink.Valid = true
-			permalink.String = s
-		}
+	if hd, ok := o.(activitystreams.HasDuration); ok {
+		object.Duration = num(int(hd.GetDuration() / time.Second))
+	}
 
-		if s := o.GetObjectType(); s != "" {
-			objectType.Valid = true
-			objectType.String = s
+	if ht, ok := o.(activitystreams.HasTimeRange); ok {
+		if t := ht.GetStartTime(); !t.IsZero() {
+			object.StartTime = &t
 		}
 
-		if hc, ok := o.(activitystreams.HasContent); ok {
-			if c := hc.GetContent(); c != "" {
-				content.Valid = true
-				content.String = c
-			}
+		if t := ht.GetEndTime(); !t.IsZero() {
+			object.EndTime = &t
 		}
+	}
+
+	if ht, ok := o.(activitystreams.HasTargetURL); ok {
+		object.TargetURL = str(ht.GetTargetURL())
+	}
 
-		if _, err := tx.Exec("insert into objects (id, name, summary, representative_image, permalink, object_type, content) values ($1, $2, $3, $4, $5, $6, $7)", o.GetID(), o.GetName(), o.GetSummary(), o.GetRepresentativeImage(), o.GetPermalink(), o.GetObjectType(), content); err != nil {
-			return nil, errors.Wrap(err, "saveObject: couldn't save object to db")
+	if ha, ok := o.(activitystreams.HasAttachments); ok {
+		for i, e := range ha.GetAttachments() {
+			object.Attachments = append(object.Attachments, makeAttachment(object.ID, i, e))
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, errors.Wrap(err, "saveObject: couldn't commit transaction")
+	return &object
+}
+
+func insertAttachments(tx Tx, l []Attachment) error {
+	for _, attachment := range l {
+		if _, err := tx.Exec("insert into attachments (object_id, position, url, media_type, length, width, height, description, sensitive) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)", attachment.ObjectID, attachment.Position, attachment.URL, attachment.MediaType, attachment.Length, attachment.Width, attachment.Height, attachment.Description, attachment.Sensitive); err != nil {
+			return errors.Wrap(err, "insertAttachments")
+		}
 	}
 
-	object := &Object{ID: id.String}
+	return nil
+}
 
-	if name.Valid {
-		object.Name = &name.String
+func (a *App) saveObject(o activitystreams.ObjectLike) (*Object, error) {
+	tx, err := a.SQLDB.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "saveObject: couldn't begin transaction")
 	}
-	if summary.Valid {
-		object.Summary = &summary.String
+	defer tx.Rollback()
+
+	var object Object
+	if err := tx.QueryRow("select id, name, summary, representative_image, permalink, object_type, content, media_url, media_type, width, height, duration, start_time, end_time, target_url from objects where id = $1", o.GetID()).Scan(&object.ID, &object.Name, &object.Summary, &object.RepresentativeImage, &object.Permalink, &object.ObjectType, &object.Content, &object.MediaURL, &object.MediaType, &object.Width, &object.Height, &object.Duration, &object.StartTime, &object.EndTime, &object.TargetURL); err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "saveObject: couldn't query for existing objects")
 	}
-	if representativeImage.Valid {
-		object.RepresentativeImage = &representativeImage.String
+
+	if object.ID != "" {
+		if err := tx.Commit(); err != nil {
+			return nil, errors.Wrap(err, "saveObject: couldn't commit transaction")
+		}
+
+		attachments, err := a.getAttachments(object.ID)
+		if err != nil {
+			return nil, errors.Wrap(err, "saveObject")
+		}
+		object.Attachments = attachments[object.ID]
+
+		return &object, nil
 	}
-	if permalink.Valid {
-		object.Permalink = &permalink.String
+
+	object = *makeObject(o)
+
+	if _, err := tx.Exec("insert into objects (id, name, summary, representative_image, permalink, object_type, content, media_url, media_type, width, height, duration, start_time, end_time, target_url) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)", object.ID, object.Name, object.Summary, object.RepresentativeImage, object.Permalink, object.ObjectType, object.Content, object.MediaURL, object.MediaType, object.Width, object.Height, object.Duration, object.StartTime, object.EndTime, object.TargetURL); err != nil {
+		return nil, errors.Wrap(err, "saveObject: couldn't save object to db")
 	}
-	if objectType.Valid {
-		object.ObjectType = &objectType.String
+
+	if err := insertAttachments(tx, object.Attachments); err != nil {
+		return nil, errors.Wrap(err, "saveObject: couldn't save attachments to db")
 	}
-	if content.Valid {
-		object.Content = &content.String
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "saveObject: couldn't commit transaction")
 	}
 
-	return object, nil
+	return &object, nil
 }
 
+const timelinePageSize = 50
+
 type getPublicTimelineArgs struct {
-	Q       string    `schema:"q"`
-	After   time.Time `schema:"after"`
-	Before  time.Time `schema:"before"`
-	Account string    `schema:"account"`
+	Q        string    `schema:"q"`
+	After    time.Time `schema:"after"`
+	Before   time.Time `schema:"before"`
+	Account  string    `schema:"account"`
+	Mentions string    `schema:"mentions"`
+
+	Permalink  string `schema:"-"`
+	FollowedBy string `schema:"-"`
 }
 
 func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error) {
+	from := activitiesTable.
+		LeftOuterJoin(peopleTable, peopleTable.C("id").Eq(activitiesTable.C("actor"))).
+		LeftOuterJoin(objectsTable, objectsTable.C("id").Eq(activitiesTable.C("object")))
+	if args.Mentions != "" {
+		from = from.InnerJoin(mentionsTable, mentionsTable.C("activity_id").Eq(activitiesTable.C("id")))
+	}
+
 	qb := sqlbuilder.
-		Select(activitiesTable.
-			LeftOuterJoin(peopleTable, peopleTable.C("id").Eq(activitiesTable.C("actor"))).
-			LeftOuterJoin(objectsTable, objectsTable.C("id").Eq(activitiesTable.C("object"))),
-		).
+		Select(from).
 		Columns(
 			activitiesTable.C("id"),
 			activitiesTable.C("permalink"),
@@ -387,6 +617,7 @@ func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error)
 			activitiesTable.C("title"),
 			activitiesTable.C("in_reply_to_id"),
 			activitiesTable.C("in_reply_to_url"),
+			activitiesTable.C("shared_activity_id"),
 			objectsTable.C("id"),
 			objectsTable.C("name"),
 			objectsTable.C("summary"),
@@ -394,6 +625,14 @@ func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error)
 			objectsTable.C("permalink"),
 			objectsTable.C("object_type"),
 			objectsTable.C("content"),
+			objectsTable.C("media_url"),
+			objectsTable.C("media_type"),
+			objectsTable.C("width"),
+			objectsTable.C("height"),
+			objectsTable.C("duration"),
+			objectsTable.C("start_time"),
+			objectsTable.C("end_time"),
+			objectsTable.C("target_url"),
 			peopleTable.C("id"),
 			peopleTable.C("host"),
 			peopleTable.C("first_seen"),
@@ -401,11 +640,14 @@ func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error)
 			peopleTable.C("display_name"),
 			peopleTable.C("avatar"),
 			peopleTable.C("summary"),
+			peopleTable.C("protocol"),
 		).
 		OrderBy(true, activitiesTable.C("time")).
-		Limit(50)
+		Limit(timelinePageSize)
 
-	var conditions []sqlbuilder.Condition
+	conditions := []sqlbuilder.Condition{
+		objectsTable.C("deleted_at").Eq(nil),
+	}
 
 	if !args.After.IsZero() {
 		conditions = append(conditions, activitiesTable.C("time").Gt(args.After))
@@ -413,9 +655,27 @@ func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error)
 	if !args.Before.IsZero() {
 		conditions = append(conditions, activitiesTable.C("time").Lt(args.Before))
 	}
+	if args.Permalink != "" {
+		conditions = append(conditions, activitiesTable.C("permalink").Eq(args.Permalink))
+	}
 	if args.Account != "" {
 		conditions = append(conditions, activitiesTable.C("actor").Eq("acct:"+strings.TrimPrefix(strings.TrimPrefix(args.Account, "@"), "acct:")))
 	}
+	if args.Mentions != "" {
+		conditions = append(conditions, mentionsTable.C("person_id").Eq("acct:"+strings.TrimPrefix(strings.TrimPrefix(args.Mentions, "@"), "acct:")))
+	}
+	if args.FollowedBy != "" {
+		people, err := a.getFollowedPeople(args.FollowedBy)
+		if err != nil {
+			return nil, errors.Wrap(err, "getPublicTimeline")
+		}
+
+		if len(people) == 0 {
+			return nil, nil
+		}
+
+		conditions = append(conditions, activitiesTable.C("actor").In(people...))
+	}
 
 	if args.Q != "" {
 		var l []sqlbuilder.Condition
@@ -433,9 +693,7 @@ func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error)
 		}
 	}
 
-	if len(conditions) > 0 {
-		qb = qb.Where(sqlbuilder.And(conditions...))
-	}
+	qb = qb.Where(sqlbuilder.And(conditions...))
 
 	q, vars, err := qb.ToSql()
 	if err != nil {
@@ -460,6 +718,7 @@ func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error)
 			personDisplayName *string
 			personAvatar      *string
 			personSummary     *string
+			personProtocol    *string
 		)
 
 		if err := rows.Scan(
@@ -472,6 +731,7 @@ func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error)
 			&activity.Title,
 			&activity.InReplyToID,
 			&activity.InReplyToURL,
+			&activity.SharedActivityID,
 			&activity.Object.ID,
 			&activity.Object.Name,
 			&activity.Object.Summary,
@@ -479,6 +739,14 @@ func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error)
 			&activity.Object.Permalink,
 			&activity.Object.ObjectType,
 			&activity.Object.Content,
+			&activity.Object.MediaURL,
+			&activity.Object.MediaType,
+			&activity.Object.Width,
+			&activity.Object.Height,
+			&activity.Object.Duration,
+			&activity.Object.StartTime,
+			&activity.Object.EndTime,
+			&activity.Object.TargetURL,
 			&personID,
 			&personHost,
 			&personFirstSeen,
@@ -486,6 +754,7 @@ func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error)
 			&personDisplayName,
 			&personAvatar,
 			&personSummary,
+			&personProtocol,
 		); err != nil {
 			return nil, err
 		}
@@ -500,10 +769,50 @@ func (a *App) getPublicTimeline(args getPublicTimelineArgs) ([]Activity, error)
 				Avatar:      personAvatar,
 				Summary:     personSummary,
 			}
+
+			if personProtocol != nil {
+				activity.Actor.Protocol = *personProtocol
+			}
 		}
 
 		activities = append(activities, activity)
 	}
 
+	if len(activities) > 0 {
+		objectIDs := make([]string, len(activities))
+		for i, activity := range activities {
+			objectIDs[i] = activity.Object.ID
+		}
+
+		attachments, err := a.getAttachments(objectIDs...)
+		if err != nil {
+			return nil, errors.Wrap(err, "getPublicTimeline")
+		}
+
+		for i := range activities {
+			activities[i].Object.Attachments = attachments[activities[i].Object.ID]
+		}
+	}
+
 	return activities, nil
 }
+
+func (a *App) getFollowedPeople(userID string) ([]interface{}, error) {
+	rows, err := a.SQLDB.Query("select person_id from follows where user_id = $1", userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getFollowedPeople")
+	}
+	defer rows.Close()
+
+	var people []interface{}
+	for rows.Next() {
+		var personID string
+		if err := rows.Scan(&personID); err != nil {
+			return nil, errors.Wrap(err, "getFollowedPeople")
+		}
+
+		people = append(people, personID)
+	}
+
+	return people, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/umisama/go-sqlbuilder"
+
+	"fknsrs.biz/p/don/activitystreams"
+)
+
+func makeAttachment(objectID string, position int, e activitystreams.Attachment) Attachment {
+	attachment := Attachment{
+		ObjectID:    objectID,
+		Position:    position,
+		URL:         e.URL,
+		MediaType:   e.MediaType,
+		Description: e.Description,
+		Sensitive:   e.Sensitive,
+	}
+
+	if e.Length != 0 {
+		n := int64(e.Length)
+		attachment.Length = &n
+	}
+	if e.Width != 0 {
+		n := e.Width
+		attachment.Width = &n
+	}
+	if e.Height != 0 {
+		n := e.Height
+		attachment.Height = &n
+	}
+
+	return attachment
+}
+
+// getAttachments returns the attachments for a set of objects, keyed by
+// object id and in the order they appeared in the original document.
+func (a *App) getAttachments(objectIDs ...string) (map[string][]Attachment, error) {
+	ids := make([]interface{}, len(objectIDs))
+	for i, id := range objectIDs {
+		ids[i] = id
+	}
+
+	q, vars, err := sqlbuilder.Select(attachmentsTable).Columns(
+		attachmentsTable.C("object_id"),
+		attachmentsTable.C("position"),
+		attachmentsTable.C("url"),
+		attachmentsTable.C("media_type"),
+		attachmentsTable.C("length"),
+		attachmentsTable.C("width"),
+		attachmentsTable.C("height"),
+		attachmentsTable.C("description"),
+		attachmentsTable.C("sensitive"),
+	).Where(
+		attachmentsTable.C("object_id").In(ids...),
+	).OrderBy(false, attachmentsTable.C("object_id"), attachmentsTable.C("position")).ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "App.getAttachments")
+	}
+
+	rows, err := a.SQLDB.Query(q, vars...)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.getAttachments")
+	}
+	defer rows.Close()
+
+	m := make(map[string][]Attachment)
+	for rows.Next() {
+		var attachment Attachment
+		if err := rows.Scan(
+			&attachment.ObjectID,
+			&attachment.Position,
+			&attachment.URL,
+			&attachment.MediaType,
+			&attachment.Length,
+			&attachment.Width,
+			&attachment.Height,
+			&attachment.Description,
+			&attachment.Sensitive,
+		); err != nil {
+			return nil, errors.Wrap(err, "App.getAttachments")
+		}
+
+		m[attachment.ObjectID] = append(m[attachment.ObjectID], attachment)
+	}
+
+	return m, nil
+}
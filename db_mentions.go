@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/umisama/go-sqlbuilder"
+
+	"fknsrs.biz/p/don/acct"
+	"fknsrs.biz/p/don/activitystreams"
+)
+
+// mentionPersonID looks up the account for a mentioned person. The lookup
+// goes through the same cache as authors, so people we've seen before don't
+// cost a webfinger request.
+func (a *App) mentionPersonID(href string) *string {
+	accountURLString, _, err := a.AccountURLCache.Get(href, &activitystreams.Author{ID: href, URI: href})
+	if err != nil || len(accountURLString) == 0 {
+		return nil
+	}
+
+	accountURL, err := acct.FromString(string(accountURLString))
+	if err != nil {
+		return nil
+	}
+
+	s := accountURL.String()
+
+	return &s
+}
+
+// maxMentionLookups limits how many mentioned people are resolved for each
+// activity, since each one can cost a webfinger request. Any past that are
+// still recorded, just without a person.
+const maxMentionLookups = 10
+
+// makeMentions collects the mentions on an activity, resolving the people
+// it can. Groups and collections are stored by target alone.
+func (a *App) makeMentions(e activitystreams.ActivityLike) []Mention {
+	hm, ok := e.(activitystreams.HasMentions)
+	if !ok {
+		return nil
+	}
+
+	var l []Mention
+	var lookups int
+	for _, m := range hm.GetMentions() {
+		mention := Mention{
+			ActivityID: e.GetID(),
+			Target:     m.Href,
+			Kind:       m.Kind,
+		}
+
+		if m.Kind == activitystreams.MentionKindPerson && lookups < maxMentionLookups {
+			mention.PersonID = a.mentionPersonID(m.Href)
+			lookups++
+		}
+
+		l = append(l, mention)
+	}
+
+	return l
+}
+
+func insertMentions(tx Tx, l []Mention) error {
+	for _, mention := range l {
+		if _, err := tx.Exec("insert or ignore into mentions (activity_id, target, person_id, kind) values ($1, $2, $3, $4)", mention.ActivityID, mention.Target, mention.PersonID, mention.Kind); err != nil {
+			return errors.Wrap(err, "insertMentions")
+		}
+	}
+
+	return nil
+}
+
+// getMentions returns the most recent mentions of an account, newest first.
+func (a *App) getMentions(account string) ([]Mention, error) {
+	q, vars, err := sqlbuilder.Select(mentionsTable.
+		InnerJoin(activitiesTable, activitiesTable.C("id").Eq(mentionsTable.C("activity_id"))),
+	).Columns(
+		mentionsTable.C("activity_id"),
+		mentionsTable.C("target"),
+		mentionsTable.C("person_id"),
+		mentionsTable.C("kind"),
+	).Where(
+		mentionsTable.C("person_id").Eq("acct:"+strings.TrimPrefix(strings.TrimPrefix(account, "@"), "acct:")),
+	).OrderBy(true, activitiesTable.C("time")).Limit(timelinePageSize).ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "App.getMentions")
+	}
+
+	rows, err := a.SQLDB.Query(q, vars...)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.getMentions")
+	}
+	defer rows.Close()
+
+	var mentions []Mention
+	for rows.Next() {
+		var mention Mention
+		if err := rows.Scan(
+			&mention.ActivityID,
+			&mention.Target,
+			&mention.PersonID,
+			&mention.Kind,
+		); err != nil {
+			return nil, errors.Wrap(err, "App.getMentions")
+		}
+
+		mentions = append(mentions, mention)
+	}
+
+	return mentions, nil
+}
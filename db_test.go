@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/don/activitystreams"
+)
+
+const testRSSFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>A Blog</title>
+    <link>https://blog.example.com/</link>
+    <description>Things I wrote</description>
+    <image><url>https://blog.example.com/logo.png</url></image>
+    <item>
+      <title>First post</title>
+      <link>https://blog.example.com/posts/1</link>
+      <guid>https://blog.example.com/posts/1</guid>
+      <description>Hello there</description>
+      <pubDate>Mon, 01 May 2017 00:00:00 +0000</pubDate>
+    </item>
+  </channel>
+</rss>`
+
+func TestSaveFeedAuthor(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	f, err := activitystreams.ParseAny("application/rss+xml", []byte(testRSSFeed))
+	assert.NoError(t, err)
+	assert.Len(t, f.Activities, 1)
+
+	f.SetFetchedFrom("https://blog.example.com/feed.xml")
+
+	assert.NoError(t, a.saveActivity(&f.Activities[0]))
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	assert.Len(t, activities, 1)
+
+	if assert.NotNil(t, activities[0].Actor) {
+		assert.Equal(t, "https://blog.example.com/feed.xml", activities[0].Actor.ID)
+		assert.Equal(t, "https://blog.example.com/", activities[0].Actor.Permalink)
+		assert.Equal(t, "blog.example.com", activities[0].Actor.Host)
+		assert.Equal(t, personProtocolFeed, activities[0].Actor.Protocol)
+		assert.Equal(t, "A Blog", *activities[0].Actor.DisplayName)
+		assert.Equal(t, "https://blog.example.com/logo.png", *activities[0].Actor.Avatar)
+	}
+}
+
+func TestSaveFeedAuthorImpostor(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	// the same channel served from somewhere else doesn't get to be the
+	// same person, or link to the real blog
+	f, err := activitystreams.ParseAny("application/rss+xml", []byte(testRSSFeed))
+	assert.NoError(t, err)
+
+	f.SetFetchedFrom("https://evil.example.org/feed.xml")
+
+	assert.NoError(t, a.saveActivity(&f.Activities[0]))
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	assert.Len(t, activities, 1)
+
+	if assert.NotNil(t, activities[0].Actor) {
+		assert.Equal(t, "https://evil.example.org/feed.xml", activities[0].Actor.ID)
+		assert.Equal(t, "https://evil.example.org/feed.xml", activities[0].Actor.Permalink)
+		assert.Equal(t, "evil.example.org", activities[0].Actor.Host)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func (a *App) getUserByUsername(username string) (*User, error) {
+	var u User
+	if err := a.SQLDB.QueryRow("select id, created_at, username, email, display_name, avatar from users where username = $1", username).Scan(&u.ID, &u.CreatedAt, &u.Username, &u.Email, &u.DisplayName, &u.Avatar); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "App.getUserByUsername")
+	}
+
+	return &u, nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"database/sql"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/acct"
+	"fknsrs.biz/p/don/activitystreams"
+)
+
+var (
+	errVerbNoActor  = errors.New("activity doesn't have a known actor")
+	errVerbNotOwner = errors.New("object doesn't belong to the activity's actor")
+)
+
+const verbPost = "http://activitystrea.ms/schema/1.0/post"
+
+// shortVerb strips the namespace off a verb, so "post" and
+// "http://activitystrea.ms/schema/1.0/post" come out the same. OStatus uses
+// its own namespace for some verbs, like unfollow, and this covers those
+// too.
+func shortVerb(v string) string {
+	if i := strings.LastIndexAny(v, "/#"); i != -1 {
+		return v[i+1:]
+	}
+
+	return v
+}
+
+// canModifyObject checks that person owns the object. The owner is whoever
+// first posted it; for objects we only know about through a share or a
+// favourite, the object has to live on the same host as the person.
+func canModifyObject(tx Tx, objectID string, person *Person) (bool, error) {
+	var postedBy sql.NullString
+	if err := tx.QueryRow("select posted_by from objects where id = $1", objectID).Scan(&postedBy); err != nil && err != sql.ErrNoRows {
+		return false, errors.Wrap(err, "canModifyObject")
+	}
+
+	if postedBy.Valid {
+		return postedBy.String == person.ID, nil
+	}
+
+	host := objectHost(objectID)
+
+	return host != "" && strings.EqualFold(host, personHost(person)), nil
+}
+
+// claimObject records person as the owner of an object, unless it already
+// has one.
+func claimObject(db execer, objectID string, person *Person) error {
+	if _, err := db.Exec("update objects set posted_by = $1 where id = $2 and posted_by is null", person.ID, objectID); err != nil {
+		return errors.Wrap(err, "claimObject")
+	}
+
+	return nil
+}
+
+// objectHost works out which host an object id belongs to. Besides urls,
+// this understands tag uris, which is what most OStatus servers use.
+func objectHost(id string) string {
+	if strings.HasPrefix(id, "tag:") {
+		authority := strings.SplitN(strings.TrimPrefix(id, "tag:"), ",", 2)[0]
+		if i := strings.LastIndex(authority, "@"); i != -1 {
+			authority = authority[i+1:]
+		}
+
+		return authority
+	}
+
+	u, err := url.Parse(id)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+// personHost returns the host a person's account lives on.
+func personHost(p *Person) string {
+	if a, err := acct.FromString(p.ID); err == nil {
+		return a.Host
+	}
+
+	if u, err := url.Parse(p.ID); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+
+	return p.Host
+}
+
+// tombstoneObject strips an object down to its id and marks it as deleted.
+// The row is created if it doesn't exist yet, so that a delete arriving
+// before the post doesn't get undone when the post turns up. That only holds
+// if the post turns up from the same actor; see clearUnconfirmedTombstone.
+func (a *App) tombstoneObject(objectID string, person *Person) error {
+	tx, err := a.SQLDB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "App.tombstoneObject")
+	}
+	defer tx.Rollback()
+
+	if ok, err := canModifyObject(tx, objectID, person); err != nil {
+		return errors.Wrap(err, "App.tombstoneObject")
+	} else if !ok {
+		return errors.Wrap(errVerbNotOwner, "App.tombstoneObject")
+	}
+
+	if _, err := tx.Exec("insert into objects (id) select $1 where not exists (select 1 from objects where id = $1)", objectID); err != nil {
+		return errors.Wrap(err, "App.tombstoneObject")
+	}
+
+	if _, err := tx.Exec("update objects set name = null, summary = null, representative_image = null, content = null, media_url = null, media_type = null, width = null, height = null, duration = null, start_time = null, end_time = null, target_url = null, deleted_at = $1, deleted_by = $2 where id = $3 and deleted_at is null", time.Now(), person.ID, objectID); err != nil {
+		return errors.Wrap(err, "App.tombstoneObject")
+	}
+
+	if _, err := tx.Exec("delete from attachments where object_id = $1", objectID); err != nil {
+		return errors.Wrap(err, "App.tombstoneObject")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "App.tombstoneObject")
+	}
+
+	return nil
+}
+
+// clearUnconfirmedTombstone removes a tombstone that was left before the
+// object was posted, if whoever left it isn't the one posting it now. Without
+// this, anyone could hide a post in advance by deleting its id.
+func (a *App) clearUnconfirmedTombstone(objectID string, actorID sql.NullString) error {
+	if _, err := a.SQLDB.Exec("delete from objects where id = $1 and deleted_at is not null and deleted_by is not null and deleted_by is not $2 and not exists (select 1 from activities where object = $1 and verb in ($3, 'post') and actor = objects.deleted_by)", objectID, actorID, verbPost); err != nil {
+		return errors.Wrap(err, "App.clearUnconfirmedTombstone")
+	}
+
+	return nil
+}
+
+// reviseObject replaces the stored copy of an object with a new one.
+// Objects we've never seen are saved as-is, and deleted ones stay deleted.
+func (a *App) reviseObject(o activitystreams.ObjectLike, person *Person) error {
+	object := makeObject(o)
+
+	tx, err := a.SQLDB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "App.reviseObject")
+	}
+	defer tx.Rollback()
+
+	if ok, err := canModifyObject(tx, object.ID, person); err != nil {
+		return errors.Wrap(err, "App.reviseObject")
+	} else if !ok {
+		return errors.Wrap(errVerbNotOwner, "App.reviseObject")
+	}
+
+	var deletedAt *time.Time
+	if err := tx.QueryRow("select deleted_at from objects where id = $1", object.ID).Scan(&deletedAt); err == sql.ErrNoRows {
+		if err := tx.Rollback(); err != nil {
+			return errors.Wrap(err, "App.reviseObject")
+		}
+
+		if _, err := a.saveObject(o); err != nil {
+			return errors.Wrap(err, "App.reviseObject")
+		}
+
+		if err := claimObject(a.SQLDB, object.ID, person); err != nil {
+			return errors.Wrap(err, "App.reviseObject")
+		}
+
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "App.reviseObject")
+	}
+
+	if deletedAt != nil {
+		return nil
+	}
+
+	if _, err := tx.Exec("update objects set name = $1, summary = $2, representative_image = $3, permalink = $4, object_type = $5, content = $6, media_url = $7, media_type = $8, width = $9, height = $10, duration = $11, start_time = $12, end_time = $13, target_url = $14 where id = $15", object.Name, object.Summary, object.RepresentativeImage, object.Permalink, object.ObjectType, object.Content, object.MediaURL, object.MediaType, object.Width, object.Height, object.Duration, object.StartTime, object.EndTime, object.TargetURL, object.ID); err != nil {
+		return errors.Wrap(err, "App.reviseObject")
+	}
+
+	if _, err := tx.Exec("delete from attachments where object_id = $1", object.ID); err != nil {
+		return errors.Wrap(err, "App.reviseObject")
+	}
+
+	if err := insertAttachments(tx, object.Attachments); err != nil {
+		return errors.Wrap(err, "App.reviseObject")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "App.reviseObject")
+	}
+
+	return nil
+}
+
+func (a *App) storeLike(person *Person, objectID, activityID string, t time.Time) error {
+	if _, err := a.SQLDB.Exec("insert or ignore into likes (person_id, object_id, activity_id, created_at) values ($1, $2, $3, $4)", person.ID, objectID, activityID, t); err != nil {
+		return errors.Wrap(err, "App.storeLike")
+	}
+
+	return nil
+}
+
+func (a *App) deleteLike(person *Person, objectID string) error {
+	if _, err := a.SQLDB.Exec("delete from likes where person_id = $1 and object_id = $2", person.ID, objectID); err != nil {
+		return errors.Wrap(err, "App.deleteLike")
+	}
+
+	return nil
+}
+
+// followTarget figures out what a follow is pointed at. People we can
+// resolve are recorded by account, everything else by id.
+func (a *App) followTarget(o activitystreams.ObjectLike) (string, error) {
+	if p, ok := o.(*activitystreams.Author); ok {
+		person, err := a.savePerson(p)
+		if err != nil {
+			return "", errors.Wrap(err, "App.followTarget")
+		}
+		if person != nil {
+			return person.ID, nil
+		}
+	}
+
+	return o.GetID(), nil
+}
+
+func (a *App) storePersonFollow(person *Person, target, activityID string, t time.Time) error {
+	if _, err := a.SQLDB.Exec("insert or ignore into person_follows (follower_id, target, activity_id, created_at) values ($1, $2, $3, $4)", person.ID, target, activityID, t); err != nil {
+		return errors.Wrap(err, "App.storePersonFollow")
+	}
+
+	return nil
+}
+
+func (a *App) deletePersonFollow(person *Person, target string) error {
+	if _, err := a.SQLDB.Exec("delete from person_follows where follower_id = $1 and target = $2", person.ID, target); err != nil {
+		return errors.Wrap(err, "App.deletePersonFollow")
+	}
+
+	return nil
+}
+
+// findSharedActivity finds the activity that originally posted whatever a
+// share is pointing at. The shared object might be the original activity
+// itself, or just the object it posted.
+func findSharedActivity(tx Tx, e activitystreams.ActivityLike) (sql.NullString, error) {
+	var id sql.NullString
+
+	if err := tx.QueryRow("select id from activities where (id = $1 or (object = $1 and verb in ($2, 'post'))) and id != $3 order by time asc limit 1", e.GetObject().GetID(), verbPost, e.GetID()).Scan(&id); err != nil && err != sql.ErrNoRows {
+		return id, errors.Wrap(err, "findSharedActivity")
+	}
+
+	return id, nil
+}
+
+// handleVerb deals with the verbs that change existing state rather than
+// adding something new to the timeline. It returns false for anything it
+// doesn't recognise, so the activity can be stored as-is.
+func (a *App) handleVerb(e activitystreams.ActivityLike, person *Person) (bool, error) {
+	verb := shortVerb(e.GetVerb())
+
+	switch verb {
+	case "delete", "update", "favorite", "like", "unfavorite", "unlike", "follow", "unfollow", "stop-following":
+		// these all need to know who's doing them
+	default:
+		return false, nil
+	}
+
+	if person == nil {
+		return true, errors.Wrap(errVerbNoActor, "App.handleVerb")
+	}
+
+	o := e.GetObject()
+	if o == e {
+		// there's nothing to act on
+		return true, nil
+	}
+
+	var err error
+	switch verb {
+	case "delete":
+		err = a.tombstoneObject(o.GetID(), person)
+	case "update":
+		err = a.reviseObject(o, person)
+	case "favorite", "like":
+		err = a.storeLike(person, o.GetID(), e.GetID(), e.GetTime())
+	case "unfavorite", "unlike":
+		err = a.deleteLike(person, o.GetID())
+	case "follow", "unfollow", "stop-following":
+		var target string
+		if target, err = a.followTarget(o); err == nil {
+			if verb == "follow" {
+				err = a.storePersonFollow(person, target, e.GetID(), e.GetTime())
+			} else {
+				err = a.deletePersonFollow(person, target)
+			}
+		}
+	}
+
+	return true, errors.Wrap(err, "App.handleVerb")
+}
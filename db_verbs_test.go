@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/don/activitystreams"
+)
+
+func makeTestPost(t *testing.T, id, content string) *activitystreams.Entry {
+	f, err := activitystreams.Parse([]byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:activity="http://activitystrea.ms/spec/1.0/">
+  <id>https://example.com/feed</id>
+  <entry>
+    <id>%s</id>
+    <title>a note</title>
+    <activity:object-type>http://activitystrea.ms/schema/1.0/note</activity:object-type>
+    <activity:verb>http://activitystrea.ms/schema/1.0/post</activity:verb>
+    <published>2017-05-01T00:00:00Z</published>
+    <content type="html">%s</content>
+    <link rel="alternate" type="text/html" href="%s"/>
+  </entry>
+</feed>`, id, content, id)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &f.Activities[0]
+}
+
+func TestTombstoneBeforePost(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	owner := &Person{ID: "acct:owner@example.com"}
+	other := &Person{ID: "acct:other@example.com"}
+	stranger := &Person{ID: "acct:stranger@example.org"}
+
+	// nobody can delete things on other hosts
+	assert.Error(t, a.tombstoneObject("https://example.com/notes/1", stranger))
+
+	// someone else deleting the post in advance doesn't stop it showing up
+	assert.NoError(t, a.tombstoneObject("https://example.com/notes/1", other))
+	_, err := a.storeActivity(makeTestPost(t, "https://example.com/notes/1", "hello"), owner)
+	assert.NoError(t, err)
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	assert.Len(t, activities, 1)
+	assert.Equal(t, "hello", *activities[0].Object.Content)
+
+	// but the owner deleting it in advance does
+	assert.NoError(t, a.tombstoneObject("https://example.com/notes/2", owner))
+	_, err = a.storeActivity(makeTestPost(t, "https://example.com/notes/2", "hello again"), owner)
+	assert.NoError(t, err)
+
+	activities, err = a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	assert.Len(t, activities, 1)
+
+	// and once the owner has posted it, nobody else can delete it
+	assert.Error(t, a.tombstoneObject("https://example.com/notes/1", other))
+	assert.NoError(t, a.tombstoneObject("https://example.com/notes/1", owner))
+
+	activities, err = a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	assert.Len(t, activities, 0)
+}
+
+func TestObjectOwnership(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	owner := &Person{ID: "acct:owner@example.com"}
+	other := &Person{ID: "acct:other@example.com"}
+	stranger := &Person{ID: "acct:stranger@example.org"}
+
+	_, err := a.storeActivity(makeTestPost(t, "https://example.com/notes/1", "hello"), owner)
+	assert.NoError(t, err)
+
+	// posting someone else's id again doesn't make it yours, and doesn't
+	// stop the owner from changing it
+	_, err = a.storeActivity(makeTestPost(t, "https://example.com/notes/1", "mine now"), other)
+	assert.NoError(t, err)
+
+	assert.Error(t, a.reviseObject(makeTestPost(t, "https://example.com/notes/1", "edited"), other))
+	assert.NoError(t, a.reviseObject(makeTestPost(t, "https://example.com/notes/1", "edited"), owner))
+
+	var content string
+	assert.NoError(t, a.SQLDB.QueryRow("select content from objects where id = $1", "https://example.com/notes/1").Scan(&content))
+	assert.Equal(t, "edited", content)
+
+	// objects we've only seen shared belong to their host
+	_, err = a.saveObject(makeTestPost(t, "tag:example.com,2017:notes/2", "shared"))
+	assert.NoError(t, err)
+
+	assert.Error(t, a.tombstoneObject("tag:example.com,2017:notes/2", stranger))
+	assert.NoError(t, a.tombstoneObject("tag:example.com,2017:notes/2", owner))
+}
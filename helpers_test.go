@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/boltdb/bolt"
+	"github.com/umisama/go-sqlbuilder"
+	"github.com/umisama/go-sqlbuilder/dialects"
+)
+
+// newTestApp sets up an App backed by a throwaway database with all the
+// migrations applied. The returned function cleans it up again.
+func newTestApp(t *testing.T) (*App, func()) {
+	*publicURL = "https://don.example.com"
+	*keyEncryptionKey = make([]byte, 32)
+
+	sqlbuilder.SetDialect(dialects.Postgresql{})
+
+	dir, err := ioutil.TempDir("", "don-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDB, err := sql.Open("sqlite3", filepath.Join(dir, "don.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boltDB, err := bolt.Open(filepath.Join(dir, "don.cache"), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := rice.Config{LocateOrder: []rice.LocateMethod{rice.LocateWorkingDirectory, rice.LocateFS}}
+	if err := migrate(sqlDB, cfg.MustFindBox("migrations")); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewApp(sqlDB, boltDB, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a, func() {
+		boltDB.Close()
+		sqlDB.Close()
+		os.RemoveAll(dir)
+	}
+}
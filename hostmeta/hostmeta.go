@@ -1,10 +1,13 @@
 package hostmeta
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/timewasted/go-accept-headers"
 
 	"fknsrs.biz/p/don/commonxml"
 )
@@ -40,3 +43,102 @@ type Response struct {
 	commonxml.HasLinks
 	commonxml.HasProperties
 }
+
+type hostmetaResponseXML struct {
+	XMLName  xml.Name             `xml:"http://docs.oasis-open.org/ns/xri/xrd-1.0 XRD"`
+	Property []commonxml.Property `xml:"Property"`
+	Link     []commonxml.Link     `xml:"Link"`
+}
+
+func (r *Response) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v hostmetaResponseXML
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return errors.Wrap(err, "Response.UnmarshalXML")
+	}
+
+	r.XMLName = v.XMLName
+	r.Link = v.Link
+	r.Property = v.Property
+
+	return nil
+}
+
+func (r *Response) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.Encode(hostmetaResponseXML{
+		Property: r.Property,
+		Link:     r.Link,
+	})
+}
+
+type hostmetaResponseJSON struct {
+	Properties map[string]*string `json:"properties,omitempty"`
+	Links      []hostmetaLinkJSON `json:"links,omitempty"`
+}
+
+type hostmetaLinkJSON struct {
+	Rel      string `json:"rel,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Href     string `json:"href,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+func (r *Response) MarshalJSON() ([]byte, error) {
+	var v hostmetaResponseJSON
+
+	for _, p := range r.Property {
+		if v.Properties == nil {
+			v.Properties = make(map[string]*string)
+		}
+
+		if p.Value == "" {
+			v.Properties[p.Type] = nil
+		} else {
+			value := p.Value
+			v.Properties[p.Type] = &value
+		}
+	}
+
+	for _, l := range r.Link {
+		v.Links = append(v.Links, hostmetaLinkJSON{
+			Rel:      l.Rel,
+			Type:     l.Type,
+			Href:     l.Href,
+			Template: l.Template,
+		})
+	}
+
+	return json.Marshal(v)
+}
+
+type Handler struct{ Response *Response }
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	ct := "application/xrd+xml"
+
+	if strings.HasSuffix(r.URL.Path, ".json") {
+		ct = "application/jrd+json"
+	} else if s, err := accept.Parse(r.Header.Get("accept")).Negotiate("application/xrd+xml", "application/xml", "text/xml", "application/jrd+json", "application/json"); err == nil && s != "" {
+		ct = s
+	}
+
+	switch ct {
+	case "application/jrd+json", "application/json":
+		rw.Header().Set("content-type", ct)
+		rw.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(rw).Encode(h.Response); err != nil {
+			panic(err)
+		}
+	default:
+		rw.Header().Set("content-type", ct)
+		rw.WriteHeader(http.StatusOK)
+
+		if _, err := rw.Write([]byte(xml.Header)); err != nil {
+			panic(err)
+		}
+
+		if err := xml.NewEncoder(rw).Encode(h.Response); err != nil {
+			panic(err)
+		}
+	}
+}
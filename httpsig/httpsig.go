@@ -0,0 +1,367 @@
+// Package httpsig implements the subset of draft-cavage-http-signatures that
+// the fediverse uses: rsa-sha256 signatures over (request-target), host, date
+// and digest.
+package httpsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	AlgRSASHA256 = "rsa-sha256"
+	AlgHS2019    = "hs2019"
+
+	RequestTarget = "(request-target)"
+
+	DefaultMaxSkew = time.Minute * 5
+)
+
+var (
+	ErrNoSignature          = errors.New("httpsig: request isn't signed")
+	ErrMalformedSignature   = errors.New("httpsig: couldn't parse signature header")
+	ErrUnsupportedAlgorithm = errors.New("httpsig: unsupported algorithm")
+	ErrMissingHeader        = errors.New("httpsig: required header isn't signed")
+	ErrClockSkew            = errors.New("httpsig: date is outside the allowed window")
+	ErrDigestMismatch       = errors.New("httpsig: digest doesn't match body")
+	ErrInvalidSignature     = errors.New("httpsig: signature doesn't match")
+	ErrInvalidKey           = errors.New("httpsig: couldn't parse public key")
+)
+
+// DefaultHeaders are signed when a Signer doesn't say otherwise. Digest is
+// only included for requests that have a body.
+var DefaultHeaders = []string{RequestTarget, "host", "date", "digest"}
+
+type Signer struct {
+	KeyID   string
+	Key     *rsa.PrivateKey
+	Headers []string
+}
+
+func NewSigner(keyID string, key *rsa.PrivateKey) *Signer {
+	return &Signer{KeyID: keyID, Key: key}
+}
+
+// Sign adds Date, Digest and Signature headers to r. The body has to be
+// passed in separately since it's likely already been wrapped in a reader.
+func (s *Signer) Sign(r *http.Request, body []byte) error {
+	if r.Header.Get("date") == "" {
+		r.Header.Set("date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	if body != nil {
+		r.Header.Set("digest", Digest(body))
+	}
+
+	headers := s.Headers
+	if headers == nil {
+		headers = DefaultHeaders
+	}
+
+	var signed []string
+	for _, h := range headers {
+		if h == RequestTarget || h == "host" || r.Header.Get(h) != "" {
+			signed = append(signed, strings.ToLower(h))
+		}
+	}
+
+	h := sha256.Sum256([]byte(signingString(r, signed)))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, h[:])
+	if err != nil {
+		return errors.Wrap(err, "Signer.Sign")
+	}
+
+	r.Header.Set("signature", `keyId="`+s.KeyID+`",algorithm="`+AlgRSASHA256+`",headers="`+strings.Join(signed, " ")+`",signature="`+base64.StdEncoding.EncodeToString(sig)+`"`)
+
+	return nil
+}
+
+func Digest(body []byte) string {
+	h := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(h[:])
+}
+
+func signingString(r *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+
+	for i, h := range headers {
+		switch h {
+		case RequestTarget:
+			lines[i] = h + ": " + strings.ToLower(r.Method) + " " + r.URL.RequestURI()
+		case "host":
+			host := r.Header.Get("host")
+			if host == "" {
+				host = r.Host
+			}
+			if host == "" {
+				host = r.URL.Host
+			}
+			lines[i] = h + ": " + host
+		default:
+			lines[i] = h + ": " + strings.Join(r.Header[http.CanonicalHeaderKey(h)], ", ")
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+type Signature struct {
+	KeyID     string
+	Algorithm string
+	Headers   []string
+	Value     []byte
+}
+
+// ParseSignature reads the Signature header, or an Authorization header
+// using the Signature scheme.
+func ParseSignature(r *http.Request) (*Signature, error) {
+	v := r.Header.Get("signature")
+	if v == "" {
+		if a := r.Header.Get("authorization"); strings.HasPrefix(a, "Signature ") {
+			v = strings.TrimPrefix(a, "Signature ")
+		}
+	}
+	if v == "" {
+		return nil, errors.Wrap(ErrNoSignature, "ParseSignature")
+	}
+
+	s := Signature{Headers: []string{"date"}}
+
+	for _, p := range splitParams(v) {
+		i := strings.Index(p, "=")
+		if i == -1 {
+			return nil, errors.Wrap(ErrMalformedSignature, "ParseSignature")
+		}
+
+		k, val := strings.TrimSpace(p[:i]), strings.Trim(strings.TrimSpace(p[i+1:]), `"`)
+
+		switch k {
+		case "keyId":
+			s.KeyID = val
+		case "algorithm":
+			s.Algorithm = val
+		case "headers":
+			s.Headers = strings.Fields(strings.ToLower(val))
+		case "signature":
+			d, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return nil, errors.Wrap(ErrMalformedSignature, "ParseSignature")
+			}
+			s.Value = d
+		}
+	}
+
+	if s.KeyID == "" || s.Value == nil {
+		return nil, errors.Wrap(ErrMalformedSignature, "ParseSignature")
+	}
+
+	return &s, nil
+}
+
+// splitParams splits on commas that aren't inside quotes.
+func splitParams(s string) []string {
+	var l []string
+	var quoted bool
+	var start int
+
+	for i, c := range s {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				l = append(l, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(l, s[start:])
+}
+
+func (s *Signature) has(header string) bool {
+	for _, h := range s.Headers {
+		if h == header {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParsePublicKeyPEM accepts both PKIX and PKCS1 encoded RSA public keys,
+// since both turn up in actor documents.
+func ParsePublicKeyPEM(s string) (*rsa.PublicKey, error) {
+	b, _ := pem.Decode([]byte(s))
+	if b == nil {
+		return nil, errors.Wrap(ErrInvalidKey, "ParsePublicKeyPEM")
+	}
+
+	if k, err := x509.ParsePKIXPublicKey(b.Bytes); err == nil {
+		if pk, ok := k.(*rsa.PublicKey); ok {
+			return pk, nil
+		}
+
+		return nil, errors.Wrap(ErrInvalidKey, "ParsePublicKeyPEM")
+	}
+
+	var k struct {
+		N *big.Int
+		E int
+	}
+	if _, err := asn1.Unmarshal(b.Bytes, &k); err == nil && k.N != nil {
+		return &rsa.PublicKey{N: k.N, E: k.E}, nil
+	}
+
+	return nil, errors.Wrap(ErrInvalidKey, "ParsePublicKeyPEM")
+}
+
+type KeyResolver interface {
+	ResolveKey(keyID string) (*rsa.PublicKey, error)
+}
+
+type KeyResolverFunc func(keyID string) (*rsa.PublicKey, error)
+
+func (fn KeyResolverFunc) ResolveKey(keyID string) (*rsa.PublicKey, error) {
+	return fn(keyID)
+}
+
+type Verifier struct {
+	Resolver KeyResolver
+	MaxSkew  time.Duration
+	Now      func() time.Time
+}
+
+func NewVerifier(resolver KeyResolver) *Verifier {
+	return &Verifier{Resolver: resolver, MaxSkew: DefaultMaxSkew}
+}
+
+// Verify checks the signature on r, returning the key id that signed it.
+// Requests with a body must sign a matching Digest header.
+func (v *Verifier) Verify(r *http.Request, body []byte) (string, error) {
+	s, err := ParseSignature(r)
+	if err != nil {
+		return "", errors.Wrap(err, "Verifier.Verify")
+	}
+
+	if s.Algorithm != "" && s.Algorithm != AlgRSASHA256 && s.Algorithm != AlgHS2019 {
+		return "", errors.Wrap(ErrUnsupportedAlgorithm, "Verifier.Verify")
+	}
+
+	if !s.has(RequestTarget) || !s.has("host") || !s.has("date") {
+		return "", errors.Wrap(ErrMissingHeader, "Verifier.Verify")
+	}
+
+	date, err := http.ParseTime(r.Header.Get("date"))
+	if err != nil {
+		return "", errors.Wrap(ErrClockSkew, "Verifier.Verify")
+	}
+
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	maxSkew := v.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = DefaultMaxSkew
+	}
+
+	if d := now.Sub(date); d > maxSkew || d < -maxSkew {
+		return "", errors.Wrap(ErrClockSkew, "Verifier.Verify")
+	}
+
+	if len(body) > 0 {
+		if !s.has("digest") {
+			return "", errors.Wrap(ErrMissingHeader, "Verifier.Verify")
+		}
+
+		if !digestMatches(r.Header.Get("digest"), body) {
+			return "", errors.Wrap(ErrDigestMismatch, "Verifier.Verify")
+		}
+	}
+
+	key, err := v.Resolver.ResolveKey(s.KeyID)
+	if err != nil {
+		return "", errors.Wrap(err, "Verifier.Verify")
+	}
+
+	h := sha256.Sum256([]byte(signingString(r, s.Headers)))
+
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, h[:], s.Value); err != nil {
+		return "", errors.Wrap(ErrInvalidSignature, "Verifier.Verify")
+	}
+
+	return s.KeyID, nil
+}
+
+func digestMatches(header string, body []byte) bool {
+	want := Digest(body)
+
+	for _, d := range strings.Split(header, ",") {
+		d = strings.TrimSpace(d)
+
+		if i := strings.Index(d, "="); i != -1 && strings.EqualFold(d[:i], "SHA-256") && d[i+1:] == want[len("SHA-256="):] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Transport signs every outgoing request that isn't signed already.
+type Transport struct {
+	Base   http.RoundTripper
+	Signer *Signer
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if r.Header.Get("signature") != "" || t.Signer == nil {
+		return base.RoundTrip(r)
+	}
+
+	// RoundTrippers aren't supposed to modify the request they're given
+	c := new(http.Request)
+	*c = *r
+	c.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		c.Header[k] = append([]string(nil), v...)
+	}
+
+	var body []byte
+	if r.Body != nil {
+		d, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "Transport.RoundTrip")
+		}
+
+		body = d
+		c.Body = ioutil.NopCloser(bytes.NewReader(d))
+	}
+
+	if err := t.Signer.Sign(c, body); err != nil {
+		return nil, errors.Wrap(err, "Transport.RoundTrip")
+	}
+
+	return base.RoundTrip(c)
+}
@@ -0,0 +1,108 @@
+package httpsig
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = func() *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}()
+
+func testVerifier() *Verifier {
+	return NewVerifier(KeyResolverFunc(func(keyID string) (*rsa.PublicKey, error) {
+		if keyID != "https://a.example/users/alice#main-key" {
+			return nil, errors.New("unknown key")
+		}
+
+		return &testKey.PublicKey, nil
+	}))
+}
+
+// incoming turns a client request into what a server would see.
+func incoming(r *http.Request) *http.Request {
+	s, _ := http.NewRequest(r.Method, r.URL.RequestURI(), nil)
+	s.Host = r.URL.Host
+	s.Header = r.Header
+	return s
+}
+
+func signedRequest(t *testing.T, body []byte) *http.Request {
+	r, err := http.NewRequest("POST", "https://b.example/users/bob/inbox", bytes.NewReader(body))
+	assert.NoError(t, err)
+
+	assert.NoError(t, NewSigner("https://a.example/users/alice#main-key", testKey).Sign(r, body))
+
+	return r
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"Follow"}`)
+	r := signedRequest(t, body)
+
+	assert.Equal(t, Digest(body), r.Header.Get("digest"))
+	assert.Contains(t, r.Header.Get("signature"), `headers="(request-target) host date digest"`)
+
+	keyID, err := testVerifier().Verify(incoming(r), body)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://a.example/users/alice#main-key", keyID)
+}
+
+func TestVerifyDigestMismatch(t *testing.T) {
+	r := signedRequest(t, []byte(`{"type":"Follow"}`))
+
+	_, err := testVerifier().Verify(incoming(r), []byte(`{"type":"Delete"}`))
+	assert.Equal(t, ErrDigestMismatch, errors.Cause(err))
+}
+
+func TestVerifyClockSkew(t *testing.T) {
+	body := []byte(`{}`)
+	r := signedRequest(t, body)
+
+	v := testVerifier()
+	v.Now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	_, err := v.Verify(incoming(r), body)
+	assert.Equal(t, ErrClockSkew, errors.Cause(err))
+}
+
+func TestVerifyTampered(t *testing.T) {
+	body := []byte(`{}`)
+	r := signedRequest(t, body)
+
+	s := incoming(r)
+	s.URL.Path = "/users/carol/inbox"
+
+	_, err := testVerifier().Verify(s, body)
+	assert.Equal(t, ErrInvalidSignature, errors.Cause(err))
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/inbox", nil)
+
+	_, err := testVerifier().Verify(r, nil)
+	assert.Equal(t, ErrNoSignature, errors.Cause(err))
+}
+
+func TestParseSignature(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("signature", `keyId="https://a.example/actor#main-key",algorithm="hs2019",headers="(request-target) host date",signature="c2ln"`)
+
+	s, err := ParseSignature(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://a.example/actor#main-key", s.KeyID)
+	assert.Equal(t, AlgHS2019, s.Algorithm)
+	assert.Equal(t, []string{RequestTarget, "host", "date"}, s.Headers)
+	assert.Equal(t, []byte("sig"), s.Value)
+}
@@ -1,6 +1,7 @@
 package main // import "fknsrs.biz/p/don"
 
 import (
+	"crypto/aes"
 	"crypto/tls"
 	"database/sql"
 	"encoding/json"
@@ -20,7 +21,6 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
 	"github.com/gorilla/sessions"
-	"github.com/jtacoma/uritemplates"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/meatballhat/negroni-logrus"
 	"github.com/sebest/xff"
@@ -30,8 +30,12 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 
 	"fknsrs.biz/p/don/acct"
+	"fknsrs.biz/p/don/activitypub"
 	"fknsrs.biz/p/don/activitystreams"
 	"fknsrs.biz/p/don/hostmeta"
+	"fknsrs.biz/p/don/httpsig"
+	"fknsrs.biz/p/don/nodeinfo"
+	"fknsrs.biz/p/don/poller"
 	"fknsrs.biz/p/don/pubsub"
 	"fknsrs.biz/p/don/react"
 	"fknsrs.biz/p/don/webfinger"
@@ -45,6 +49,11 @@ var (
 	publicURL             = app.Flag("public_url", "URL to use for callbacks etc.").Envar("PUBLIC_URL").Required().String()
 	logLevel              = app.Flag("log_level", "How much to log.").Default("INFO").Envar("LOG_LEVEL").Enum("DEBUG", "INFO", "WARN", "ERROR", "FATAL", "PANIC")
 	pubsubRefreshInterval = app.Flag("pubsub_refresh_interval", "PubSub subscription refresh interval.").Default("15m").Envar("PUBSUB_REFRESH_INTERVAL").Duration()
+	pubsubLease           = app.Flag("pubsub_lease", "PubSub subscription lease to ask hubs for.").Default("168h").Envar("PUBSUB_LEASE").Duration()
+	backfillMaxPages      = app.Flag("backfill_max_pages", "How many pages of an account's feed to fetch per backfill.").Default("10").Envar("BACKFILL_MAX_PAGES").Int()
+	backfillMaxAge        = app.Flag("backfill_max_age", "How far back in an account's history to backfill.").Default("2160h").Envar("BACKFILL_MAX_AGE").Duration()
+	feedPollInterval      = app.Flag("feed_poll_interval", "How often to check for hubless feeds that are due to be polled.").Default("1m").Envar("FEED_POLL_INTERVAL").Duration()
+	pubsubVerifyTimeout   = app.Flag("pubsub_verify_timeout", "How long to wait for a hub to verify a subscription before asking again.").Default("30m").Envar("PUBSUB_VERIFY_TIMEOUT").Duration()
 	recordDocuments       = app.Flag("record_documents", "Record all XML documents for debugging.").Envar("RECORD_DOCUMENTS").Bool()
 	reactRenderer         = app.Flag("react_renderer", "React server rendering strategy.").Envar("REACT_RENDERER").Default("duktape").Enum("duktape", "node")
 	reactProcesses        = app.Flag("react_processes", "React server rendering process count.").Envar("REACT_PROCESSES").Default("4").Int()
@@ -52,6 +61,12 @@ var (
 	cookieSigningKey      = app.Flag("cookie_signing_key", "Key for signing cookies.").Envar("COOKIE_SIGNING_KEY").Required().HexBytes()
 	cookieEncryptionKey   = app.Flag("cookie_encryption_key", "Key for encrypting cookies.").Envar("COOKIE_ENCRYPTION_KEY").Required().HexBytes()
 	sqlQueryLog           = app.Flag("sql_query_log", "Enable SQL query logging.").Envar("SQL_QUERY_LOG").Bool()
+	signFetches           = app.Flag("sign_fetches", "Sign outgoing HTTP requests with the instance key.").Envar("SIGN_FETCHES").Bool()
+	keyEncryptionKey      = app.Flag("key_encryption_key", "Key for encrypting user signing keys.").Envar("KEY_ENCRYPTION_KEY").Required().HexBytes()
+
+	_                 = app.Command("serve", "Run the server.").Default()
+	rotateKeyCommand  = app.Command("rotate-key", "Generate a new signing keypair for a user.")
+	rotateKeyUsername = rotateKeyCommand.Arg("username", "User to generate a new keypair for.").Required().String()
 )
 
 var decoder *schema.Decoder
@@ -61,7 +76,7 @@ func init() {
 }
 
 func main() {
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
 
 	sqlbuilder.SetDialect(dialects.Postgresql{})
 
@@ -77,13 +92,24 @@ func main() {
 		"public_url":              *publicURL,
 		"log_level":               *logLevel,
 		"pubsub_refresh_interval": *pubsubRefreshInterval,
+		"pubsub_lease":            *pubsubLease,
+		"pubsub_verify_timeout":   *pubsubVerifyTimeout,
+		"feed_poll_interval":      *feedPollInterval,
+		"backfill_max_pages":      *backfillMaxPages,
+		"backfill_max_age":        *backfillMaxAge,
 		"record_documents":        *recordDocuments,
+		"sign_fetches":            *signFetches,
 		"react_renderer":          *reactRenderer,
 		"external_js":             *externalJS,
 		"cookie_signing_key":      strings.Repeat("*", len(*cookieSigningKey)),
 		"cookie_encryption_key":   strings.Repeat("*", len(*cookieEncryptionKey)),
+		"key_encryption_key":      strings.Repeat("*", len(*keyEncryptionKey)),
 	}).Info("starting up")
 
+	if _, err := aes.NewCipher(*keyEncryptionKey); err != nil {
+		logrus.WithError(err).Fatal("key_encryption_key must be 16, 24, or 32 bytes (32, 48, or 64 hex characters)")
+	}
+
 	if http.DefaultClient.Transport == nil {
 		http.DefaultClient.Transport = http.DefaultTransport
 	}
@@ -128,6 +154,16 @@ func main() {
 		panic(err)
 	}
 
+	if command == rotateKeyCommand.FullCommand() {
+		if err := rotateUserKey(sqlDB, *rotateKeyUsername); err != nil {
+			panic(err)
+		}
+
+		logrus.WithField("username", *rotateKeyUsername).Info("generated new keypair")
+
+		return
+	}
+
 	ss := sessions.NewCookieStore(*cookieSigningKey, *cookieEncryptionKey)
 	ss.Options = &sessions.Options{HttpOnly: true, Secure: strings.HasPrefix(*publicURL, "https:")}
 
@@ -166,7 +202,19 @@ func main() {
 		panic(err)
 	}
 
+	if *signFetches {
+		_, k, err := a.getInstanceKey()
+		if err != nil {
+			panic(err)
+		}
+
+		http.DefaultClient.Transport = &httpsig.Transport{Base: http.DefaultClient.Transport, Signer: httpsig.NewSigner(instanceKeyID(), k)}
+	}
+
 	psc := pubsub.NewClient(*publicURL+"/pubsub", pubsub.NewSQLiteState(sqlDB), a.OnMessage)
+	psc.Lease = *pubsubLease
+	psc.VerifyTimeout = *pubsubVerifyTimeout
+	a.PubSub = psc
 
 	go func() {
 		time.Sleep(time.Second * 2)
@@ -183,6 +231,36 @@ func main() {
 		}
 	}()
 
+	a.Poller = poller.New(poller.NewSQLiteState(sqlDB), a.OnPoll)
+
+	go func() {
+		time.Sleep(time.Second * 2)
+
+		for {
+			logrus.Debug("polling feeds")
+			if err := a.Poller.Run(*feedPollInterval); err != nil {
+				logrus.WithError(err).Error("couldn't poll feeds")
+			} else {
+				logrus.Debug("polled feeds")
+			}
+
+			time.Sleep(*feedPollInterval)
+		}
+	}()
+
+	a.Hub = pubsub.NewHub(hubURL(), pubsub.NewSQLiteHubState(sqlDB), isUserFeedURL)
+
+	go func() {
+		for {
+			time.Sleep(*pubsubRefreshInterval)
+
+			logrus.Debug("expiring pubsub hub subscriptions")
+			if err := a.Hub.Expire(); err != nil {
+				logrus.WithError(err).Error("couldn't expire pubsub hub subscriptions")
+			}
+		}
+	}()
+
 	m := mux.NewRouter()
 
 	m.Methods("GET").Path("/health").HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
@@ -190,6 +268,13 @@ func main() {
 	})
 
 	m.PathPrefix("/pubsub").Handler(psc.Handler())
+	m.Methods("POST").Path("/hub").Handler(a.Hub)
+
+	m.Methods("GET").Path("/.well-known/webfinger").Handler(&webfinger.Handler{Source: &userWebfingerSource{a: a}})
+	m.Methods("GET").Path("/.well-known/host-meta").Handler(&hostmeta.Handler{Response: makeHostMeta()})
+	m.Methods("GET").Path("/.well-known/host-meta.json").Handler(&hostmeta.Handler{Response: makeHostMeta()})
+	m.Methods("GET").Path(nodeinfo.WellKnownPath).HandlerFunc(a.handleNodeInfoLinksGet)
+	m.Methods("GET").Path("/nodeinfo/{version}").HandlerFunc(a.handleNodeInfoGet)
 
 	m.Methods("GET").Path("/").HandlerFunc(a.HandlerFor(a.handleHomeGet))
 	m.Methods("GET").Path("/login").HandlerFunc(a.HandlerFor(a.handleLoginGet))
@@ -198,6 +283,23 @@ func main() {
 	m.Methods("POST").Path("/register").HandlerFunc(a.HandlerFor(a.handleRegisterPost))
 	m.Methods("GET").Path("/logout").HandlerFunc(a.HandlerFor(a.handleLogoutGet))
 	m.Methods("POST").Path("/logout").HandlerFunc(a.HandlerFor(a.handleLogoutPost))
+	m.Methods("GET").Path("/users/{username}").MatcherFunc(isActivityPubRequest).HandlerFunc(a.handleUserActorGet)
+	m.Methods("GET").Path("/users/{username}").HandlerFunc(a.HandlerFor(a.handleUserGet))
+	m.Methods("GET").Path("/users/{username}/outbox").HandlerFunc(a.handleUserOutboxGet)
+	m.Methods("POST").Path("/users/{username}/inbox").HandlerFunc(a.handleUserInboxPost)
+	m.Methods("POST").Path("/inbox").HandlerFunc(a.handleSharedInboxPost)
+	m.Methods("GET").Path("/actor").HandlerFunc(a.handleInstanceActorGet)
+	m.Methods("GET").Path("/users/{username}/feed.atom").HandlerFunc(a.handleUserFeedGet)
+	m.Methods("GET").Path("/users/{username}/statuses/{id}").MatcherFunc(isActivityPubRequest).HandlerFunc(a.handleUserStatusObjectGet)
+	m.Methods("GET").Path("/users/{username}/statuses/{id}").HandlerFunc(a.HandlerFor(a.handleUserStatusGet))
+	m.Methods("POST").Path("/salmon/user/{username}").HandlerFunc(a.handleSalmonUserPost)
+	m.Methods("POST").Path("/salmon/replies").HandlerFunc(a.handleSalmonRepliesPost)
+	m.Methods("POST").Path("/api/statuses").HandlerFunc(a.HandlerFor(a.handleStatusesPost))
+	m.Methods("POST").Path("/api/people/{account}/follow").HandlerFunc(a.HandlerFor(a.handlePersonFollowPost))
+	m.Methods("POST").Path("/api/people/{account}/unfollow").HandlerFunc(a.HandlerFor(a.handlePersonUnfollowPost))
+	m.Methods("POST").Path("/api/people/{account}/backfill").HandlerFunc(a.HandlerFor(a.handlePersonBackfillPost))
+	m.Methods("GET").Path("/api/timelines/home").HandlerFunc(a.HandlerFor(a.handleHomeTimelineGet))
+	m.Methods("GET").Path("/api/mentions").HandlerFunc(a.HandlerFor(a.handleMentionsGet))
 
 	m.Methods("GET").Path("/api/feed").HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		var args getPublicTimelineArgs
@@ -286,27 +388,22 @@ func main() {
 		}
 	})
 
+	// show-feed only fetches a feed once; following it through a hub or the
+	// poller is left to userFollow
 	m.Methods("GET").Path("/show-feed").HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		feedData, _, err := a.FeedCache.Get(r.URL.Query().Get("url"), nil)
+		feedHeader, feedData, err := a.getFeed(r.URL.Query().Get("url"))
 		if err != nil {
 			http.Error(rw, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		feed, err := activitystreams.Parse(feedData)
+		feed, err := activitystreams.ParseAny(feedHeader.Get("content-type"), feedData)
 		if err != nil {
 			http.Error(rw, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		hubLink := feed.GetLink("hub")
-
-		if hubLink != nil && hubLink.Href != "" && feed.ID != "" {
-			if err := psc.Subscribe(hubLink.Href, feed.ID); err != nil {
-				http.Error(rw, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
+		feed.SetFetchedFrom(r.URL.Query().Get("url"))
 
 		rw.Header().Set("content-type", "text/html; charset=utf8")
 		rw.WriteHeader(http.StatusOK)
@@ -336,45 +433,34 @@ func main() {
 			return
 		}
 
-		wf, err := webfinger.Fetch(webfinger.MakeURL(acct.Host, acct.String(), nil))
+		wf, err := fetchWebfinger(acct)
 		if err != nil {
-			hm, err := hostmeta.Fetch(acct.Host)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if actorURL := findActivityPubActor(wf); actorURL != "" {
+			actor, err := activitypub.FetchActor(actorURL)
 			if err != nil {
 				http.Error(rw, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			lrdd := hm.GetLink("lrdd")
-			if lrdd == nil {
-				http.Error(rw, "no lrdd link found in host metadata", http.StatusInternalServerError)
+			person, err := a.saveActor(actor)
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			var lrddHref string
-			switch {
-			case lrdd.Href != "":
-				lrddHref = lrdd.Href
-			case lrdd.Template != "":
-				lrddHrefTemplate, err := uritemplates.Parse(lrdd.Template)
-				if err != nil {
-					http.Error(rw, err.Error(), http.StatusInternalServerError)
-					return
-				}
-
-				s, err := lrddHrefTemplate.Expand(map[string]interface{}{"uri": acct.String()})
-				if err != nil {
-					http.Error(rw, err.Error(), http.StatusInternalServerError)
-					return
-				}
-
-				lrddHref = s
-			}
-
-			wf, err = webfinger.Fetch(lrddHref)
-			if err != nil {
+			if err := a.backfillOutbox(actor, person); err != nil {
 				http.Error(rw, err.Error(), http.StatusInternalServerError)
 				return
 			}
+
+			rw.Header().Set("location", "/?"+url.Values{"account": []string{person.ID}}.Encode())
+			rw.WriteHeader(http.StatusSeeOther)
+
+			return
 		}
 
 		feedLink := wf.GetLink("http://schemas.google.com/g/2010#updates-from")
@@ -0,0 +1,10 @@
+create table pubsub_hub_subscriptions (
+  id text not null primary key,
+  topic text not null,
+  callback_url text not null,
+  secret text not null,
+  created_at datetime not null,
+  updated_at datetime not null,
+  expires_at datetime not null,
+  unique (topic, callback_url)
+);
@@ -0,0 +1,2 @@
+alter table users add column public_key text;
+alter table users add column private_key text;
@@ -0,0 +1,9 @@
+create table follows (
+  user_id text not null references users (id),
+  person_id text not null references people (id),
+  created_at datetime not null,
+  hub text,
+  topic text,
+  salmon text,
+  primary key (user_id, person_id)
+);
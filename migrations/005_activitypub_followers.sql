@@ -0,0 +1,8 @@
+create table followers (
+  user_id text not null references users (id),
+  person_id text not null references people (id),
+  created_at datetime not null,
+  follow_id text not null,
+  inbox text not null,
+  primary key (user_id, person_id)
+);
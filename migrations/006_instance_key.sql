@@ -0,0 +1,6 @@
+create table instance_keys (
+  id text not null primary key,
+  created_at datetime not null,
+  public_key text not null,
+  private_key text not null
+);
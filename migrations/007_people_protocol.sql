@@ -0,0 +1,6 @@
+alter table people add column protocol text not null default 'ostatus';
+
+alter table follows add column protocol text not null default 'ostatus';
+alter table follows add column inbox text;
+alter table follows add column follow_id text;
+alter table follows add column actor text;
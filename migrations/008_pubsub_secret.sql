@@ -0,0 +1 @@
+alter table pubsub_state add column secret text not null default '';
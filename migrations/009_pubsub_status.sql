@@ -0,0 +1,4 @@
+alter table pubsub_state add column status text not null default 'active';
+alter table pubsub_state add column status_reason text not null default '';
+
+update pubsub_state set status = 'pending_subscribe' where expires_at is null;
@@ -0,0 +1,4 @@
+alter table pubsub_state add column lease_seconds integer not null default 0;
+alter table pubsub_state add column failure_count integer not null default 0;
+alter table pubsub_state add column last_error text not null default '';
+alter table pubsub_state add column next_attempt_at datetime;
@@ -0,0 +1,16 @@
+create table feed_polls (
+  url text not null primary key,
+  created_at datetime not null,
+  updated_at datetime not null,
+  next_fetch_at datetime not null,
+  last_fetched_at datetime,
+  last_changed_at datetime,
+  interval_seconds integer not null,
+  etag text not null default '',
+  last_modified text not null default '',
+  hash text not null default '',
+  failure_count integer not null default 0,
+  last_error text not null default ''
+);
+
+create index feed_polls_next_fetch_at on feed_polls (next_fetch_at);
@@ -0,0 +1,12 @@
+create table backfills (
+  person_id text not null primary key,
+  feed_url text not null,
+  next_url text not null default '',
+  pages integer not null default 0,
+  entries integer not null default 0,
+  oldest datetime,
+  created_at datetime not null,
+  updated_at datetime not null,
+  finished_at datetime,
+  last_error text not null default ''
+);
@@ -0,0 +1,8 @@
+alter table objects add column media_url text;
+alter table objects add column media_type text;
+alter table objects add column width integer;
+alter table objects add column height integer;
+alter table objects add column duration integer;
+alter table objects add column start_time datetime;
+alter table objects add column end_time datetime;
+alter table objects add column target_url text;
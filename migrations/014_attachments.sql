@@ -0,0 +1,12 @@
+create table attachments (
+  object_id text not null references objects (id),
+  position integer not null,
+  url text not null,
+  media_type text not null default '',
+  length integer,
+  width integer,
+  height integer,
+  description text not null default '',
+  sensitive boolean not null default 0,
+  primary key (object_id, position)
+);
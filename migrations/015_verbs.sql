@@ -0,0 +1,19 @@
+alter table objects add column deleted_at datetime;
+
+alter table activities add column shared_activity_id text;
+
+create table likes (
+  person_id text not null references people (id),
+  object_id text not null,
+  activity_id text not null,
+  created_at datetime not null,
+  primary key (person_id, object_id)
+);
+
+create table person_follows (
+  follower_id text not null references people (id),
+  target text not null,
+  activity_id text not null,
+  created_at datetime not null,
+  primary key (follower_id, target)
+);
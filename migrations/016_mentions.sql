@@ -0,0 +1,9 @@
+create table mentions (
+  activity_id text not null references activities (id),
+  target text not null,
+  person_id text,
+  kind text not null,
+  primary key (activity_id, target)
+);
+
+create index mentions_person_id on mentions (person_id);
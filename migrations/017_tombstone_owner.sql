@@ -0,0 +1 @@
+alter table objects add column deleted_by text;
@@ -0,0 +1,3 @@
+alter table objects add column posted_by text;
+
+update objects set posted_by = (select actor from activities where activities.object = objects.id and activities.verb in ('http://activitystrea.ms/schema/1.0/post', 'post') and activities.actor is not null order by activities.time asc limit 1);
@@ -0,0 +1 @@
+delete from feed_polls where url not in (select topic from follows where topic is not null);
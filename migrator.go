@@ -11,6 +11,12 @@ import (
 	"github.com/Sirupsen/logrus"
 )
 
+// codeMigrations are migrations that can't be expressed in plain SQL. They're
+// ordered alongside the SQL files by name.
+var codeMigrations = map[string]func(tx *sql.Tx) error{
+	"003_user_keys_backfill": backfillUserKeys,
+}
+
 func migrate(db *sql.DB, box *rice.Box) error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -36,14 +42,12 @@ func migrate(db *sql.DB, box *rice.Box) error {
 	}); err != nil {
 		return err
 	}
+	for n := range codeMigrations {
+		names = append(names, n)
+	}
 	sort.Strings(names)
 
 	for _, n := range names {
-		s, err := box.String(n)
-		if err != nil {
-			return err
-		}
-
 		logrus.WithField("file", n).Info("checking migration status")
 
 		var count int
@@ -52,8 +56,19 @@ func migrate(db *sql.DB, box *rice.Box) error {
 		} else if count == 0 {
 			logrus.WithField("file", n).Info("applying migration")
 
-			if _, err := tx.Exec(s); err != nil {
-				return err
+			if fn, ok := codeMigrations[n]; ok {
+				if err := fn(tx); err != nil {
+					return err
+				}
+			} else {
+				s, err := box.String(n)
+				if err != nil {
+					return err
+				}
+
+				if _, err := tx.Exec(s); err != nil {
+					return err
+				}
 			}
 
 			if _, err = tx.Exec("insert into migrations (name, applied_at) values($1, $2)", n, time.Now()); err != nil {
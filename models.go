@@ -32,6 +32,8 @@ type Activity struct {
 	Title        string    `json:"title" sql:"title,text"`
 	InReplyToID  *string   `json:"inReplyToID" sql:"in_reply_to_id,text"`
 	InReplyToURL *string   `json:"inReplyToURL" sql:"in_reply_to_url,text"`
+
+	SharedActivityID *string `json:"sharedActivityID" sql:"shared_activity_id,text"`
 }
 
 type Person struct {
@@ -42,14 +44,44 @@ type Person struct {
 	DisplayName *string   `json:"displayName" sql:"display_name,text"`
 	Avatar      *string   `json:"avatar" sql:"avatar,text"`
 	Summary     *string   `json:"summary" sql:"summary,text"`
+	Protocol    string    `json:"protocol" sql:"protocol,text,not_null"`
 }
 
 type Object struct {
-	ID                  string  `json:"id" sql:"id,text,primary_key,table=objects"`
-	Name                *string `json:"name" sql:"name,text"`
-	Summary             *string `json:"summary" sql:"summary,text"`
-	RepresentativeImage *string `json:"representativeImage" sql:"representative_image,text"`
-	Permalink           *string `json:"permalink" sql:"permalink,text"`
-	ObjectType          *string `json:"objectType" sql:"object_type,text"`
-	Content             *string `json:"content" sql:"content,text"`
+	ID                  string     `json:"id" sql:"id,text,primary_key,table=objects"`
+	Name                *string    `json:"name" sql:"name,text"`
+	Summary             *string    `json:"summary" sql:"summary,text"`
+	RepresentativeImage *string    `json:"representativeImage" sql:"representative_image,text"`
+	Permalink           *string    `json:"permalink" sql:"permalink,text"`
+	ObjectType          *string    `json:"objectType" sql:"object_type,text"`
+	Content             *string    `json:"content" sql:"content,text"`
+	MediaURL            *string    `json:"mediaURL" sql:"media_url,text"`
+	MediaType           *string    `json:"mediaType" sql:"media_type,text"`
+	Width               *int       `json:"width" sql:"width,integer"`
+	Height              *int       `json:"height" sql:"height,integer"`
+	Duration            *int       `json:"duration" sql:"duration,integer"`
+	StartTime           *time.Time `json:"startTime" sql:"start_time,datetime"`
+	EndTime             *time.Time `json:"endTime" sql:"end_time,datetime"`
+	TargetURL           *string    `json:"targetURL" sql:"target_url,text"`
+
+	Attachments []Attachment `json:"attachments"`
+}
+
+type Attachment struct {
+	ObjectID    string `json:"-" sql:"object_id,text,not_null,table=attachments"`
+	Position    int    `json:"-" sql:"position,integer,not_null"`
+	URL         string `json:"url" sql:"url,text,not_null"`
+	MediaType   string `json:"mediaType" sql:"media_type,text,not_null"`
+	Length      *int64 `json:"length" sql:"length,integer"`
+	Width       *int   `json:"width" sql:"width,integer"`
+	Height      *int   `json:"height" sql:"height,integer"`
+	Description string `json:"description" sql:"description,text,not_null"`
+	Sensitive   bool   `json:"sensitive" sql:"sensitive,boolean,not_null"`
+}
+
+type Mention struct {
+	ActivityID string  `json:"activityID" sql:"activity_id,text,not_null,table=mentions"`
+	Target     string  `json:"target" sql:"target,text,not_null"`
+	PersonID   *string `json:"personID" sql:"person_id,text"`
+	Kind       string  `json:"kind" sql:"kind,text,not_null"`
 }
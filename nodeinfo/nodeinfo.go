@@ -0,0 +1,104 @@
+// Package nodeinfo implements the parts of NodeInfo 2.0 and 2.1 needed to
+// describe a server to crawlers and other nodes.
+package nodeinfo
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	Schema20 = "http://nodeinfo.diaspora.software/ns/schema/2.0"
+	Schema21 = "http://nodeinfo.diaspora.software/ns/schema/2.1"
+
+	WellKnownPath = "/.well-known/nodeinfo"
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("nodeinfo: unsupported version")
+)
+
+// Links is the discovery document served from /.well-known/nodeinfo.
+type Links struct {
+	Links []Link `json:"links"`
+}
+
+type Link struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+}
+
+type Software struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Repository string `json:"repository,omitempty"`
+	Homepage   string `json:"homepage,omitempty"`
+}
+
+type Services struct {
+	Inbound  []string `json:"inbound"`
+	Outbound []string `json:"outbound"`
+}
+
+type Users struct {
+	Total          int `json:"total"`
+	ActiveMonth    int `json:"activeMonth"`
+	ActiveHalfyear int `json:"activeHalfyear"`
+}
+
+type Usage struct {
+	Users      Users `json:"users"`
+	LocalPosts int   `json:"localPosts"`
+}
+
+type Document struct {
+	Version           string                 `json:"version"`
+	Software          Software               `json:"software"`
+	Protocols         []string               `json:"protocols"`
+	Services          Services               `json:"services"`
+	OpenRegistrations bool                   `json:"openRegistrations"`
+	Usage             Usage                  `json:"usage"`
+	Metadata          map[string]interface{} `json:"metadata"`
+}
+
+// ForVersion returns a copy of d that's valid for the given schema version.
+// 2.0 doesn't allow the repository and homepage fields on software.
+func (d Document) ForVersion(version string) (*Document, error) {
+	switch version {
+	case "2.0":
+		d.Software.Repository = ""
+		d.Software.Homepage = ""
+	case "2.1":
+		// nothing
+	default:
+		return nil, errors.Wrap(ErrUnsupportedVersion, "Document.ForVersion")
+	}
+
+	d.Version = version
+
+	if d.Protocols == nil {
+		d.Protocols = []string{}
+	}
+	if d.Services.Inbound == nil {
+		d.Services.Inbound = []string{}
+	}
+	if d.Services.Outbound == nil {
+		d.Services.Outbound = []string{}
+	}
+	if d.Metadata == nil {
+		d.Metadata = map[string]interface{}{}
+	}
+
+	return &d, nil
+}
+
+// SchemaFor returns the schema url for a document version.
+func SchemaFor(version string) string {
+	switch version {
+	case "2.0":
+		return Schema20
+	case "2.1":
+		return Schema21
+	}
+
+	return ""
+}
@@ -0,0 +1,40 @@
+package nodeinfo
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForVersion20(t *testing.T) {
+	d := Document{Software: Software{Name: "don", Version: "dev", Repository: "https://github.com/deoxxa/don"}}
+
+	v, err := d.ForVersion("2.0")
+	assert.NoError(t, err)
+
+	b, err := json.Marshal(v)
+	assert.NoError(t, err)
+
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &m))
+
+	assert.Equal(t, "2.0", m["version"])
+	assert.Equal(t, map[string]interface{}{"name": "don", "version": "dev"}, m["software"])
+	assert.Equal(t, []interface{}{}, m["protocols"])
+	assert.Equal(t, map[string]interface{}{}, m["metadata"])
+
+	assert.Equal(t, "https://github.com/deoxxa/don", d.Software.Repository)
+}
+
+func TestForVersion21(t *testing.T) {
+	d := Document{Software: Software{Name: "don", Version: "dev", Repository: "https://github.com/deoxxa/don"}}
+
+	v, err := d.ForVersion("2.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "2.1", v.Version)
+	assert.Equal(t, "https://github.com/deoxxa/don", v.Software.Repository)
+
+	_, err = d.ForVersion("1.0")
+	assert.Error(t, err)
+}
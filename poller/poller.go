@@ -0,0 +1,262 @@
+// Package poller fetches feeds that don't have a WebSub hub on a schedule
+// that adapts to how often they change.
+package poller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/juju/ratelimit"
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/workergroup"
+)
+
+const (
+	DefaultMinInterval = time.Minute * 5
+	DefaultMaxInterval = time.Hour * 24
+	DefaultConcurrency = 4
+
+	maxFeedSize = 4 << 20
+)
+
+type Feed struct {
+	URL           string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	NextFetchAt   time.Time
+	LastFetchedAt *time.Time
+	LastChangedAt *time.Time
+	Interval      time.Duration
+	ETag          string
+	LastModified  string
+	Hash          string
+	FailureCount  int
+	LastError     string
+}
+
+type State interface {
+	Due(before time.Time) (feeds []Feed, err error)
+	Add(feedURL string, nextFetchAt time.Time, interval time.Duration) (err error)
+	Update(feed *Feed) (err error)
+	Del(feedURL string) (err error)
+}
+
+// FeedHandler is called with the body of a feed whenever it changes.
+type FeedHandler func(feedURL string, body []byte)
+
+type Poller struct {
+	State       State
+	OnFeed      FeedHandler
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	Concurrency int
+
+	m       sync.Mutex
+	buckets map[string]*ratelimit.Bucket
+}
+
+func New(state State, onFeed FeedHandler) *Poller {
+	return &Poller{
+		State:       state,
+		OnFeed:      onFeed,
+		MinInterval: DefaultMinInterval,
+		MaxInterval: DefaultMaxInterval,
+		Concurrency: DefaultConcurrency,
+		buckets:     make(map[string]*ratelimit.Bucket),
+	}
+}
+
+// Add starts polling a feed. It's fetched for the first time on the next
+// run.
+func (p *Poller) Add(feedURL string) error {
+	return errors.Wrap(p.State.Add(feedURL, time.Now(), p.MinInterval), "Poller.Add")
+}
+
+func (p *Poller) Del(feedURL string) error {
+	return errors.Wrap(p.State.Del(feedURL), "Poller.Del")
+}
+
+func (p *Poller) getBucket(host string) *ratelimit.Bucket {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.buckets == nil {
+		p.buckets = make(map[string]*ratelimit.Bucket)
+	}
+
+	if b, ok := p.buckets[host]; ok {
+		return b
+	}
+
+	p.buckets[host] = ratelimit.NewBucket(time.Second*30, 4)
+
+	return p.buckets[host]
+}
+
+// Run fetches every feed that's due. Feeds on hosts that we've been hitting
+// too hard are left until the next run, which is expected to happen after
+// interval.
+func (p *Poller) Run(interval time.Duration) error {
+	a, err := p.State.Due(time.Now())
+	if err != nil {
+		return errors.Wrap(err, "Poller.Run")
+	}
+
+	logrus.WithField("count", len(a)).Debug("poller: got feeds to poll")
+
+	var g workergroup.Group
+
+	for _, f := range a {
+		f := f
+
+		l := logrus.WithFields(logrus.Fields{
+			"url":           f.URL,
+			"interval":      f.Interval,
+			"next_fetch_at": f.NextFetchAt,
+		})
+
+		u, err := url.Parse(f.URL)
+		if err != nil {
+			l.WithError(err).Warn("poller: couldn't parse feed url")
+			continue
+		}
+
+		dur, ok := p.getBucket(u.Host).TakeMaxDuration(1, interval)
+		if !ok {
+			l.Debug("poller: skipping feed for now as we'd have to wait too long")
+			continue
+		}
+
+		g.Add(func() error {
+			if dur > 0 {
+				l.WithField("duration", dur).Debug("poller: waiting so as not to overwhelm the endpoint")
+				time.Sleep(dur)
+			}
+
+			if err := p.poll(&f); err != nil {
+				l.WithError(err).Warn("poller: couldn't poll feed")
+				return errors.Wrap(err, "Poller.Run")
+			}
+
+			return nil
+		})
+	}
+
+	return errors.Wrap(g.Run(p.Concurrency), "Poller.Run")
+}
+
+func (p *Poller) poll(f *Feed) error {
+	now := time.Now()
+
+	changed, err := p.fetch(f)
+
+	f.UpdatedAt = now
+	f.LastFetchedAt = &now
+
+	if err != nil {
+		f.FailureCount++
+		f.LastError = err.Error()
+		f.Interval = NextInterval(f.Interval, false, p.MinInterval, p.MaxInterval)
+	} else {
+		f.FailureCount = 0
+		f.LastError = ""
+		f.Interval = NextInterval(f.Interval, changed, p.MinInterval, p.MaxInterval)
+
+		if changed {
+			f.LastChangedAt = &now
+		}
+	}
+
+	f.NextFetchAt = now.Add(f.Interval)
+
+	if err := p.State.Update(f); err != nil {
+		return errors.Wrap(err, "Poller.poll")
+	}
+
+	return errors.Wrap(err, "Poller.poll")
+}
+
+// fetch does a conditional GET of the feed, passing the body on if it has
+// changed since last time.
+func (p *Poller) fetch(f *Feed) (bool, error) {
+	req, err := http.NewRequest("GET", f.URL, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "Poller.fetch")
+	}
+
+	if f.ETag != "" {
+		req.Header.Set("if-none-match", f.ETag)
+	}
+	if f.LastModified != "" {
+		req.Header.Set("if-modified-since", f.LastModified)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, "Poller.fetch")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return false, errors.Errorf("Poller.fetch: invalid status code; expected 200 but got %d", res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxFeedSize))
+	if err != nil {
+		return false, errors.Wrap(err, "Poller.fetch")
+	}
+
+	f.ETag = res.Header.Get("etag")
+	f.LastModified = res.Header.Get("last-modified")
+
+	// plenty of servers don't support conditional requests, so we check
+	// for ourselves as well
+	h := sha256.Sum256(body)
+	hash := hex.EncodeToString(h[:])
+	if hash == f.Hash {
+		return false, nil
+	}
+
+	f.Hash = hash
+
+	if p.OnFeed != nil {
+		p.OnFeed(f.URL, body)
+	}
+
+	return true, nil
+}
+
+// NextInterval halves the polling interval when a feed has changed and
+// grows it by half when it hasn't, keeping it between min and max.
+func NextInterval(current time.Duration, changed bool, min, max time.Duration) time.Duration {
+	if current == 0 {
+		current = min
+	}
+
+	if changed {
+		current = current / 2
+	} else {
+		current = current + current/2
+	}
+
+	if current < min {
+		current = min
+	}
+	if current > max {
+		current = max
+	}
+
+	return current
+}
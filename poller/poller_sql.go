@@ -0,0 +1,97 @@
+package poller
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type SQLiteState struct {
+	m  sync.Mutex
+	DB *sql.DB
+}
+
+func NewSQLiteState(db *sql.DB) *SQLiteState {
+	return &SQLiteState{DB: db}
+}
+
+func (s *SQLiteState) Due(before time.Time) ([]Feed, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var a []Feed
+
+	rows, err := s.DB.Query("select url, created_at, updated_at, next_fetch_at, last_fetched_at, last_changed_at, interval_seconds, etag, last_modified, hash, failure_count, last_error from feed_polls where next_fetch_at <= $1 order by next_fetch_at asc", before)
+	if err != nil {
+		return nil, errors.Wrap(err, "SQLiteState.Due")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f Feed
+		var interval int64
+		if err := rows.Scan(&f.URL, &f.CreatedAt, &f.UpdatedAt, &f.NextFetchAt, &f.LastFetchedAt, &f.LastChangedAt, &interval, &f.ETag, &f.LastModified, &f.Hash, &f.FailureCount, &f.LastError); err != nil {
+			return nil, errors.Wrap(err, "SQLiteState.Due")
+		}
+
+		f.Interval = time.Second * time.Duration(interval)
+
+		a = append(a, f)
+	}
+
+	return a, nil
+}
+
+func (s *SQLiteState) Add(feedURL string, nextFetchAt time.Time, interval time.Duration) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "SQLiteState.Add: couldn't open transaction")
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow("select count(1) from feed_polls where url = $1", feedURL).Scan(&count); err != nil {
+		return errors.Wrap(err, "SQLiteState.Add: couldn't select poll record")
+	}
+
+	if count == 0 {
+		now := time.Now()
+
+		if _, err := tx.Exec("insert into feed_polls (url, created_at, updated_at, next_fetch_at, interval_seconds) values ($1, $2, $3, $4, $5)", feedURL, now, now, nextFetchAt, int64(interval/time.Second)); err != nil {
+			return errors.Wrap(err, "SQLiteState.Add: couldn't insert poll record")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "SQLiteState.Add: couldn't close transaction")
+	}
+
+	return nil
+}
+
+func (s *SQLiteState) Update(f *Feed) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, err := s.DB.Exec("update feed_polls set updated_at = $1, next_fetch_at = $2, last_fetched_at = $3, last_changed_at = $4, interval_seconds = $5, etag = $6, last_modified = $7, hash = $8, failure_count = $9, last_error = $10 where url = $11", f.UpdatedAt, f.NextFetchAt, f.LastFetchedAt, f.LastChangedAt, int64(f.Interval/time.Second), f.ETag, f.LastModified, f.Hash, f.FailureCount, f.LastError, f.URL); err != nil {
+		return errors.Wrap(err, "SQLiteState.Update: couldn't update poll record")
+	}
+
+	return nil
+}
+
+func (s *SQLiteState) Del(feedURL string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, err := s.DB.Exec("delete from feed_polls where url = $1", feedURL); err != nil {
+		return errors.Wrap(err, "SQLiteState.Del: couldn't delete poll record")
+	}
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package poller
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juju/ratelimit"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextInterval(t *testing.T) {
+	min, max := time.Minute*5, time.Hour*24
+
+	assert.Equal(t, time.Minute*15, NextInterval(time.Minute*10, false, min, max))
+	assert.Equal(t, time.Minute*10, NextInterval(time.Minute*20, true, min, max))
+	assert.Equal(t, min, NextInterval(time.Minute*6, true, min, max))
+	assert.Equal(t, max, NextInterval(time.Hour*20, false, min, max))
+	assert.Equal(t, time.Minute*7+time.Second*30, NextInterval(0, false, min, max))
+}
+
+func newTestState(t *testing.T) (*SQLiteState, func()) {
+	dir, err := ioutil.TempDir("", "poller-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "poller.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := ioutil.ReadFile("../migrations/011_feed_polls.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSQLiteState(db), func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// testFeed is a feed server that can be told to support conditional
+// requests, change its body, or break.
+type testFeed struct {
+	*httptest.Server
+
+	m           sync.Mutex
+	body        string
+	etag        string
+	status      int
+	requests    int
+	conditional int
+}
+
+func newTestFeed(body, etag string) *testFeed {
+	f := testFeed{body: body, etag: etag, status: http.StatusOK}
+
+	f.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		f.m.Lock()
+		defer f.m.Unlock()
+
+		f.requests++
+
+		if f.status != http.StatusOK {
+			rw.WriteHeader(f.status)
+			return
+		}
+
+		if f.etag != "" {
+			if r.Header.Get("if-none-match") == f.etag {
+				f.conditional++
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			rw.Header().Set("etag", f.etag)
+		}
+
+		rw.Write([]byte(f.body))
+	}))
+
+	return &f
+}
+
+func (f *testFeed) set(fn func(f *testFeed)) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	fn(f)
+}
+
+// run makes every feed due and polls them.
+func run(t *testing.T, p *Poller, s *SQLiteState) {
+	feeds, err := s.Due(time.Now().Add(time.Hour * 48))
+	assert.NoError(t, err)
+
+	for i := range feeds {
+		feeds[i].NextFetchAt = time.Now().Add(-time.Second)
+		assert.NoError(t, s.Update(&feeds[i]))
+	}
+
+	p.Run(time.Minute)
+}
+
+func get(t *testing.T, s *SQLiteState, feedURL string) *Feed {
+	feeds, err := s.Due(time.Now().Add(time.Hour * 48))
+	assert.NoError(t, err)
+
+	for i := range feeds {
+		if feeds[i].URL == feedURL {
+			return &feeds[i]
+		}
+	}
+
+	t.Fatalf("feed %s not found", feedURL)
+
+	return nil
+}
+
+func newTestPoller(s State, host string, onFeed FeedHandler) *Poller {
+	p := New(s, onFeed)
+
+	// the default limit would have the tests waiting around
+	p.buckets[host] = ratelimit.NewBucket(time.Millisecond, 100)
+
+	return p
+}
+
+func TestPollerConditional(t *testing.T) {
+	s, done := newTestState(t)
+	defer done()
+
+	srv := newTestFeed("<feed/>", `"v1"`)
+	defer srv.Close()
+
+	var received []string
+	p := newTestPoller(s, srv.Listener.Addr().String(), func(feedURL string, body []byte) {
+		received = append(received, string(body))
+	})
+
+	assert.NoError(t, p.Add(srv.URL))
+
+	due, err := s.Due(time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+
+	assert.NoError(t, p.Run(time.Minute))
+
+	f := get(t, s, srv.URL)
+	assert.Equal(t, `"v1"`, f.ETag)
+	assert.NotEqual(t, "", f.Hash)
+	assert.NotNil(t, f.LastChangedAt)
+	assert.Equal(t, p.MinInterval, f.Interval)
+	assert.True(t, f.NextFetchAt.After(time.Now()))
+	assert.Equal(t, []string{"<feed/>"}, received)
+
+	// not due again until the interval is up
+	due, err = s.Due(time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, due, 0)
+
+	run(t, p, s)
+
+	f = get(t, s, srv.URL)
+	assert.Equal(t, 1, srv.conditional)
+	assert.Equal(t, NextInterval(p.MinInterval, false, p.MinInterval, p.MaxInterval), f.Interval)
+	assert.Equal(t, []string{"<feed/>"}, received)
+
+	srv.set(func(f *testFeed) { f.body, f.etag = "<feed>new</feed>", `"v2"` })
+
+	run(t, p, s)
+
+	f = get(t, s, srv.URL)
+	assert.Equal(t, `"v2"`, f.ETag)
+	assert.Equal(t, []string{"<feed/>", "<feed>new</feed>"}, received)
+}
+
+func TestPollerHash(t *testing.T) {
+	s, done := newTestState(t)
+	defer done()
+
+	srv := newTestFeed("<feed/>", "")
+	defer srv.Close()
+
+	var received []string
+	p := newTestPoller(s, srv.Listener.Addr().String(), func(feedURL string, body []byte) {
+		received = append(received, string(body))
+	})
+
+	assert.NoError(t, p.Add(srv.URL))
+
+	run(t, p, s)
+	run(t, p, s)
+
+	assert.Equal(t, 2, srv.requests)
+	assert.Equal(t, []string{"<feed/>"}, received)
+
+	f := get(t, s, srv.URL)
+	assert.Equal(t, "", f.ETag)
+	assert.Equal(t, NextInterval(p.MinInterval, false, p.MinInterval, p.MaxInterval), f.Interval)
+
+	srv.set(func(f *testFeed) { f.body = "<feed>new</feed>" })
+
+	run(t, p, s)
+
+	assert.Equal(t, []string{"<feed/>", "<feed>new</feed>"}, received)
+}
+
+func TestPollerFailures(t *testing.T) {
+	s, done := newTestState(t)
+	defer done()
+
+	srv := newTestFeed("<feed/>", "")
+	defer srv.Close()
+
+	var received []string
+	p := newTestPoller(s, srv.Listener.Addr().String(), func(feedURL string, body []byte) {
+		received = append(received, string(body))
+	})
+
+	assert.NoError(t, p.Add(srv.URL))
+
+	srv.set(func(f *testFeed) { f.status = http.StatusInternalServerError })
+
+	run(t, p, s)
+
+	f := get(t, s, srv.URL)
+	assert.Equal(t, 1, f.FailureCount)
+	assert.Contains(t, f.LastError, "500")
+
+	run(t, p, s)
+
+	f = get(t, s, srv.URL)
+	assert.Equal(t, 2, f.FailureCount)
+	assert.True(t, f.Interval > p.MinInterval)
+	assert.Len(t, received, 0)
+
+	srv.set(func(f *testFeed) { f.status = http.StatusOK })
+
+	run(t, p, s)
+
+	f = get(t, s, srv.URL)
+	assert.Equal(t, 0, f.FailureCount)
+	assert.Equal(t, "", f.LastError)
+	assert.Equal(t, []string{"<feed/>"}, received)
+}
+
+func TestPollerConcurrency(t *testing.T) {
+	s, done := newTestState(t)
+	defer done()
+
+	var m sync.Mutex
+	var running, most int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		m.Unlock()
+
+		time.Sleep(time.Millisecond * 20)
+
+		m.Lock()
+		running--
+		m.Unlock()
+
+		rw.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	var count int
+	p := newTestPoller(s, srv.Listener.Addr().String(), func(feedURL string, body []byte) {
+		m.Lock()
+		count++
+		m.Unlock()
+	})
+	p.Concurrency = 2
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, p.Add(fmt.Sprintf("%s/%d", srv.URL, i)))
+	}
+
+	assert.NoError(t, p.Run(time.Minute))
+
+	assert.Equal(t, 6, count)
+	assert.Equal(t, 2, most)
+}
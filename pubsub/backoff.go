@@ -0,0 +1,47 @@
+package pubsub
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultLease         = time.Hour * 24 * 7
+	DefaultVerifyTimeout = time.Minute * 30
+
+	minBackoff = time.Minute
+	maxBackoff = time.Hour * 24
+)
+
+// Backoff returns how long to wait before retrying a subscription that has
+// failed n times in a row. It doubles with every failure, and is jittered so
+// that subscriptions that failed together don't all retry together.
+func Backoff(n int) time.Duration {
+	d := maxBackoff
+	if n < 1 {
+		n = 1
+	}
+	if n < 12 {
+		if v := minBackoff << uint(n-1); v < maxBackoff {
+			d = v
+		}
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// RenewAt returns the time at which an active subscription should be renewed.
+// That's a quarter of the way from the end of the lease the hub granted, but
+// never later than one refresh interval before it expires.
+func RenewAt(s *Subscription, interval time.Duration) time.Time {
+	if s.ExpiresAt == nil {
+		return time.Time{}
+	}
+
+	margin := time.Second * time.Duration(s.LeaseSeconds) / 4
+	if margin < interval {
+		margin = interval
+	}
+
+	return s.ExpiresAt.Add(-margin)
+}
@@ -0,0 +1,37 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	for n, max := range map[int]time.Duration{
+		0:   time.Minute,
+		1:   time.Minute,
+		2:   time.Minute * 2,
+		5:   time.Minute * 16,
+		12:  time.Hour * 24,
+		100: time.Hour * 24,
+	} {
+		for i := 0; i < 20; i++ {
+			d := Backoff(n)
+			assert.True(t, d >= max/2, "backoff %d was %s", n, d)
+			assert.True(t, d <= max, "backoff %d was %s", n, d)
+		}
+	}
+}
+
+func TestRenewAt(t *testing.T) {
+	expiresAt := time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	s := Subscription{ExpiresAt: &expiresAt, LeaseSeconds: 86400}
+	assert.Equal(t, expiresAt.Add(-time.Hour*6), RenewAt(&s, time.Minute*15))
+
+	s.LeaseSeconds = 600
+	assert.Equal(t, expiresAt.Add(-time.Minute*15), RenewAt(&s, time.Minute*15))
+
+	assert.True(t, RenewAt(&Subscription{}, time.Minute).IsZero())
+}
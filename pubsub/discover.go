@@ -0,0 +1,121 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tomnomnom/linkheader"
+)
+
+// Discovery holds the hub and topic urls advertised by a resource.
+type Discovery struct {
+	Hubs []string
+	Self string
+}
+
+// Hub returns the first advertised hub, or an empty string if there isn't
+// one.
+func (d *Discovery) Hub() string {
+	if len(d.Hubs) == 0 {
+		return ""
+	}
+
+	return d.Hubs[0]
+}
+
+// Discover finds hub and self links for the resource at baseURL. Link
+// headers take precedence, falling back to <link> elements in the body,
+// which can be Atom, RSS or HTML. Relative urls are resolved against baseURL.
+func Discover(baseURL string, header http.Header, body []byte) *Discovery {
+	var d Discovery
+
+	for _, l := range linkheader.ParseMultiple(header["Link"]) {
+		for _, rel := range strings.Fields(strings.ToLower(l.Rel)) {
+			d.add(rel, l.URL)
+		}
+	}
+
+	if len(d.Hubs) == 0 || d.Self == "" {
+		var b Discovery
+		discoverBody(body, &b)
+
+		if len(d.Hubs) == 0 {
+			d.Hubs = b.Hubs
+		}
+		if d.Self == "" {
+			d.Self = b.Self
+		}
+	}
+
+	if base, err := url.Parse(baseURL); err == nil {
+		for i, h := range d.Hubs {
+			d.Hubs[i] = resolve(base, h)
+		}
+
+		if d.Self != "" {
+			d.Self = resolve(base, d.Self)
+		}
+	}
+
+	return &d
+}
+
+func (d *Discovery) add(rel, href string) {
+	if href == "" {
+		return
+	}
+
+	switch rel {
+	case "hub":
+		d.Hubs = append(d.Hubs, href)
+	case "self":
+		if d.Self == "" {
+			d.Self = href
+		}
+	}
+}
+
+func discoverBody(body []byte, d *Discovery) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return
+		}
+
+		e, ok := t.(xml.StartElement)
+		if !ok || strings.ToLower(e.Name.Local) != "link" {
+			continue
+		}
+
+		var rel, href string
+		for _, a := range e.Attr {
+			switch strings.ToLower(a.Name.Local) {
+			case "rel":
+				rel = a.Value
+			case "href":
+				href = a.Value
+			}
+		}
+
+		for _, r := range strings.Fields(strings.ToLower(rel)) {
+			d.add(r, strings.TrimSpace(href))
+		}
+	}
+}
+
+func resolve(base *url.URL, s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+
+	return base.ResolveReference(u).String()
+}
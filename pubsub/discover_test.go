@@ -0,0 +1,49 @@
+package pubsub
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Add("Link", `<https://hub.example/>; rel="hub"`)
+	h.Add("Link", `</feeds/bob.atom>; rel="self"`)
+
+	d := Discover("https://social.example/users/bob", h, []byte(`<feed xmlns="http://www.w3.org/2005/Atom"><link rel="hub" href="https://other.example/"/></feed>`))
+
+	assert.Equal(t, []string{"https://hub.example/"}, d.Hubs)
+	assert.Equal(t, "https://social.example/feeds/bob.atom", d.Self)
+}
+
+func TestDiscoverAtom(t *testing.T) {
+	d := Discover("https://social.example/bob.atom", http.Header{}, []byte(`<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>tag:social.example,2017:bob</id>
+  <link rel="alternate" type="text/html" href="https://social.example/bob"/>
+  <link rel="hub" href="https://hub.example/"/>
+  <link rel="self" type="application/atom+xml" href="https://social.example/api/bob.atom"/>
+</feed>`))
+
+	assert.Equal(t, "https://hub.example/", d.Hub())
+	assert.Equal(t, "https://social.example/api/bob.atom", d.Self)
+}
+
+func TestDiscoverHTML(t *testing.T) {
+	d := Discover("https://blog.example/posts/", http.Header{}, []byte(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Posts &mdash; blog</title>
+<link rel="stylesheet" href="/style.css">
+<link rel="hub" href="https://hub.example/">
+<link rel="self" href="/posts/">
+</head>
+<body><p>hello<br>world</p></body>
+</html>`))
+
+	assert.Equal(t, "https://hub.example/", d.Hub())
+	assert.Equal(t, "https://blog.example/posts/", d.Self)
+}
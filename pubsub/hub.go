@@ -0,0 +1,247 @@
+package pubsub
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/workergroup"
+)
+
+type HubSubscription struct {
+	ID          string
+	Topic       string
+	CallbackURL string
+	Secret      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+type HubState interface {
+	All(topic string) (subscriptions []HubSubscription, err error)
+	Add(topic, callbackURL, secret string, expiresAt time.Time) (subscription *HubSubscription, err error)
+	Del(topic, callbackURL string) (err error)
+	Expire(before time.Time) (count int, err error)
+}
+
+type Hub struct {
+	URL           string
+	State         HubState
+	ValidateTopic func(topic string) bool
+	DefaultLease  time.Duration
+	MaxLease      time.Duration
+	Concurrency   int
+}
+
+func NewHub(hubURL string, state HubState, validateTopic func(topic string) bool) *Hub {
+	return &Hub{
+		URL:           hubURL,
+		State:         state,
+		ValidateTopic: validateTopic,
+		DefaultLease:  time.Hour * 24 * 7,
+		MaxLease:      time.Hour * 24 * 30,
+		Concurrency:   4,
+	}
+}
+
+func (h *Hub) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mode := r.PostForm.Get("hub.mode")
+	topic := r.PostForm.Get("hub.topic")
+	callbackURL := r.PostForm.Get("hub.callback")
+	secret := r.PostForm.Get("hub.secret")
+
+	if mode != "subscribe" && mode != "unsubscribe" {
+		http.Error(rw, "hub.mode must be subscribe or unsubscribe", http.StatusBadRequest)
+		return
+	}
+
+	if topic == "" || (h.ValidateTopic != nil && !h.ValidateTopic(topic)) {
+		http.Error(rw, "hub.topic is not served by this hub", http.StatusBadRequest)
+		return
+	}
+
+	if u, err := url.Parse(callbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		http.Error(rw, "hub.callback must be an http or https url", http.StatusBadRequest)
+		return
+	}
+
+	if len(secret) > 200 {
+		http.Error(rw, "hub.secret must be less than 200 bytes", http.StatusBadRequest)
+		return
+	}
+
+	lease := h.DefaultLease
+	if n, err := strconv.ParseInt(r.PostForm.Get("hub.lease_seconds"), 10, 64); err == nil && n > 0 {
+		lease = time.Second * time.Duration(n)
+	}
+	if lease > h.MaxLease {
+		lease = h.MaxLease
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+
+	go func() {
+		if err := h.verify(mode, topic, callbackURL, secret, lease); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"mode":         mode,
+				"topic":        topic,
+				"callback_url": callbackURL,
+			}).WithError(err).Warn("pubsub: hub couldn't verify intent")
+		}
+	}()
+}
+
+func (h *Hub) verify(mode, topic, callbackURL, secret string, lease time.Duration) error {
+	challenge, err := makeChallenge()
+	if err != nil {
+		return errors.Wrap(err, "Hub.verify")
+	}
+
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return errors.Wrap(err, "Hub.verify")
+	}
+
+	q := u.Query()
+	q.Set("hub.mode", mode)
+	q.Set("hub.topic", topic)
+	q.Set("hub.challenge", challenge)
+	if mode == "subscribe" {
+		q.Set("hub.lease_seconds", strconv.FormatInt(int64(lease/time.Second), 10))
+	}
+	u.RawQuery = q.Encode()
+
+	res, err := http.Get(u.String())
+	if err != nil {
+		return errors.Wrap(err, "Hub.verify")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("Hub.verify: invalid status code; expected 2xx but got %d", res.StatusCode)
+	}
+
+	d, err := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	if err != nil {
+		return errors.Wrap(err, "Hub.verify")
+	}
+
+	if string(bytes.TrimSpace(d)) != challenge {
+		return errors.Errorf("Hub.verify: subscriber didn't echo challenge")
+	}
+
+	switch mode {
+	case "subscribe":
+		if _, err := h.State.Add(topic, callbackURL, secret, time.Now().Add(lease)); err != nil {
+			return errors.Wrap(err, "Hub.verify")
+		}
+	case "unsubscribe":
+		if err := h.State.Del(topic, callbackURL); err != nil {
+			return errors.Wrap(err, "Hub.verify")
+		}
+	}
+
+	return nil
+}
+
+func (h *Hub) Publish(topic, contentType string, body []byte) error {
+	a, err := h.State.All(topic)
+	if err != nil {
+		return errors.Wrap(err, "Hub.Publish")
+	}
+
+	logrus.WithFields(logrus.Fields{"topic": topic, "count": len(a)}).Debug("pubsub: hub publishing content")
+
+	var g workergroup.Group
+
+	for _, e := range a {
+		e := e
+
+		g.Add(func() error {
+			if err := h.deliver(&e, contentType, body); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"id":           e.ID,
+					"topic":        e.Topic,
+					"callback_url": e.CallbackURL,
+				}).WithError(err).Warn("pubsub: hub couldn't deliver content")
+
+				return errors.Wrap(err, "Hub.Publish")
+			}
+
+			return nil
+		})
+	}
+
+	return errors.Wrap(g.Run(h.Concurrency), "Hub.Publish")
+}
+
+func (h *Hub) deliver(s *HubSubscription, contentType string, body []byte) error {
+	req, err := http.NewRequest("POST", s.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "Hub.deliver")
+	}
+
+	req.Header.Set("content-type", contentType)
+	req.Header.Add("link", "<"+h.URL+">; rel=\"hub\"")
+	req.Header.Add("link", "<"+s.Topic+">; rel=\"self\"")
+
+	if s.Secret != "" {
+		mac := hmac.New(sha1.New, []byte(s.Secret))
+		mac.Write(body)
+		req.Header.Set("x-hub-signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Hub.deliver")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("Hub.deliver: invalid status code; expected 2xx but got %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (h *Hub) Expire() error {
+	n, err := h.State.Expire(time.Now())
+	if err != nil {
+		return errors.Wrap(err, "Hub.Expire")
+	}
+
+	logrus.WithField("count", n).Debug("pubsub: hub expired subscriptions")
+
+	return nil
+}
+
+func makeChallenge() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
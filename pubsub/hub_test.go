@@ -0,0 +1,228 @@
+package pubsub
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTopic = "https://don.example.com/users/alice/feed"
+
+func newTestHub(t *testing.T) (*Hub, *sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "pubsub-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "pubsub.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := ioutil.ReadFile("../migrations/001_pubsub_hub.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHub("https://don.example.com/hub", NewSQLiteHubState(db), func(topic string) bool {
+		return topic == testTopic
+	})
+
+	return h, db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// waitFor polls the hub's subscriptions for a topic until there are n of
+// them, since intents are verified in the background.
+func waitFor(t *testing.T, h *Hub, n int) []HubSubscription {
+	for i := 0; i < 100; i++ {
+		a, err := h.State.All(testTopic)
+		assert.NoError(t, err)
+
+		if len(a) == n {
+			return a
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatalf("expected %d subscriptions", n)
+
+	return nil
+}
+
+func postHub(h *Hub, f url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "https://don.example.com/hub", strings.NewReader(f.Encode()))
+	r.Header.Set("content-type", "application/x-www-form-urlencoded")
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, r)
+
+	return rw
+}
+
+func TestHubSubscribe(t *testing.T) {
+	h, _, done := newTestHub(t)
+	defer done()
+
+	var m sync.Mutex
+	var challenges []url.Values
+
+	callback := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		challenges = append(challenges, r.URL.Query())
+		m.Unlock()
+
+		rw.Write([]byte(r.URL.Query().Get("hub.challenge")))
+	}))
+	defer callback.Close()
+
+	rw := postHub(h, url.Values{
+		"hub.mode":          []string{"subscribe"},
+		"hub.topic":         []string{testTopic},
+		"hub.callback":      []string{callback.URL + "/sub?id=1"},
+		"hub.secret":        []string{"hunter2"},
+		"hub.lease_seconds": []string{"999999999"},
+	})
+	assert.Equal(t, http.StatusAccepted, rw.Code)
+
+	a := waitFor(t, h, 1)
+	assert.Equal(t, callback.URL+"/sub?id=1", a[0].CallbackURL)
+	assert.Equal(t, "hunter2", a[0].Secret)
+	assert.True(t, a[0].ExpiresAt.Before(time.Now().Add(h.MaxLease+time.Minute)))
+
+	m.Lock()
+	if assert.Len(t, challenges, 1) {
+		assert.Equal(t, "subscribe", challenges[0].Get("hub.mode"))
+		assert.Equal(t, testTopic, challenges[0].Get("hub.topic"))
+		assert.Equal(t, "1", challenges[0].Get("id"))
+		assert.Equal(t, "2592000", challenges[0].Get("hub.lease_seconds"))
+	}
+	m.Unlock()
+
+	rw = postHub(h, url.Values{
+		"hub.mode":     []string{"unsubscribe"},
+		"hub.topic":    []string{testTopic},
+		"hub.callback": []string{callback.URL + "/sub?id=1"},
+	})
+	assert.Equal(t, http.StatusAccepted, rw.Code)
+
+	waitFor(t, h, 0)
+}
+
+func TestHubVerifyRejected(t *testing.T) {
+	h, _, done := newTestHub(t)
+	defer done()
+
+	callback := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wrong":
+			rw.Write([]byte("not the challenge"))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer callback.Close()
+
+	assert.Error(t, h.verify("subscribe", testTopic, callback.URL+"/wrong", "", time.Hour))
+	assert.Error(t, h.verify("subscribe", testTopic, callback.URL+"/missing", "", time.Hour))
+
+	waitFor(t, h, 0)
+}
+
+func TestHubBadRequests(t *testing.T) {
+	h, _, done := newTestHub(t)
+	defer done()
+
+	for _, e := range []struct {
+		name string
+		form url.Values
+	}{
+		{"mode", url.Values{"hub.mode": []string{"publish"}, "hub.topic": []string{testTopic}, "hub.callback": []string{"https://example.com/"}}},
+		{"topic", url.Values{"hub.mode": []string{"subscribe"}, "hub.topic": []string{"https://elsewhere.example.com/feed"}, "hub.callback": []string{"https://example.com/"}}},
+		{"callback", url.Values{"hub.mode": []string{"subscribe"}, "hub.topic": []string{testTopic}, "hub.callback": []string{"ftp://example.com/"}}},
+		{"secret", url.Values{"hub.mode": []string{"subscribe"}, "hub.topic": []string{testTopic}, "hub.callback": []string{"https://example.com/"}, "hub.secret": []string{strings.Repeat("x", 201)}}},
+	} {
+		assert.Equal(t, http.StatusBadRequest, postHub(h, e.form).Code, e.name)
+	}
+}
+
+func TestHubExpire(t *testing.T) {
+	h, db, done := newTestHub(t)
+	defer done()
+
+	_, err := h.State.Add(testTopic, "https://a.example.com/", "", time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	_, err = h.State.Add(testTopic, "https://b.example.com/", "", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	assert.NoError(t, h.Expire())
+
+	var callbacks []string
+	rows, err := db.Query("select callback_url from pubsub_hub_subscriptions")
+	assert.NoError(t, err)
+	for rows.Next() {
+		var s string
+		assert.NoError(t, rows.Scan(&s))
+		callbacks = append(callbacks, s)
+	}
+	rows.Close()
+
+	assert.Equal(t, []string{"https://b.example.com/"}, callbacks)
+}
+
+func TestHubPublish(t *testing.T) {
+	h, _, done := newTestHub(t)
+	defer done()
+
+	var m sync.Mutex
+	received := make(map[string]http.Header)
+
+	callback := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		d, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "<feed/>", string(d))
+
+		m.Lock()
+		received[r.URL.Path] = r.Header
+		m.Unlock()
+	}))
+	defer callback.Close()
+
+	_, err := h.State.Add(testTopic, callback.URL+"/signed", "hunter2", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	_, err = h.State.Add(testTopic, callback.URL+"/unsigned", "", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	assert.NoError(t, h.Publish(testTopic, "application/atom+xml", []byte("<feed/>")))
+
+	assert.Len(t, received, 2)
+
+	if hdr := received["/signed"]; assert.NotNil(t, hdr) {
+		assert.Equal(t, sign("hunter2", "<feed/>"), hdr.Get("x-hub-signature"))
+		assert.Equal(t, "application/atom+xml", hdr.Get("content-type"))
+		assert.Equal(t, []string{`<https://don.example.com/hub>; rel="hub"`, `<` + testTopic + `>; rel="self"`}, hdr["Link"])
+	}
+
+	if hdr := received["/unsigned"]; assert.NotNil(t, hdr) {
+		assert.Equal(t, "", hdr.Get("x-hub-signature"))
+		_, ok := hdr["X-Hub-Signature"]
+		assert.False(t, ok)
+	}
+}
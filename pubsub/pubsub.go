@@ -1,7 +1,9 @@
 package pubsub
 
 import (
+	"bytes"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -21,14 +23,55 @@ func MakeCallbackURL(baseURL, id string) string {
 	return baseURL + "/" + id
 }
 
+// Subscription statuses. A subscription is only confirmed when a challenge
+// matches the pending intent.
+const (
+	StatusPendingSubscribe   = "pending_subscribe"
+	StatusPendingUnsubscribe = "pending_unsubscribe"
+	StatusActive             = "active"
+	StatusDenied             = "denied"
+	StatusExpired            = "expired"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("pubsub: subscription not found")
+	ErrTopicMismatch        = errors.New("pubsub: topic doesn't match subscription")
+	ErrNoPendingIntent      = errors.New("pubsub: no pending intent for that mode")
+	ErrSubscriptionInactive = errors.New("pubsub: subscription isn't active")
+)
+
 type Subscription struct {
-	ID          string
-	Hub         string
-	Topic       string
-	CallbackURL string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	ExpiresAt   *time.Time
+	ID           string
+	Hub          string
+	Topic        string
+	CallbackURL  string
+	Secret       string
+	Status       string
+	StatusReason string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	ExpiresAt    *time.Time
+
+	// LeaseSeconds is the lease the hub granted, which may be shorter than
+	// the one we asked for.
+	LeaseSeconds  int
+	FailureCount  int
+	LastError     string
+	NextAttemptAt *time.Time
+}
+
+// Receiving reports whether messages for the subscription should be
+// accepted. Renewals go back to pending while the hub verifies them, but the
+// lease from the last verification is still good until it runs out.
+func (s *Subscription) Receiving(now time.Time) bool {
+	switch s.Status {
+	case StatusActive:
+		return true
+	case StatusPendingSubscribe:
+		return s.ExpiresAt != nil && s.ExpiresAt.After(now)
+	}
+
+	return false
 }
 
 type State interface {
@@ -37,22 +80,28 @@ type State interface {
 	Get(hub, topic string) (subscription *Subscription, err error)
 	GetByID(id string) (subscription *Subscription, err error)
 	Set(hub, topic string, updatedAt, expiresAt time.Time) (err error)
+	SetStatus(hub, topic, status, reason string) (err error)
+	Fail(hub, topic, reason string, nextAttemptAt time.Time) (err error)
 	Del(hub, topic string) (err error)
 }
 
 type MessageHandler func(id string, s *Subscription, rd io.ReadCloser)
 
 type Client struct {
-	CallbackURL string
-	State       State
-	OnMessage   MessageHandler
+	CallbackURL   string
+	State         State
+	OnMessage     MessageHandler
+	Lease         time.Duration
+	VerifyTimeout time.Duration
 }
 
 func NewClient(callbackURL string, state State, onMessage MessageHandler) *Client {
 	return &Client{
-		CallbackURL: callbackURL,
-		State:       state,
-		OnMessage:   onMessage,
+		CallbackURL:   callbackURL,
+		State:         state,
+		OnMessage:     onMessage,
+		Lease:         DefaultLease,
+		VerifyTimeout: DefaultVerifyTimeout,
 	}
 }
 
@@ -100,51 +149,91 @@ func (c *Client) Refresh(forceUpdate bool, interval time.Duration) error {
 			"id":               e.ID,
 			"hub":              e.Hub,
 			"topic":            e.Topic,
+			"status":           e.Status,
 			"callback_url":     e.CallbackURL,
 			"new_callback_url": callbackURL,
 			"created_at":       e.CreatedAt,
 			"updated_at":       e.UpdatedAt,
 			"expires_at":       e.ExpiresAt,
+			"failure_count":    e.FailureCount,
+			"next_attempt_at":  e.NextAttemptAt,
 			"force_update":     forceUpdate,
 		})
 
-		if e.ExpiresAt == nil {
-			l.Debug("pubsub: not refreshing subscription which has never been verified")
+		now := time.Now()
+
+		if e.NextAttemptAt != nil && e.NextAttemptAt.After(now) && !forceUpdate {
+			l.Debug("pubsub: backing off from failed subscription")
 			continue
 		}
 
-		if forceUpdate || e.ExpiresAt.Sub(time.Now()) < interval || e.CallbackURL != callbackURL {
-			u, err := url.Parse(e.Hub)
-			if err != nil {
-				l.WithError(err).Warn("pubsub: couldn't parse hub url")
-				return errors.Wrap(err, "Client.RefreshWorker")
+		var renew bool
+
+		switch e.Status {
+		case StatusActive:
+			if e.ExpiresAt != nil && e.ExpiresAt.Before(now) {
+				if err := c.State.SetStatus(e.Hub, e.Topic, StatusExpired, ""); err != nil {
+					return errors.Wrap(err, "Client.Refresh")
+				}
 			}
 
-			dur, ok := getBucket(u.Host).TakeMaxDuration(1, interval)
-			if !ok {
-				l.Debug("pubsub: skipping renewing for now as we'd have to wait too long")
-				continue
+			renew = forceUpdate || e.CallbackURL != callbackURL || !now.Before(RenewAt(&e, interval))
+		case StatusExpired:
+			renew = true
+		case StatusPendingSubscribe:
+			switch {
+			case e.NextAttemptAt != nil && e.UpdatedAt.Before(*e.NextAttemptAt):
+				// a retry is due, and we haven't tried since it was scheduled
+				renew = true
+			case now.Sub(e.UpdatedAt) > c.VerifyTimeout:
+				// the hub never verified this one, so we treat it like any
+				// other failure and ask again after backing off
+				if err := c.State.Fail(e.Hub, e.Topic, "hub didn't verify intent in time", now.Add(Backoff(e.FailureCount+1))); err != nil {
+					return errors.Wrap(err, "Client.Refresh")
+				}
 			}
+		}
 
-			n++
+		if !renew {
+			continue
+		}
 
-			g.Add(func() error {
-				if dur > 0 {
-					l.WithField("duration", dur).Debug("pubsub: waiting so as not to overwhelm the endpoint")
-					time.Sleep(dur)
-				}
+		u, err := url.Parse(e.Hub)
+		if err != nil {
+			l.WithError(err).Warn("pubsub: couldn't parse hub url")
+			return errors.Wrap(err, "Client.RefreshWorker")
+		}
+
+		dur, ok := getBucket(u.Host).TakeMaxDuration(1, interval)
+		if !ok {
+			l.Debug("pubsub: skipping renewing for now as we'd have to wait too long")
+			continue
+		}
+
+		n++
+
+		g.Add(func() error {
+			if dur > 0 {
+				l.WithField("duration", dur).Debug("pubsub: waiting so as not to overwhelm the endpoint")
+				time.Sleep(dur)
+			}
 
-				l.Debug("pubsub: refreshing subscription")
+			l.Debug("pubsub: refreshing subscription")
 
-				if err := c.Subscribe(e.Hub, e.Topic); err != nil {
-					l.WithError(err).Warn("pubsub: couldn't subscribe to topic")
+			if e.Status == StatusActive {
+				if err := c.State.SetStatus(e.Hub, e.Topic, StatusPendingSubscribe, ""); err != nil {
 					return errors.Wrap(err, "Client.RefreshWorker")
 				}
+			}
 
-				l.Debug("pubsub: subscribed successfully")
-				return nil
-			})
-		}
+			if err := c.Subscribe(e.Hub, e.Topic); err != nil {
+				l.WithError(err).Warn("pubsub: couldn't subscribe to topic")
+				return errors.Wrap(err, "Client.RefreshWorker")
+			}
+
+			l.Debug("pubsub: subscribed successfully")
+			return nil
+		})
 	}
 
 	return errors.Wrap(g.Run(n), "Client.Refresh")
@@ -158,14 +247,18 @@ func (c *Client) Subscribe(hub, topic string) error {
 		return errors.Wrap(err, "Client.Subscribe")
 	}
 
-	if oldCallbackURL != s.CallbackURL {
-		if oldCallbackURL != "" {
+	if s.Status == StatusPendingSubscribe {
+		if oldCallbackURL != "" && oldCallbackURL != s.CallbackURL {
 			if err := Unsubscribe(hub, topic, oldCallbackURL); err != nil {
 				return errors.Wrap(err, "Client.Subscribe")
 			}
 		}
 
-		if err := Subscribe(hub, topic, s.CallbackURL); err != nil {
+		if err := Subscribe(hub, topic, s.CallbackURL, s.Secret, c.Lease); err != nil {
+			if err := c.State.Fail(hub, topic, err.Error(), time.Now().Add(Backoff(s.FailureCount+1))); err != nil {
+				return errors.Wrap(err, "Client.Subscribe")
+			}
+
 			return errors.Wrap(err, "Client.Subscribe")
 		}
 	}
@@ -181,12 +274,13 @@ func (c *Client) Unsubscribe(hub, topic string) error {
 		return errors.Wrap(err, "Client.Unsubscribe")
 	}
 
+	// the record is removed once the hub confirms the unsubscription
 	if s != nil {
-		if err := Unsubscribe(hub, topic, s.CallbackURL); err != nil {
+		if err := c.State.SetStatus(s.Hub, s.Topic, StatusPendingUnsubscribe, ""); err != nil {
 			return errors.Wrap(err, "Client.Unsubscribe")
 		}
 
-		if err := c.State.Del(s.Hub, s.Topic); err != nil {
+		if err := Unsubscribe(hub, topic, s.CallbackURL); err != nil {
 			return errors.Wrap(err, "Client.Unsubscribe")
 		}
 	}
@@ -213,11 +307,66 @@ func (c *Client) Handler() *Handler {
 			}
 
 			if s == nil {
-				l.WithError(err).Warn("pubsub: subscription not found during challenge")
-				return errors.Errorf("Client.Handler: subscription not found")
+				l.Warn("pubsub: subscription not found during challenge")
+				return errors.Wrap(ErrSubscriptionNotFound, "Client.Handler")
+			}
+
+			if topic != s.Topic {
+				l.WithField("expected_topic", s.Topic).Warn("pubsub: rejecting challenge for wrong topic")
+				return errors.Wrap(ErrTopicMismatch, "Client.Handler")
+			}
+
+			switch {
+			case mode == "subscribe" && s.Status == StatusPendingSubscribe:
+				return errors.Wrap(c.State.Set(s.Hub, s.Topic, time.Now(), time.Now().Add(leaseTime)), "Client.Handler")
+			case mode == "unsubscribe" && s.Status == StatusPendingUnsubscribe:
+				return errors.Wrap(c.State.Del(s.Hub, s.Topic), "Client.Handler")
+			}
+
+			l.WithField("status", s.Status).Warn("pubsub: rejecting challenge with no pending intent")
+
+			return errors.Wrap(ErrNoPendingIntent, "Client.Handler")
+		},
+		OnDenied: func(id, topic, reason string) error {
+			l := logrus.WithFields(logrus.Fields{
+				"id":     id,
+				"topic":  topic,
+				"reason": reason,
+			})
+
+			s, err := c.State.GetByID(id)
+			if err != nil {
+				l.WithError(err).Warn("pubsub: error fetching subscription during denial")
+				return errors.Wrap(err, "Client.Handler")
+			}
+
+			if s == nil {
+				return errors.Wrap(ErrSubscriptionNotFound, "Client.Handler")
+			}
+
+			if topic != s.Topic {
+				return errors.Wrap(ErrTopicMismatch, "Client.Handler")
 			}
 
-			return errors.Wrap(c.State.Set(s.Hub, s.Topic, time.Now(), time.Now().Add(leaseTime)), "Client.Handler")
+			l.Warn("pubsub: subscription denied")
+
+			return errors.Wrap(c.State.SetStatus(s.Hub, s.Topic, StatusDenied, reason), "Client.Handler")
+		},
+		GetSecret: func(id string) (string, error) {
+			s, err := c.State.GetByID(id)
+			if err != nil {
+				return "", errors.Wrap(err, "Client.Handler")
+			}
+
+			if s == nil {
+				return "", errors.Wrap(ErrSubscriptionNotFound, "Client.Handler")
+			}
+
+			if !s.Receiving(time.Now()) {
+				return "", errors.Wrap(ErrSubscriptionInactive, "Client.Handler")
+			}
+
+			return s.Secret, nil
 		},
 		OnMessage: func(id, topic string, rd io.ReadCloser) {
 			l := logrus.WithFields(logrus.Fields{
@@ -236,19 +385,31 @@ func (c *Client) Handler() *Handler {
 					return
 				}
 
+				if s == nil {
+					l.Warn("pubsub: dropping message for unknown subscription")
+					return
+				}
+
 				c.OnMessage(id, s, rd)
 			}
 		},
 	}
 }
 
-func Alter(hub, topic, callbackURL, mode string) error {
+func Alter(hub, topic, callbackURL, mode, secret string, lease time.Duration) error {
 	f := url.Values{
-		"hub.callback":      []string{callbackURL},
-		"hub.mode":          []string{mode},
-		"hub.topic":         []string{topic},
-		"hub.verify":        []string{"async"},
-		"hub.lease_seconds": []string{"604800"},
+		"hub.callback": []string{callbackURL},
+		"hub.mode":     []string{mode},
+		"hub.topic":    []string{topic},
+		"hub.verify":   []string{"async"},
+	}
+
+	if lease > 0 {
+		f.Set("hub.lease_seconds", strconv.FormatInt(int64(lease/time.Second), 10))
+	}
+
+	if secret != "" {
+		f.Set("hub.secret", secret)
 	}
 
 	res, err := http.PostForm(hub, f)
@@ -264,17 +425,26 @@ func Alter(hub, topic, callbackURL, mode string) error {
 	return nil
 }
 
-func Subscribe(hub, topic, callbackURL string) error {
-	return errors.Wrap(Alter(hub, topic, callbackURL, "subscribe"), "Subscribe")
+func Subscribe(hub, topic, callbackURL, secret string, lease time.Duration) error {
+	return errors.Wrap(Alter(hub, topic, callbackURL, "subscribe", secret, lease), "Subscribe")
 }
 
 func Unsubscribe(hub, topic, callbackURL string) error {
-	return errors.Wrap(Alter(hub, topic, callbackURL, "unsubscribe"), "Subscribe")
+	return errors.Wrap(Alter(hub, topic, callbackURL, "unsubscribe", "", 0), "Unsubscribe")
 }
 
+const maxMessageSize = 4 << 20
+
 type Handler struct {
 	OnChallenge func(id, topic, mode string, leaseTime time.Duration) error
+	OnDenied    func(id, topic, reason string) error
 	OnMessage   func(id, topic string, rd io.ReadCloser)
+
+	// GetSecret returns the secret messages for a subscription are signed
+	// with. It should return ErrSubscriptionNotFound or
+	// ErrSubscriptionInactive for subscriptions that shouldn't be receiving
+	// anything.
+	GetSecret func(id string) (secret string, err error)
 }
 
 func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -300,6 +470,18 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == http.MethodGet && q.Get("hub.mode") == "denied" {
+		if h.OnDenied != nil {
+			if err := h.OnDenied(id, q.Get("hub.topic"), q.Get("hub.reason")); err != nil {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
 	if r.Method != http.MethodPost {
 		rw.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -312,9 +494,45 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		topic = a[0].URL
 	}
 
+	body := r.Body
+
+	if h.GetSecret != nil {
+		secret, err := h.GetSecret(id)
+		if err != nil {
+			switch errors.Cause(err) {
+			case ErrSubscriptionNotFound:
+				http.Error(rw, err.Error(), http.StatusNotFound)
+			case ErrSubscriptionInactive:
+				http.Error(rw, err.Error(), http.StatusGone)
+			default:
+				http.Error(rw, err.Error(), http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		if secret != "" {
+			d, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxMessageSize))
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// the spec says we have to acknowledge messages with bad
+			// signatures, but we must not act on them
+			if err := VerifySignature(r.Header.Get("x-hub-signature"), secret, d); err != nil {
+				logrus.WithFields(logrus.Fields{"id": id, "topic": topic}).WithError(err).Warn("pubsub: ignoring message with bad signature")
+				rw.WriteHeader(http.StatusAccepted)
+				return
+			}
+
+			body = ioutil.NopCloser(bytes.NewReader(d))
+		}
+	}
+
 	rw.WriteHeader(http.StatusAccepted)
 
 	if h.OnMessage != nil {
-		h.OnMessage(id, topic, r.Body)
+		h.OnMessage(id, topic, body)
 	}
 }
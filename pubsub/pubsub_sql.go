@@ -18,40 +18,47 @@ func NewSQLiteState(db *sql.DB) *SQLiteState {
 	return &SQLiteState{DB: db}
 }
 
+const subscriptionColumns = "id, hub, topic, callback_url, secret, status, status_reason, created_at, updated_at, expires_at, lease_seconds, failure_count, last_error, next_attempt_at"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSubscription(r scanner) (*Subscription, error) {
+	var v Subscription
+	if err := r.Scan(&v.ID, &v.Hub, &v.Topic, &v.CallbackURL, &v.Secret, &v.Status, &v.StatusReason, &v.CreatedAt, &v.UpdatedAt, &v.ExpiresAt, &v.LeaseSeconds, &v.FailureCount, &v.LastError, &v.NextAttemptAt); err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
 func (s *SQLiteState) All() ([]Subscription, error) {
 	s.m.Lock()
 	defer s.m.Unlock()
 
 	var a []Subscription
 
-	rows, err := s.DB.Query("select id, hub, topic, callback_url, created_at, updated_at, expires_at from pubsub_state")
+	rows, err := s.DB.Query("select " + subscriptionColumns + " from pubsub_state")
 	if err != nil {
 		return nil, errors.Wrap(err, "SQLiteState.All")
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var id, hub, topic, callbackURL string
-		var createdAt, updatedAt time.Time
-		var expiresAt *time.Time
-		if err := rows.Scan(&id, &hub, &topic, &callbackURL, &createdAt, &updatedAt, &expiresAt); err != nil {
+		v, err := scanSubscription(rows)
+		if err != nil {
 			return nil, errors.Wrap(err, "SQLiteState.All")
 		}
 
-		a = append(a, Subscription{
-			ID:          id,
-			Hub:         hub,
-			Topic:       topic,
-			CallbackURL: callbackURL,
-			CreatedAt:   createdAt,
-			UpdatedAt:   updatedAt,
-			ExpiresAt:   expiresAt,
-		})
+		a = append(a, *v)
 	}
 
 	return a, nil
 }
 
+// Add records an intent to subscribe. If the subscription needs to be sent
+// to the hub, it's returned with a status of StatusPendingSubscribe.
 func (s *SQLiteState) Add(hub, topic, baseURL string) (*Subscription, string, error) {
 	s.m.Lock()
 	defer s.m.Unlock()
@@ -62,30 +69,56 @@ func (s *SQLiteState) Add(hub, topic, baseURL string) (*Subscription, string, er
 	}
 	defer tx.Rollback()
 
-	var createdAt, updatedAt time.Time
-	var expiresAt *time.Time
-	var id, callbackURL, oldCallbackURL string
-	if err := tx.QueryRow("select id, callback_url, created_at, updated_at, expires_at from pubsub_state where hub = $1 and topic = $2", hub, topic).Scan(&id, &oldCallbackURL, &createdAt, &updatedAt, &expiresAt); err != nil {
+	var oldCallbackURL string
+
+	v, err := scanSubscription(tx.QueryRow("select "+subscriptionColumns+" from pubsub_state where hub = $1 and topic = $2", hub, topic))
+	if err != nil {
 		if err != sql.ErrNoRows {
 			return nil, "", errors.Wrap(err, "SQLiteState.Add: couldn't select subscription record")
 		}
 
-		id = uuid.NewV4().String()
-		createdAt = time.Now()
-		updatedAt = createdAt
-		callbackURL = baseURL + "/" + id
+		secret, err := MakeSecret()
+		if err != nil {
+			return nil, "", errors.Wrap(err, "SQLiteState.Add")
+		}
+
+		v = &Subscription{
+			ID:     uuid.NewV4().String(),
+			Hub:    hub,
+			Topic:  topic,
+			Secret: secret,
+			Status: StatusPendingSubscribe,
+		}
+
+		v.CreatedAt = time.Now()
+		v.UpdatedAt = v.CreatedAt
+		v.CallbackURL = baseURL + "/" + v.ID
 
-		if _, err := tx.Exec("insert into pubsub_state (id, hub, topic, callback_url, created_at, updated_at) values ($1, $2, $3, $4, $5, $6)", id, hub, topic, callbackURL, createdAt, updatedAt); err != nil {
+		if _, err := tx.Exec("insert into pubsub_state (id, hub, topic, callback_url, secret, status, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8)", v.ID, v.Hub, v.Topic, v.CallbackURL, v.Secret, v.Status, v.CreatedAt, v.UpdatedAt); err != nil {
 			return nil, "", errors.Wrap(err, "SQLiteState.Add: couldn't insert subscription record")
 		}
 	} else {
-		callbackURL = oldCallbackURL
+		oldCallbackURL = v.CallbackURL
+
+		// subscriptions made before we started sending secrets have to be
+		// renewed so the hub learns the new one
+		if v.Secret == "" {
+			secret, err := MakeSecret()
+			if err != nil {
+				return nil, "", errors.Wrap(err, "SQLiteState.Add")
+			}
+
+			v.Secret = secret
+			v.Status = StatusPendingSubscribe
+		}
 
-		if newCallbackURL := baseURL + "/" + id; newCallbackURL != oldCallbackURL {
-			callbackURL = newCallbackURL
-			updatedAt = time.Now()
+		if newCallbackURL := baseURL + "/" + v.ID; newCallbackURL != oldCallbackURL || v.Status != StatusActive {
+			v.CallbackURL = newCallbackURL
+			v.Status = StatusPendingSubscribe
+			v.StatusReason = ""
+			v.UpdatedAt = time.Now()
 
-			if _, err := tx.Exec("update pubsub_state set callback_url = $1, updated_at = $2, expires_at = NULL where id = $3", callbackURL, updatedAt, id); err != nil {
+			if _, err := tx.Exec("update pubsub_state set callback_url = $1, secret = $2, status = $3, status_reason = '', updated_at = $4 where id = $5", v.CallbackURL, v.Secret, v.Status, v.UpdatedAt, v.ID); err != nil {
 				return nil, "", errors.Wrap(err, "SQLiteState.Add: couldn't update subscription record")
 			}
 		}
@@ -95,24 +128,15 @@ func (s *SQLiteState) Add(hub, topic, baseURL string) (*Subscription, string, er
 		return nil, "", errors.Wrap(err, "SQLiteState.Add: couldn't close transaction")
 	}
 
-	return &Subscription{
-		ID:          id,
-		Hub:         hub,
-		Topic:       topic,
-		CallbackURL: callbackURL,
-		CreatedAt:   createdAt,
-		UpdatedAt:   updatedAt,
-		ExpiresAt:   expiresAt,
-	}, oldCallbackURL, nil
+	return v, oldCallbackURL, nil
 }
 
 func (s *SQLiteState) Get(hub, topic string) (*Subscription, error) {
 	s.m.Lock()
 	defer s.m.Unlock()
 
-	var v Subscription
-
-	if err := s.DB.QueryRow("select id, hub, topic, callback_url, created_at, updated_at, expires_at from pubsub_state where hub = $1 and topic = $2", hub, topic).Scan(&v.ID, &v.Hub, &v.Topic, &v.CallbackURL, &v.CreatedAt, &v.ExpiresAt); err != nil {
+	v, err := scanSubscription(s.DB.QueryRow("select "+subscriptionColumns+" from pubsub_state where hub = $1 and topic = $2", hub, topic))
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -120,16 +144,15 @@ func (s *SQLiteState) Get(hub, topic string) (*Subscription, error) {
 		return nil, errors.Wrap(err, "SQLiteState.Get: couldn't select subscription record")
 	}
 
-	return &v, nil
+	return v, nil
 }
 
 func (s *SQLiteState) GetByID(id string) (*Subscription, error) {
 	s.m.Lock()
 	defer s.m.Unlock()
 
-	var v Subscription
-
-	if err := s.DB.QueryRow("select id, hub, topic, callback_url, created_at, updated_at, expires_at from pubsub_state where id = $1", id).Scan(&v.ID, &v.Hub, &v.Topic, &v.CallbackURL, &v.CreatedAt, &v.UpdatedAt, &v.ExpiresAt); err != nil {
+	v, err := scanSubscription(s.DB.QueryRow("select "+subscriptionColumns+" from pubsub_state where id = $1", id))
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -137,20 +160,46 @@ func (s *SQLiteState) GetByID(id string) (*Subscription, error) {
 		return nil, errors.Wrap(err, "SQLiteState.GetByID: couldn't select subscription record")
 	}
 
-	return &v, nil
+	return v, nil
 }
 
+// Set marks a subscription as active once the hub has verified it, and
+// clears any record of earlier failures.
 func (s *SQLiteState) Set(hub, topic string, updatedAt, expiresAt time.Time) error {
 	s.m.Lock()
 	defer s.m.Unlock()
 
-	if _, err := s.DB.Exec("update pubsub_state set updated_at = $1, expires_at = $2 where hub = $3 and topic = $4", updatedAt, expiresAt, hub, topic); err != nil {
+	lease := int(expiresAt.Sub(updatedAt) / time.Second)
+
+	if _, err := s.DB.Exec("update pubsub_state set status = $1, status_reason = '', updated_at = $2, expires_at = $3, lease_seconds = $4, failure_count = 0, last_error = '', next_attempt_at = NULL where hub = $5 and topic = $6", StatusActive, updatedAt, expiresAt, lease, hub, topic); err != nil {
 		return errors.Wrap(err, "SQLiteState.Set: couldn't update subscription record")
 	}
 
 	return nil
 }
 
+func (s *SQLiteState) SetStatus(hub, topic, status, reason string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, err := s.DB.Exec("update pubsub_state set status = $1, status_reason = $2, updated_at = $3 where hub = $4 and topic = $5", status, reason, time.Now(), hub, topic); err != nil {
+		return errors.Wrap(err, "SQLiteState.SetStatus: couldn't update subscription record")
+	}
+
+	return nil
+}
+
+func (s *SQLiteState) Fail(hub, topic, reason string, nextAttemptAt time.Time) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, err := s.DB.Exec("update pubsub_state set failure_count = failure_count + 1, last_error = $1, next_attempt_at = $2 where hub = $3 and topic = $4", reason, nextAttemptAt, hub, topic); err != nil {
+		return errors.Wrap(err, "SQLiteState.Fail: couldn't update subscription record")
+	}
+
+	return nil
+}
+
 func (s *SQLiteState) Del(hub, topic string) error {
 	s.m.Lock()
 	defer s.m.Unlock()
@@ -161,3 +210,106 @@ func (s *SQLiteState) Del(hub, topic string) error {
 
 	return nil
 }
+
+type SQLiteHubState struct {
+	m  sync.Mutex
+	DB *sql.DB
+}
+
+func NewSQLiteHubState(db *sql.DB) *SQLiteHubState {
+	return &SQLiteHubState{DB: db}
+}
+
+func (s *SQLiteHubState) All(topic string) ([]HubSubscription, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var a []HubSubscription
+
+	rows, err := s.DB.Query("select id, topic, callback_url, secret, created_at, updated_at, expires_at from pubsub_hub_subscriptions where topic = $1 and expires_at > $2", topic, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "SQLiteHubState.All")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v HubSubscription
+		if err := rows.Scan(&v.ID, &v.Topic, &v.CallbackURL, &v.Secret, &v.CreatedAt, &v.UpdatedAt, &v.ExpiresAt); err != nil {
+			return nil, errors.Wrap(err, "SQLiteHubState.All")
+		}
+
+		a = append(a, v)
+	}
+
+	return a, nil
+}
+
+func (s *SQLiteHubState) Add(topic, callbackURL, secret string, expiresAt time.Time) (*HubSubscription, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "SQLiteHubState.Add: couldn't open transaction")
+	}
+	defer tx.Rollback()
+
+	v := HubSubscription{
+		Topic:       topic,
+		CallbackURL: callbackURL,
+		Secret:      secret,
+		UpdatedAt:   time.Now(),
+		ExpiresAt:   expiresAt,
+	}
+
+	if err := tx.QueryRow("select id, created_at from pubsub_hub_subscriptions where topic = $1 and callback_url = $2", topic, callbackURL).Scan(&v.ID, &v.CreatedAt); err != nil {
+		if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "SQLiteHubState.Add: couldn't select subscription record")
+		}
+
+		v.ID = uuid.NewV4().String()
+		v.CreatedAt = v.UpdatedAt
+
+		if _, err := tx.Exec("insert into pubsub_hub_subscriptions (id, topic, callback_url, secret, created_at, updated_at, expires_at) values ($1, $2, $3, $4, $5, $6, $7)", v.ID, v.Topic, v.CallbackURL, v.Secret, v.CreatedAt, v.UpdatedAt, v.ExpiresAt); err != nil {
+			return nil, errors.Wrap(err, "SQLiteHubState.Add: couldn't insert subscription record")
+		}
+	} else {
+		if _, err := tx.Exec("update pubsub_hub_subscriptions set secret = $1, updated_at = $2, expires_at = $3 where id = $4", v.Secret, v.UpdatedAt, v.ExpiresAt, v.ID); err != nil {
+			return nil, errors.Wrap(err, "SQLiteHubState.Add: couldn't update subscription record")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "SQLiteHubState.Add: couldn't close transaction")
+	}
+
+	return &v, nil
+}
+
+func (s *SQLiteHubState) Del(topic, callbackURL string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, err := s.DB.Exec("delete from pubsub_hub_subscriptions where topic = $1 and callback_url = $2", topic, callbackURL); err != nil {
+		return errors.Wrap(err, "SQLiteHubState.Del: couldn't delete subscription record")
+	}
+
+	return nil
+}
+
+func (s *SQLiteHubState) Expire(before time.Time) (int, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	res, err := s.DB.Exec("delete from pubsub_hub_subscriptions where expires_at <= $1", before)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQLiteHubState.Expire: couldn't delete subscription records")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "SQLiteHubState.Expire: couldn't count deleted records")
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,256 @@
+package pubsub
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memState is an in-memory State for tests.
+type memState struct {
+	m sync.Mutex
+	s map[string]*Subscription
+}
+
+func newMemState(l ...Subscription) *memState {
+	s := memState{s: make(map[string]*Subscription)}
+	for i := range l {
+		s.s[l[i].ID] = &l[i]
+	}
+
+	return &s
+}
+
+func (s *memState) find(hub, topic string) *Subscription {
+	for _, v := range s.s {
+		if v.Hub == hub && v.Topic == topic {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func (s *memState) All() ([]Subscription, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var a []Subscription
+	for _, v := range s.s {
+		a = append(a, *v)
+	}
+
+	return a, nil
+}
+
+func (s *memState) Add(hub, topic, baseURL string) (*Subscription, string, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if v := s.find(hub, topic); v != nil {
+		c := *v
+		return &c, v.CallbackURL, nil
+	}
+
+	v := Subscription{ID: hub + topic, Hub: hub, Topic: topic, CallbackURL: baseURL + "/" + hub + topic, Status: StatusPendingSubscribe}
+	s.s[v.ID] = &v
+
+	c := v
+	return &c, "", nil
+}
+
+func (s *memState) Get(hub, topic string) (*Subscription, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if v := s.find(hub, topic); v != nil {
+		c := *v
+		return &c, nil
+	}
+
+	return nil, nil
+}
+
+func (s *memState) GetByID(id string) (*Subscription, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if v, ok := s.s[id]; ok {
+		c := *v
+		return &c, nil
+	}
+
+	return nil, nil
+}
+
+func (s *memState) Set(hub, topic string, updatedAt, expiresAt time.Time) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if v := s.find(hub, topic); v != nil {
+		v.Status = StatusActive
+		v.StatusReason = ""
+		v.UpdatedAt = updatedAt
+		v.ExpiresAt = &expiresAt
+	}
+
+	return nil
+}
+
+func (s *memState) SetStatus(hub, topic, status, reason string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if v := s.find(hub, topic); v != nil {
+		v.Status = status
+		v.StatusReason = reason
+	}
+
+	return nil
+}
+
+func (s *memState) Fail(hub, topic, reason string, nextAttemptAt time.Time) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if v := s.find(hub, topic); v != nil {
+		v.FailureCount++
+		v.LastError = reason
+		v.NextAttemptAt = &nextAttemptAt
+	}
+
+	return nil
+}
+
+func (s *memState) Del(hub, topic string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if v := s.find(hub, topic); v != nil {
+		delete(s.s, v.ID)
+	}
+
+	return nil
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandlerMessages(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	state := newMemState(
+		Subscription{ID: "active", Topic: "https://example.com/feed", Secret: "s1", Status: StatusActive, ExpiresAt: &future},
+		Subscription{ID: "renewing", Topic: "https://example.com/feed", Secret: "s2", Status: StatusPendingSubscribe, ExpiresAt: &future},
+		Subscription{ID: "new", Topic: "https://example.com/feed", Secret: "s3", Status: StatusPendingSubscribe},
+		Subscription{ID: "lapsed", Topic: "https://example.com/feed", Secret: "s4", Status: StatusPendingSubscribe, ExpiresAt: &past},
+		Subscription{ID: "denied", Topic: "https://example.com/feed", Secret: "s5", Status: StatusDenied},
+	)
+
+	var received []string
+
+	c := NewClient("https://don.example.com/pubsub", state, func(id string, s *Subscription, rd io.ReadCloser) {
+		d, _ := ioutil.ReadAll(rd)
+		received = append(received, id+":"+string(d))
+	})
+
+	h := c.Handler()
+
+	for _, e := range []struct {
+		id        string
+		signature string
+		status    int
+	}{
+		{"active", sign("s1", "<feed/>"), http.StatusAccepted},
+		{"renewing", sign("s2", "<feed/>"), http.StatusAccepted},
+		{"active", sign("wrong", "<feed/>"), http.StatusAccepted},
+		{"active", "", http.StatusAccepted},
+		{"unknown", sign("s1", "<feed/>"), http.StatusNotFound},
+		{"new", sign("s3", "<feed/>"), http.StatusGone},
+		{"lapsed", sign("s4", "<feed/>"), http.StatusGone},
+		{"denied", sign("s5", "<feed/>"), http.StatusGone},
+	} {
+		r := httptest.NewRequest("POST", "https://don.example.com/pubsub/"+e.id, strings.NewReader("<feed/>"))
+		if e.signature != "" {
+			r.Header.Set("x-hub-signature", e.signature)
+		}
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, r)
+
+		assert.Equal(t, e.status, rw.Code, e.id)
+	}
+
+	// only correctly signed messages for live subscriptions get through
+	assert.Equal(t, []string{"active:<feed/>", "renewing:<feed/>"}, received)
+}
+
+func TestHandlerChallenges(t *testing.T) {
+	const topic = "https://example.com/feed"
+
+	subscriptions := func() []Subscription {
+		return []Subscription{
+			{ID: "subscribing", Hub: "https://hub.example.com/", Topic: topic, Status: StatusPendingSubscribe},
+			{ID: "unsubscribing", Hub: "https://hub.example.com/", Topic: topic + "/2", Status: StatusPendingUnsubscribe},
+			{ID: "active", Hub: "https://hub.example.com/", Topic: topic + "/3", Status: StatusActive},
+		}
+	}
+
+	for _, e := range []struct {
+		name   string
+		id     string
+		query  string
+		status int
+		body   string
+		after  string
+		reason string
+	}{
+		{"subscribe", "subscribing", "hub.mode=subscribe&hub.topic=" + topic + "&hub.challenge=abc&hub.lease_seconds=60", http.StatusOK, "abc", StatusActive, ""},
+		{"subscribe wrong topic", "subscribing", "hub.mode=subscribe&hub.topic=https://evil.example.com/&hub.challenge=abc", http.StatusNotFound, "", StatusPendingSubscribe, ""},
+		{"subscribe unknown id", "missing", "hub.mode=subscribe&hub.topic=" + topic + "&hub.challenge=abc", http.StatusNotFound, "", "", ""},
+		{"unsubscribe", "unsubscribing", "hub.mode=unsubscribe&hub.topic=" + topic + "/2&hub.challenge=abc", http.StatusOK, "abc", "", ""},
+		{"unsubscribe not asked for", "active", "hub.mode=unsubscribe&hub.topic=" + topic + "/3&hub.challenge=abc", http.StatusNotFound, "", StatusActive, ""},
+		{"unsubscribe while subscribing", "subscribing", "hub.mode=unsubscribe&hub.topic=" + topic + "&hub.challenge=abc", http.StatusNotFound, "", StatusPendingSubscribe, ""},
+		{"subscribe not asked for", "unsubscribing", "hub.mode=subscribe&hub.topic=" + topic + "/2&hub.challenge=abc", http.StatusNotFound, "", StatusPendingUnsubscribe, ""},
+		{"denied", "subscribing", "hub.mode=denied&hub.topic=" + topic + "&hub.reason=go+away", http.StatusOK, "", StatusDenied, "go away"},
+		{"denied wrong topic", "subscribing", "hub.mode=denied&hub.topic=https://evil.example.com/&hub.reason=go+away", http.StatusNotFound, "", StatusPendingSubscribe, ""},
+		{"denied unknown id", "missing", "hub.mode=denied&hub.topic=" + topic + "&hub.reason=go+away", http.StatusNotFound, "", "", ""},
+	} {
+		state := newMemState(subscriptions()...)
+
+		h := NewClient("https://don.example.com/pubsub", state, nil).Handler()
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "https://don.example.com/pubsub/"+e.id+"?"+e.query, nil))
+
+		assert.Equal(t, e.status, rw.Code, e.name)
+		assert.Equal(t, e.body, rw.Body.String(), e.name)
+
+		s, err := state.GetByID(e.id)
+		assert.NoError(t, err, e.name)
+
+		if e.after == "" {
+			assert.Nil(t, s, e.name)
+			continue
+		}
+
+		if assert.NotNil(t, s, e.name) {
+			assert.Equal(t, e.after, s.Status, e.name)
+			assert.Equal(t, e.reason, s.StatusReason, e.name)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package pubsub
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSignatureMissing     = errors.New("pubsub: message isn't signed")
+	ErrSignatureMalformed   = errors.New("pubsub: couldn't parse signature")
+	ErrSignatureUnsupported = errors.New("pubsub: unsupported signature method")
+	ErrSignatureMismatch    = errors.New("pubsub: signature doesn't match")
+)
+
+var signatureMethods = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// MakeSecret generates a random secret to send as hub.secret.
+func MakeSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "MakeSecret")
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// VerifySignature checks an X-Hub-Signature header value against a body.
+func VerifySignature(header, secret string, body []byte) error {
+	if header == "" {
+		return errors.Wrap(ErrSignatureMissing, "VerifySignature")
+	}
+
+	i := strings.Index(header, "=")
+	if i == -1 {
+		return errors.Wrap(ErrSignatureMalformed, "VerifySignature")
+	}
+
+	fn, ok := signatureMethods[strings.ToLower(strings.TrimSpace(header[:i]))]
+	if !ok {
+		return errors.Wrap(ErrSignatureUnsupported, "VerifySignature")
+	}
+
+	want, err := hex.DecodeString(strings.TrimSpace(header[i+1:]))
+	if err != nil {
+		return errors.Wrap(ErrSignatureMalformed, "VerifySignature")
+	}
+
+	mac := hmac.New(fn, []byte(secret))
+	mac.Write(body)
+
+	if !hmac.Equal(mac.Sum(nil), want) {
+		return errors.Wrap(ErrSignatureMismatch, "VerifySignature")
+	}
+
+	return nil
+}
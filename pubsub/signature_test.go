@@ -0,0 +1,32 @@
+package pubsub
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte("<feed/>")
+
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write(body)
+	assert.NoError(t, VerifySignature("sha1="+hex.EncodeToString(mac.Sum(nil)), "secret", body))
+
+	mac = hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	sig := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	assert.NoError(t, VerifySignature(sig, "secret", body))
+
+	assert.Equal(t, ErrSignatureMismatch, errors.Cause(VerifySignature(sig, "other", body)))
+	assert.Equal(t, ErrSignatureMismatch, errors.Cause(VerifySignature(sig, "secret", []byte("<feed></feed>"))))
+	assert.Equal(t, ErrSignatureMissing, errors.Cause(VerifySignature("", "secret", body)))
+	assert.Equal(t, ErrSignatureUnsupported, errors.Cause(VerifySignature("md5=abcd", "secret", body)))
+	assert.Equal(t, ErrSignatureMalformed, errors.Cause(VerifySignature("sha256=zz", "secret", body)))
+	assert.Equal(t, ErrSignatureMalformed, errors.Cause(VerifySignature("sha256", "secret", body)))
+}
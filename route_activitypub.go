@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/timewasted/go-accept-headers"
+
+	"fknsrs.biz/p/don/activitypub"
+)
+
+const activityPubMaxBodySize = 1 << 20
+
+func isActivityPubRequest(r *http.Request, rm *mux.RouteMatch) bool {
+	ct, err := accept.Parse(r.Header.Get("accept")).Negotiate("text/html", activitypub.MimeType, "application/ld+json")
+	if err != nil {
+		return false
+	}
+
+	return ct == activitypub.MimeType || ct == "application/ld+json"
+}
+
+func writeActivityPub(rw http.ResponseWriter, v interface{}) {
+	d, err := json.Marshal(v)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("content-type", activitypub.MimeType+"; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+
+	if _, err := rw.Write(d); err != nil {
+		logrus.WithError(err).Warn("error sending activitypub document")
+	}
+}
+
+func (a *App) handleUserActorGet(rw http.ResponseWriter, r *http.Request) {
+	u, err := a.getUserByUsername(mux.Vars(r)["username"])
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if u == nil {
+		http.Error(rw, errUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	publicKey, err := a.getUserPublicKey(u.ID)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	publicKeyPEM, err := encodeUserPublicKey(publicKey)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeActivityPub(rw, makeUserActor(u, publicKeyPEM))
+}
+
+func (a *App) handleInstanceActorGet(rw http.ResponseWriter, r *http.Request) {
+	publicKeyPEM, _, err := a.getInstanceKey()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeActivityPub(rw, makeInstanceActor(publicKeyPEM))
+}
+
+func (a *App) handleUserOutboxGet(rw http.ResponseWriter, r *http.Request) {
+	u, err := a.getUserByUsername(mux.Vars(r)["username"])
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if u == nil {
+		http.Error(rw, errUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("page") == "" {
+		var count int
+		if err := a.SQLDB.QueryRow("select count(1) from activities where actor = $1 and verb = $2", userAccountURL(u.Username).String(), "http://activitystrea.ms/schema/1.0/post").Scan(&count); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeActivityPub(rw, &activitypub.Collection{
+			Context:    activitypub.Context,
+			ID:         userOutboxURL(u.Username),
+			Type:       "OrderedCollection",
+			TotalItems: &count,
+			First:      activitypub.NewRef(userOutboxURL(u.Username) + "?page=true"),
+		})
+
+		return
+	}
+
+	// the decoder rejects fields it doesn't know about, and page is only
+	// here to tell us to return a page rather than the collection
+	var v struct {
+		Page   string    `schema:"page"`
+		After  time.Time `schema:"after"`
+		Before time.Time `schema:"before"`
+	}
+	if err := decoder.Decode(&v, r.URL.Query()); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{
+		After:   v.After,
+		Before:  v.Before,
+		Account: userAccountURL(u.Username).String(),
+	})
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := activitypub.Collection{
+		Context:      activitypub.Context,
+		ID:           *publicURL + r.URL.RequestURI(),
+		Type:         "OrderedCollectionPage",
+		PartOf:       userOutboxURL(u.Username),
+		OrderedItems: []activitypub.Ref{},
+	}
+
+	for i := range activities {
+		if activities[i].Verb != "http://activitystrea.ms/schema/1.0/post" {
+			continue
+		}
+
+		create, err := makeCreate(u, &activities[i])
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		item, err := activitypub.Embed(create)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		page.OrderedItems = append(page.OrderedItems, *item)
+	}
+
+	if len(activities) >= timelinePageSize {
+		page.Next = userOutboxURL(u.Username) + "?page=true&before=" + url.QueryEscape(activities[len(activities)-1].Time.Format(time.RFC3339Nano))
+	}
+
+	writeActivityPub(rw, &page)
+}
+
+func (a *App) handleUserStatusObjectGet(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	u, err := a.getUserByUsername(vars["username"])
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if u == nil {
+		http.Error(rw, errUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{Permalink: userStatusURL(u.Username, vars["id"])})
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(activities) == 0 {
+		http.Error(rw, errStatusNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	note := makeNote(u, &activities[0])
+	note.Context = activitypub.Context
+
+	writeActivityPub(rw, note)
+}
+
+func (a *App) handleUserInboxPost(rw http.ResponseWriter, r *http.Request) {
+	u, err := a.getUserByUsername(mux.Vars(r)["username"])
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if u == nil {
+		http.Error(rw, errUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	a.receiveInbox(rw, r, logrus.WithField("username", u.Username))
+}
+
+func (a *App) handleSharedInboxPost(rw http.ResponseWriter, r *http.Request) {
+	a.receiveInbox(rw, r, logrus.WithField("inbox", "shared"))
+}
+
+func (a *App) receiveInbox(rw http.ResponseWriter, r *http.Request, l *logrus.Entry) {
+	d, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, activityPubMaxBodySize))
+	if err != nil {
+		l.WithError(err).Warn("activitypub: couldn't read body")
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var act activitypub.Activity
+	if err := activitypub.Parse(d, &act); err != nil {
+		l.WithError(err).Warn("activitypub: couldn't parse activity")
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l = l.WithFields(logrus.Fields{
+		"id":    act.ID,
+		"type":  act.Type,
+		"actor": act.Actor.GetID(),
+	})
+
+	owner, err := verifyActivityPubRequest(r, d)
+	if err != nil {
+		l.WithError(err).Warn("activitypub: rejecting request with bad signature")
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if owner != act.Actor.GetID() {
+		l.WithField("signer", owner).WithError(errActivityPubActorMismatch).Warn("activitypub: rejecting activity signed by someone else")
+		http.Error(rw, errActivityPubActorMismatch.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := a.receiveActivity(&act); err != nil {
+		switch errors.Cause(err) {
+		case errActivityPubUnsupported, errActivityPubActorMissing, errActivityPubObjectMissing, errActivityPubNoUsername, errActivityPubFollowNotLocal:
+			l.WithError(err).Warn("activitypub: rejecting activity")
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+		case errActivityPubActorMismatch:
+			l.WithError(err).Warn("activitypub: rejecting activity")
+			http.Error(rw, err.Error(), http.StatusForbidden)
+		default:
+			l.WithError(err).Error("activitypub: couldn't handle activity")
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	l.Info("activitypub: accepted activity")
+
+	rw.WriteHeader(http.StatusAccepted)
+}
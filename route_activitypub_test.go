@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/don/activitypub"
+	"fknsrs.biz/p/don/httpsig"
+)
+
+func TestUserOutboxPages(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	_, err := a.SQLDB.Exec("insert into users (id, created_at, username, email, hash) values ('u1', $1, 'alice', 'alice@example.com', '')", time.Now())
+	assert.NoError(t, err)
+
+	base := time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("%s/statuses/%d", userProfileURL("alice"), i)
+
+		_, err := a.SQLDB.Exec("insert into objects (id, content) values ($1, $2)", id, fmt.Sprintf("post %d", i))
+		assert.NoError(t, err)
+		_, err = a.SQLDB.Exec("insert into activities (id, permalink, actor, object, verb, time, title) values ($1, $1, $2, $1, $3, $4, '')", id, userAccountURL("alice").String(), verbPost, base.Add(time.Hour*time.Duration(i)))
+		assert.NoError(t, err)
+	}
+
+	get := func(query string) (int, *activitypub.Collection) {
+		m := mux.NewRouter()
+		m.Path("/users/{username}/outbox").HandlerFunc(a.handleUserOutboxGet)
+
+		rw := httptest.NewRecorder()
+		m.ServeHTTP(rw, httptest.NewRequest("GET", userOutboxURL("alice")+query, nil))
+
+		var c activitypub.Collection
+		if rw.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &c))
+		}
+
+		return rw.Code, &c
+	}
+
+	code, c := get("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, *c.TotalItems)
+
+	code, c = get("?page=true")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, c.OrderedItems, 3)
+
+	code, c = get("?page=true&before=" + url.QueryEscape(base.Add(time.Hour*2).Format(time.RFC3339)))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, c.OrderedItems, 2)
+
+	code, _ = get("?page=true&bogus=1")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestUserInboxSignatures(t *testing.T) {
+	a, done := newTestApp(t)
+	defer done()
+
+	_, err := a.SQLDB.Exec("insert into users (id, created_at, username, email, hash) values ('u1', $1, 'bob', 'bob@example.com', '')", time.Now())
+	assert.NoError(t, err)
+
+	aliceKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	evilKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+
+	documents := make(map[string]*activitypub.Actor)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		actor, ok := documents[r.URL.Path]
+		if !ok {
+			http.NotFound(rw, r)
+			return
+		}
+
+		rw.Header().Set("content-type", activitypub.MimeType)
+		json.NewEncoder(rw).Encode(actor)
+	}))
+	defer srv.Close()
+
+	addActor := func(path, id, owner string, k *rsa.PrivateKey) {
+		pem, err := encodeUserPublicKey(&k.PublicKey)
+		assert.NoError(t, err)
+
+		documents[path] = &activitypub.Actor{
+			Object:            activitypub.Object{ID: id, Type: "Person"},
+			PreferredUsername: strings.TrimPrefix(path, "/users/"),
+			Inbox:             srv.URL + path + "/inbox",
+			PublicKey:         &activitypub.PublicKey{ID: srv.URL + path + "#main-key", Owner: owner, PublicKeyPem: pem},
+		}
+	}
+
+	alice := srv.URL + "/users/alice"
+
+	// alice is who she says she is
+	addActor("/users/alice", alice, alice, aliceKey)
+	// mallory's key is really his own
+	addActor("/users/mallory", srv.URL+"/users/mallory", srv.URL+"/users/mallory", evilKey)
+	// a key document served from one place that claims to be alice
+	addActor("/users/forged", alice, alice, evilKey)
+	// a document that's really carol's, but gives alice as the key's owner
+	addActor("/users/carol", srv.URL+"/users/carol", alice, evilKey)
+
+	post := func(n int, keyID string, k *rsa.PrivateKey) int {
+		note, err := activitypub.Embed(&activitypub.Object{
+			ID:           fmt.Sprintf("%s/notes/%d", alice, n),
+			Type:         "Note",
+			Content:      "<p>hello</p>",
+			AttributedTo: activitypub.NewRef(alice),
+		})
+		assert.NoError(t, err)
+
+		d, err := json.Marshal(&activitypub.Activity{
+			ID:     fmt.Sprintf("%s/notes/%d/activity", alice, n),
+			Type:   "Create",
+			Actor:  activitypub.NewRef(alice),
+			Object: note,
+		})
+		assert.NoError(t, err)
+
+		r := httptest.NewRequest("POST", userInboxURL("bob"), bytes.NewReader(d))
+		r.Header.Set("content-type", activitypub.MimeType)
+		assert.NoError(t, httpsig.NewSigner(keyID, k).Sign(r, d))
+
+		m := mux.NewRouter()
+		m.Path("/users/{username}/inbox").HandlerFunc(a.handleUserInboxPost)
+
+		rw := httptest.NewRecorder()
+		m.ServeHTTP(rw, r)
+
+		return rw.Code
+	}
+
+	assert.Equal(t, http.StatusAccepted, post(1, alice+"#main-key", aliceKey))
+	assert.Equal(t, http.StatusForbidden, post(2, srv.URL+"/users/mallory#main-key", evilKey))
+	assert.Equal(t, http.StatusUnauthorized, post(3, srv.URL+"/users/forged#main-key", evilKey))
+	assert.Equal(t, http.StatusUnauthorized, post(4, srv.URL+"/users/carol#main-key", evilKey))
+	assert.Equal(t, http.StatusUnauthorized, post(5, alice+"#main-key", evilKey))
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{})
+	assert.NoError(t, err)
+	if assert.Len(t, activities, 1) {
+		assert.Equal(t, alice+"/notes/1", activities[0].ID)
+	}
+}
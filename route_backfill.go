@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/activitypub"
+)
+
+var (
+	errBackfillNotLoggedIn = errors.New("you need to be logged in to backfill accounts")
+)
+
+func (a *App) handlePersonBackfillPost(r *http.Request, ar *AppResponse) *AppResponse {
+	if ar.User == nil {
+		return ar.WithStatus(http.StatusUnauthorized).WithError(errors.Wrap(errBackfillNotLoggedIn, "App.handlePersonBackfillPost"))
+	}
+
+	personID, err := a.userBackfill(mux.Vars(r)["account"])
+	if err != nil {
+		ar = ar.WithError(errors.Wrap(err, "App.handlePersonBackfillPost: couldn't backfill account"))
+
+		switch errors.Cause(err) {
+		case errBackfillRunning:
+			return ar.WithStatus(http.StatusConflict)
+		case errFollowNoFeed:
+			return ar.WithStatus(http.StatusNotFound)
+		default:
+			return ar
+		}
+	}
+
+	b, err := a.getBackfill(personID)
+	if err != nil {
+		return ar.WithError(errors.Wrap(err, "App.handlePersonBackfillPost"))
+	}
+
+	return ar.WithStatus(http.StatusAccepted).ShallowMergeState(map[string]interface{}{
+		"backfill": map[string]interface{}{
+			"loading":  false,
+			"error":    nil,
+			"backfill": b,
+		},
+	})
+}
+
+// userBackfill starts backfilling an account, returning the id of the person
+// it's for. ActivityPub accounts have their outbox walked the same way feeds
+// have their rel=next links followed.
+func (a *App) userBackfill(account string) (string, error) {
+	accountURL, err := parseAccount(account)
+	if err != nil {
+		return "", errors.Wrap(err, "App.userBackfill")
+	}
+
+	wf, err := fetchWebfinger(accountURL)
+	if err != nil {
+		return "", errors.Wrap(err, "App.userBackfill")
+	}
+
+	if actorURL := findActivityPubActor(wf); actorURL != "" {
+		actor, err := activitypub.FetchActor(actorURL)
+		if err != nil {
+			return "", errors.Wrap(err, "App.userBackfill")
+		}
+
+		person, err := a.saveActor(actor)
+		if err != nil {
+			return "", errors.Wrap(err, "App.userBackfill")
+		}
+
+		if actor.Outbox == "" {
+			return "", errors.Wrap(errFollowNoFeed, "App.userBackfill")
+		}
+
+		if err := a.startBackfill(person.ID, actor.Outbox, func(_, pageURL string, cutoff time.Time) (*backfillPage, error) {
+			return a.backfillOutboxPage(actor, person, pageURL, cutoff)
+		}); err != nil {
+			return "", errors.Wrap(err, "App.userBackfill")
+		}
+
+		return person.ID, nil
+	}
+
+	feedLink := wf.GetLink("http://schemas.google.com/g/2010#updates-from")
+	if feedLink == nil || feedLink.Href == "" {
+		return "", errors.Wrap(errFollowNoFeed, "App.userBackfill")
+	}
+
+	if err := a.startBackfill(accountURL.String(), feedLink.Href, a.backfillFeedPage); err != nil {
+		return "", errors.Wrap(err, "App.userBackfill")
+	}
+
+	return accountURL.String(), nil
+}
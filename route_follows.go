@@ -0,0 +1,420 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/don/acct"
+	"fknsrs.biz/p/don/activitypub"
+	"fknsrs.biz/p/don/activitystreams"
+	"fknsrs.biz/p/don/commonxml"
+	"fknsrs.biz/p/don/pubsub"
+	"fknsrs.biz/p/don/salmon"
+)
+
+var (
+	errFollowNotLoggedIn = errors.New("you need to be logged in to follow people")
+	errFollowNoFeed      = errors.New("that account doesn't publish a feed")
+	errFollowNotFound    = errors.New("you don't follow that account")
+)
+
+func (a *App) handlePersonFollowPost(r *http.Request, ar *AppResponse) *AppResponse {
+	if ar.User == nil {
+		return ar.WithStatus(http.StatusUnauthorized).WithError(errors.Wrap(errFollowNotLoggedIn, "App.handlePersonFollowPost"))
+	}
+
+	person, err := a.userFollow(ar.User, mux.Vars(r)["account"])
+	if err != nil {
+		return ar.WithError(errors.Wrap(err, "App.handlePersonFollowPost: couldn't follow account"))
+	}
+
+	return ar.ShallowMergeState(map[string]interface{}{
+		"follow": map[string]interface{}{
+			"loading": false,
+			"error":   nil,
+			"person":  person,
+		},
+	}).WithRedirect("/")
+}
+
+func (a *App) handlePersonUnfollowPost(r *http.Request, ar *AppResponse) *AppResponse {
+	if ar.User == nil {
+		return ar.WithStatus(http.StatusUnauthorized).WithError(errors.Wrap(errFollowNotLoggedIn, "App.handlePersonUnfollowPost"))
+	}
+
+	if err := a.userUnfollow(ar.User, mux.Vars(r)["account"]); err != nil {
+		ar = ar.WithError(errors.Wrap(err, "App.handlePersonUnfollowPost: couldn't unfollow account"))
+
+		switch errors.Cause(err) {
+		case errFollowNotFound:
+			return ar.WithStatus(http.StatusNotFound)
+		default:
+			return ar
+		}
+	}
+
+	return ar.ShallowMergeState(map[string]interface{}{
+		"follow": map[string]interface{}{
+			"loading": false,
+			"error":   nil,
+			"person":  nil,
+		},
+	}).WithRedirect("/")
+}
+
+func parseAccount(s string) (*acct.URL, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "acct:"), "@")
+
+	u, err := acct.FromString("acct:" + s)
+	if err != nil {
+		return nil, errors.Wrap(err, "parseAccount")
+	}
+
+	return u, nil
+}
+
+func (a *App) userFollow(u *User, account string) (*Person, error) {
+	accountURL, err := parseAccount(account)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userFollow")
+	}
+
+	wf, err := fetchWebfinger(accountURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userFollow")
+	}
+
+	if actorURL := findActivityPubActor(wf); actorURL != "" {
+		return a.userFollowActivityPub(u, actorURL)
+	}
+
+	feedLink := wf.GetLink("http://schemas.google.com/g/2010#updates-from")
+	if feedLink == nil || feedLink.Href == "" {
+		return nil, errors.Wrap(errFollowNoFeed, "App.userFollow")
+	}
+
+	feedHeader, feedData, err := a.getFeed(feedLink.Href)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userFollow: couldn't fetch feed")
+	}
+
+	feed, err := activitystreams.ParseAny(feedHeader.Get("content-type"), feedData)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userFollow: couldn't parse feed")
+	}
+
+	feed.SetFetchedFrom(feedLink.Href)
+
+	permalink := feedLink.Href
+	if l := wf.GetLink("http://webfinger.net/rel/profile-page"); l != nil && l.Href != "" {
+		permalink = l.Href
+	} else if feed.Author != nil && feed.Author.URI != "" {
+		permalink = feed.Author.URI
+	}
+
+	var displayName, summary, avatar string
+	if feed.Author != nil {
+		displayName = feed.Author.DisplayName
+		summary = feed.Author.Summary
+		avatar = feed.Author.GetBestAvatar()
+	}
+
+	person, err := a.storePerson(accountURL, permalink, personProtocolOStatus, displayName, summary, avatar)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userFollow")
+	}
+
+	salmonURL := feed.GetSalmon()
+	if l := wf.GetLink("salmon"); l != nil && l.Href != "" {
+		salmonURL = l.Href
+	}
+
+	var count int
+	if err := a.SQLDB.QueryRow("select count(1) from follows where user_id = $1 and person_id = $2", u.ID, person.ID).Scan(&count); err != nil {
+		return nil, errors.Wrap(err, "App.userFollow: couldn't query for existing follow")
+	}
+	if count > 0 {
+		return person, nil
+	}
+
+	disc := pubsub.Discover(feedLink.Href, feedHeader, feedData)
+
+	topic := disc.Self
+	if topic == "" {
+		topic = feedLink.Href
+	}
+
+	if _, err := a.SQLDB.Exec("insert into follows (user_id, person_id, created_at, protocol, hub, topic, salmon) values ($1, $2, $3, $4, $5, $6, $7)", u.ID, person.ID, time.Now(), personProtocolOStatus, disc.Hub(), topic, salmonURL); err != nil {
+		return nil, errors.Wrap(err, "App.userFollow: couldn't save follow")
+	}
+
+	if hub := disc.Hub(); hub != "" {
+		err = a.PubSub.Subscribe(hub, topic)
+	} else {
+		err = a.Poller.Add(topic)
+	}
+	if err != nil {
+		// leave no follow behind that nothing is feeding
+		if _, err := a.SQLDB.Exec("delete from follows where user_id = $1 and person_id = $2", u.ID, person.ID); err != nil {
+			logrus.WithField("person", person.ID).WithError(err).Warn("follow: couldn't remove follow")
+		}
+
+		return nil, errors.Wrap(err, "App.userFollow")
+	}
+
+	for _, e := range feed.Activities {
+		if err := a.saveActivity(&e); err != nil {
+			logrus.WithField("id", e.ID).WithError(err).Debug("follow: couldn't save entry")
+		}
+	}
+
+	if err := a.startBackfill(person.ID, feedLink.Href, a.backfillFeedPage); err != nil {
+		logrus.WithField("person", person.ID).WithError(err).Debug("follow: couldn't start backfill")
+	}
+
+	if salmonURL != "" {
+		if err := a.sendUserSalmon(u, salmonURL, makeFollowEntry(u, person, "http://activitystrea.ms/schema/1.0/follow", u.Username+" started following "+person.ID)); err != nil {
+			logrus.WithField("person", person.ID).WithError(err).Warn("follow: couldn't send salmon")
+		}
+	}
+
+	return person, nil
+}
+
+func (a *App) userFollowActivityPub(u *User, actorURL string) (*Person, error) {
+	actor, err := activitypub.FetchActor(actorURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userFollowActivityPub")
+	}
+
+	person, err := a.saveActor(actor)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userFollowActivityPub")
+	}
+
+	var count int
+	if err := a.SQLDB.QueryRow("select count(1) from follows where user_id = $1 and person_id = $2", u.ID, person.ID).Scan(&count); err != nil {
+		return nil, errors.Wrap(err, "App.userFollowActivityPub: couldn't query for existing follow")
+	}
+	if count > 0 {
+		return person, nil
+	}
+
+	signer, err := a.getUserSigner(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userFollowActivityPub")
+	}
+
+	follow := activitypub.Activity{
+		Context: activitypub.Context,
+		ID:      userProfileURL(u.Username) + "#follows/" + uuid.NewV4().String(),
+		Type:    "Follow",
+		Actor:   activitypub.NewRef(userProfileURL(u.Username)),
+		Object:  activitypub.NewRef(actor.ID),
+	}
+
+	if err := activitypub.Post(actor.Inbox, &follow, signer); err != nil {
+		return nil, errors.Wrap(err, "App.userFollowActivityPub: couldn't deliver follow")
+	}
+
+	if _, err := a.SQLDB.Exec("insert into follows (user_id, person_id, created_at, protocol, inbox, follow_id, actor) values ($1, $2, $3, $4, $5, $6, $7)", u.ID, person.ID, time.Now(), personProtocolActivityPub, actor.Inbox, follow.ID, actor.ID); err != nil {
+		return nil, errors.Wrap(err, "App.userFollowActivityPub: couldn't save follow")
+	}
+
+	if err := a.backfillOutbox(actor, person); err != nil {
+		logrus.WithField("person", person.ID).WithError(err).Warn("follow: couldn't backfill outbox")
+	}
+
+	return person, nil
+}
+
+// findFollowedPerson works out which person a follow of an account was
+// recorded against. ActivityPub people are stored under the host their actor
+// lives on, which isn't always the host in their account name, so if there's
+// no direct match the actor is found through webfinger instead.
+func (a *App) findFollowedPerson(u *User, accountURL *acct.URL) (string, error) {
+	var count int
+	if err := a.SQLDB.QueryRow("select count(1) from follows where user_id = $1 and person_id = $2", u.ID, accountURL.String()).Scan(&count); err != nil {
+		return "", errors.Wrap(err, "App.findFollowedPerson: couldn't query for follow")
+	}
+	if count > 0 {
+		return accountURL.String(), nil
+	}
+
+	wf, err := fetchWebfinger(accountURL)
+	if err != nil {
+		return "", errors.Wrap(err, "App.findFollowedPerson")
+	}
+
+	actorURL := findActivityPubActor(wf)
+	if actorURL == "" {
+		return "", errors.Wrap(errFollowNotFound, "App.findFollowedPerson")
+	}
+
+	var personID string
+	if err := a.SQLDB.QueryRow("select person_id from follows where user_id = $1 and actor = $2", u.ID, actorURL).Scan(&personID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.Wrap(errFollowNotFound, "App.findFollowedPerson")
+		}
+
+		return "", errors.Wrap(err, "App.findFollowedPerson: couldn't query for follow")
+	}
+
+	return personID, nil
+}
+
+func (a *App) userUnfollow(u *User, account string) error {
+	accountURL, err := parseAccount(account)
+	if err != nil {
+		return errors.Wrap(err, "App.userUnfollow")
+	}
+
+	personID, err := a.findFollowedPerson(u, accountURL)
+	if err != nil {
+		return errors.Wrap(err, "App.userUnfollow")
+	}
+
+	var protocol string
+	var hub, topic, salmonURL, inbox, followID, actor sql.NullString
+	if err := a.SQLDB.QueryRow("select protocol, hub, topic, salmon, inbox, follow_id, actor from follows where user_id = $1 and person_id = $2", u.ID, personID).Scan(&protocol, &hub, &topic, &salmonURL, &inbox, &followID, &actor); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.Wrap(errFollowNotFound, "App.userUnfollow")
+		}
+
+		return errors.Wrap(err, "App.userUnfollow: couldn't query for follow")
+	}
+
+	if _, err := a.SQLDB.Exec("delete from follows where user_id = $1 and person_id = $2", u.ID, personID); err != nil {
+		return errors.Wrap(err, "App.userUnfollow: couldn't delete follow")
+	}
+
+	if protocol == personProtocolActivityPub {
+		if inbox.String == "" {
+			return nil
+		}
+
+		signer, err := a.getUserSigner(u)
+		if err != nil {
+			return errors.Wrap(err, "App.userUnfollow")
+		}
+
+		follow, err := activitypub.Embed(&activitypub.Activity{
+			ID:     followID.String,
+			Type:   "Follow",
+			Actor:  activitypub.NewRef(userProfileURL(u.Username)),
+			Object: activitypub.NewRef(actor.String),
+		})
+		if err != nil {
+			return errors.Wrap(err, "App.userUnfollow")
+		}
+
+		undo := activitypub.Activity{
+			Context: activitypub.Context,
+			ID:      userProfileURL(u.Username) + "#undo/" + uuid.NewV4().String(),
+			Type:    "Undo",
+			Actor:   activitypub.NewRef(userProfileURL(u.Username)),
+			Object:  follow,
+		}
+
+		if err := activitypub.Post(inbox.String, &undo, signer); err != nil {
+			logrus.WithField("person", personID).WithError(err).Warn("unfollow: couldn't deliver undo")
+		}
+
+		return nil
+	}
+
+	if hub.String != "" && topic.String != "" {
+		var count int
+		if err := a.SQLDB.QueryRow("select count(1) from follows where hub = $1 and topic = $2", hub.String, topic.String).Scan(&count); err != nil {
+			return errors.Wrap(err, "App.userUnfollow: couldn't count remaining follows")
+		}
+
+		if count == 0 {
+			if err := a.PubSub.Unsubscribe(hub.String, topic.String); err != nil {
+				return errors.Wrap(err, "App.userUnfollow")
+			}
+		}
+	} else if topic.String != "" {
+		var count int
+		if err := a.SQLDB.QueryRow("select count(1) from follows where topic = $1", topic.String).Scan(&count); err != nil {
+			return errors.Wrap(err, "App.userUnfollow: couldn't count remaining follows")
+		}
+
+		if count == 0 {
+			if err := a.Poller.Del(topic.String); err != nil {
+				return errors.Wrap(err, "App.userUnfollow")
+			}
+		}
+	}
+
+	if salmonURL.String != "" {
+		var person Person
+		if err := a.SQLDB.QueryRow("select id, permalink from people where id = $1", personID).Scan(&person.ID, &person.Permalink); err != nil {
+			return errors.Wrap(err, "App.userUnfollow: couldn't query for person")
+		}
+
+		if err := a.sendUserSalmon(u, salmonURL.String, makeFollowEntry(u, &person, "http://ostatus.org/schema/1.0/unfollow", u.Username+" stopped following "+person.ID)); err != nil {
+			logrus.WithField("person", person.ID).WithError(err).Warn("unfollow: couldn't send salmon")
+		}
+	}
+
+	return nil
+}
+
+func makeFollowEntry(u *User, p *Person, verb, title string) *activitystreams.Entry {
+	now := time.Now()
+
+	var e activitystreams.Entry
+
+	e.ID = makeTagURI(now, "objectId="+uuid.NewV4().String()+":objectType=activity")
+	e.Title = title
+	e.Verb = verb
+	e.ObjectType = "http://activitystrea.ms/schema/1.0/activity"
+	e.Published = now
+	e.Updated = now
+	e.Author = makeUserAuthor(u)
+
+	o := activitystreams.Author{
+		ObjectType: "http://activitystrea.ms/schema/1.0/person",
+		ID:         p.Permalink,
+		URI:        p.Permalink,
+	}
+	if p.DisplayName != nil {
+		o.DisplayName = *p.DisplayName
+	}
+	o.Link = []commonxml.Link{{Rel: "alternate", Type: "text/html", Href: p.Permalink}}
+
+	e.Object = &o
+
+	return &e
+}
+
+func (a *App) sendUserSalmon(u *User, endpoint string, e *activitystreams.Entry) error {
+	key, err := a.getUserPrivateKey(u.ID)
+	if err != nil {
+		return errors.Wrap(err, "App.sendUserSalmon")
+	}
+
+	d, err := activitystreams.SerializeEntry(e)
+	if err != nil {
+		return errors.Wrap(err, "App.sendUserSalmon")
+	}
+
+	env, err := salmon.Sign(d, "application/atom+xml", key, salmon.KeyID(&key.PublicKey))
+	if err != nil {
+		return errors.Wrap(err, "App.sendUserSalmon")
+	}
+
+	if err := salmon.Send(endpoint, env); err != nil {
+		return errors.Wrap(err, "App.sendUserSalmon")
+	}
+
+	return nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"net/http"
+
+	"github.com/pkg/errors"
 )
 
 func (a *App) handleHomeGet(r *http.Request, ar *AppResponse) *AppResponse {
@@ -27,3 +29,37 @@ func (a *App) handleHomeGet(r *http.Request, ar *AppResponse) *AppResponse {
 		},
 	})
 }
+
+var (
+	errHomeTimelineNotLoggedIn = errors.New("you need to be logged in to see your home timeline")
+)
+
+func (a *App) handleHomeTimelineGet(r *http.Request, ar *AppResponse) *AppResponse {
+	if ar.User == nil {
+		return ar.WithStatus(http.StatusUnauthorized).WithError(errors.Wrap(errHomeTimelineNotLoggedIn, "App.handleHomeTimelineGet"))
+	}
+
+	var args getPublicTimelineArgs
+	if err := decoder.Decode(&args, r.URL.Query()); err != nil {
+		return ar.WithError(err)
+	}
+
+	args.FollowedBy = ar.User.ID
+
+	activities, err := a.getPublicTimeline(args)
+	if err != nil {
+		return ar.WithError(err)
+	}
+
+	if activities == nil {
+		activities = []Activity{}
+	}
+
+	return ar.ShallowMergeState(map[string]interface{}{
+		"homeTimeline": map[string]interface{}{
+			"loading":    false,
+			"activities": activities,
+			"error":      nil,
+		},
+	})
+}
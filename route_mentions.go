@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errMentionsAccountMissing = errors.New("an account is needed to look up mentions")
+)
+
+func (a *App) handleMentionsGet(r *http.Request, ar *AppResponse) *AppResponse {
+	var args struct {
+		Account string `schema:"account"`
+	}
+
+	if err := decoder.Decode(&args, r.URL.Query()); err != nil {
+		return ar.WithStatus(http.StatusBadRequest).WithError(errors.Wrap(err, "App.handleMentionsGet: couldn't decode query"))
+	}
+
+	if args.Account == "" {
+		return ar.WithStatus(http.StatusBadRequest).WithError(errors.Wrap(errMentionsAccountMissing, "App.handleMentionsGet"))
+	}
+
+	mentions, err := a.getMentions(args.Account)
+	if err != nil {
+		return ar.WithError(errors.Wrap(err, "App.handleMentionsGet"))
+	}
+
+	if mentions == nil {
+		mentions = []Mention{}
+	}
+
+	return ar.ShallowMergeState(map[string]interface{}{
+		"mentions": map[string]interface{}{
+			"loading":  false,
+			"error":    nil,
+			"mentions": mentions,
+		},
+	})
+}
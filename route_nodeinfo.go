@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	"fknsrs.biz/p/don/nodeinfo"
+)
+
+func (a *App) handleNodeInfoLinksGet(rw http.ResponseWriter, r *http.Request) {
+	d, err := json.Marshal(&nodeinfo.Links{
+		Links: []nodeinfo.Link{
+			{Rel: nodeinfo.Schema20, Href: nodeInfoURL("2.0")},
+			{Rel: nodeinfo.Schema21, Href: nodeInfoURL("2.1")},
+		},
+	})
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("content-type", "application/json; charset=utf-8")
+	rw.Header().Set("access-control-allow-origin", "*")
+	rw.WriteHeader(http.StatusOK)
+
+	if _, err := rw.Write(d); err != nil {
+		logrus.WithError(err).Warn("error sending nodeinfo links")
+	}
+}
+
+func (a *App) handleNodeInfoGet(rw http.ResponseWriter, r *http.Request) {
+	usage, err := a.getNodeInfoUsage()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	doc, err := makeNodeInfo(usage).ForVersion(mux.Vars(r)["version"])
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	d, err := json.Marshal(doc)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("content-type", `application/json; profile="`+nodeinfo.SchemaFor(doc.Version)+`#"`)
+	rw.Header().Set("access-control-allow-origin", "*")
+	rw.WriteHeader(http.StatusOK)
+
+	if _, err := rw.Write(d); err != nil {
+		logrus.WithError(err).Warn("error sending nodeinfo document")
+	}
+}
@@ -82,6 +82,11 @@ func (a *App) userRegister(email, username, password string) (*User, error) {
 		return nil, errors.Wrap(err, "App.userRegister")
 	}
 
+	publicKey, privateKey, err := generateUserKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userRegister")
+	}
+
 	u := User{
 		ID:        uuid.NewV4().String(),
 		CreatedAt: time.Now(),
@@ -89,7 +94,7 @@ func (a *App) userRegister(email, username, password string) (*User, error) {
 		Email:     email,
 	}
 
-	if _, err := a.SQLDB.Exec("insert into users (id, created_at, username, email, hash) values ($1, $2, $3, $4, $5)", u.ID, u.CreatedAt, u.Username, u.Email, hash); err != nil {
+	if _, err := a.SQLDB.Exec("insert into users (id, created_at, username, email, hash, public_key, private_key) values ($1, $2, $3, $4, $5, $6, $7)", u.ID, u.CreatedAt, u.Username, u.Email, hash, publicKey, privateKey); err != nil {
 		return nil, errors.Wrap(err, "App.userRegister")
 	}
 
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/activitystreams"
+	"fknsrs.biz/p/don/salmon"
+)
+
+const salmonMaxBodySize = 1 << 20
+
+var (
+	errSalmonAuthorMissing  = errors.New("salmon entry doesn't have an author")
+	errSalmonAuthorMismatch = errors.New("salmon envelope wasn't signed with the author's key")
+	errSalmonAuthorUnknown  = errors.New("couldn't work out which account wrote the salmon entry")
+)
+
+func (a *App) handleSalmonUserPost(rw http.ResponseWriter, r *http.Request) {
+	u, err := a.getUserByUsername(mux.Vars(r)["username"])
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if u == nil {
+		http.Error(rw, errUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	a.receiveSalmon(rw, r, logrus.WithField("username", u.Username))
+}
+
+func (a *App) handleSalmonRepliesPost(rw http.ResponseWriter, r *http.Request) {
+	a.receiveSalmon(rw, r, logrus.WithField("endpoint", "replies"))
+}
+
+func (a *App) receiveSalmon(rw http.ResponseWriter, r *http.Request, l *logrus.Entry) {
+	d, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, salmonMaxBodySize))
+	if err != nil {
+		l.WithError(err).Warn("salmon: couldn't read body")
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	env, err := salmon.Parse(d)
+	if err != nil {
+		l.WithError(err).Warn("salmon: couldn't parse envelope")
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload, err := env.Payload()
+	if err != nil {
+		l.WithError(err).Warn("salmon: couldn't decode payload")
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var e activitystreams.Entry
+	if err := xml.NewDecoder(bytes.NewReader(payload)).Decode(&e); err != nil {
+		l.WithError(err).Warn("salmon: couldn't parse entry")
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l = l.WithField("entry", e.ID)
+
+	author := e.GetActor()
+	if author == nil || author.URI == "" {
+		l.WithError(errSalmonAuthorMissing).Warn("salmon: rejecting entry")
+		http.Error(rw, errSalmonAuthorMissing.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l = l.WithField("author", author.URI)
+
+	// the entry is saved under whatever account its profile link resolves
+	// to, so that's the account whose key has to have signed it
+	_, accountURL, err := a.authorAccount(author)
+	if err != nil || accountURL == nil {
+		l.WithError(err).Warn("salmon: couldn't find author's account")
+		http.Error(rw, errSalmonAuthorUnknown.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l = l.WithField("account", accountURL.String())
+
+	if claimed := a.mentionPersonID(author.URI); claimed != nil && *claimed != accountURL.String() {
+		l.WithField("claimed", *claimed).WithError(errSalmonAuthorMismatch).Warn("salmon: rejecting entry")
+		http.Error(rw, errSalmonAuthorMismatch.Error(), http.StatusForbidden)
+		return
+	}
+
+	key, err := salmon.LookupKey(accountURL.String())
+	if err != nil {
+		l.WithError(err).Warn("salmon: couldn't find author's key")
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !salmonSignedBy(env, key) {
+		l.WithError(errSalmonAuthorMismatch).Warn("salmon: rejecting entry")
+		http.Error(rw, errSalmonAuthorMismatch.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := env.Verify(key); err != nil {
+		l.WithError(err).Warn("salmon: rejecting entry")
+		http.Error(rw, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := a.saveActivity(&e); err != nil {
+		l.WithError(err).Error("salmon: couldn't save entry")
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	l.Info("salmon: accepted entry")
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+// salmonSignedBy reports whether any signature on the envelope claims to be
+// from key. Signatures without a well-formed key hash can't be ruled out, so
+// they're left for Verify to decide.
+func salmonSignedBy(env *salmon.Envelope, key *rsa.PublicKey) bool {
+	keyID := salmon.KeyID(key)
+
+	for _, s := range env.Sigs {
+		if h, err := base64.URLEncoding.DecodeString(s.KeyID); err != nil || len(h) != 32 || s.KeyID == keyID {
+			return true
+		}
+	}
+
+	return false
+}
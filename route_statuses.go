@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/don/activitystreams"
+	"fknsrs.biz/p/don/commonxml"
+)
+
+var (
+	errStatusNotLoggedIn    = errors.New("you need to be logged in to post")
+	errStatusContentMissing = errors.New("a status needs some content")
+	errStatusNotFound       = errors.New("no status with that id could be found")
+)
+
+func (a *App) handleStatusesPost(r *http.Request, ar *AppResponse) *AppResponse {
+	if ar.User == nil {
+		return ar.WithStatus(http.StatusUnauthorized).WithError(errors.Wrap(errStatusNotLoggedIn, "App.handleStatusesPost"))
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return ar.WithStatus(http.StatusBadRequest).WithError(errors.Wrap(err, "App.handleStatusesPost: couldn't parse form"))
+	}
+
+	var v struct {
+		Content   string `schema:"content"`
+		InReplyTo string `schema:"in_reply_to"`
+	}
+
+	if err := decoder.Decode(&v, r.PostForm); err != nil {
+		return ar.WithStatus(http.StatusBadRequest).WithError(errors.Wrap(err, "App.handleStatusesPost: couldn't decode form fields"))
+	}
+
+	activity, err := a.userPostStatus(ar.User, v.Content, v.InReplyTo)
+	if err != nil {
+		ar = ar.WithError(errors.Wrap(err, "App.handleStatusesPost: couldn't post status"))
+
+		switch errors.Cause(err) {
+		case errStatusContentMissing:
+			return ar.WithStatus(http.StatusBadRequest)
+		default:
+			return ar
+		}
+	}
+
+	return ar.ShallowMergeState(map[string]interface{}{
+		"postStatus": map[string]interface{}{
+			"loading":  false,
+			"error":    nil,
+			"activity": activity,
+		},
+	}).WithRedirect("/")
+}
+
+func (a *App) handleUserStatusGet(r *http.Request, ar *AppResponse) *AppResponse {
+	vars := mux.Vars(r)
+
+	activities, err := a.getPublicTimeline(getPublicTimelineArgs{Permalink: userStatusURL(vars["username"], vars["id"])})
+	if err != nil {
+		return ar.WithError(errors.Wrap(err, "App.handleUserStatusGet"))
+	}
+	if len(activities) == 0 {
+		return ar.WithStatus(http.StatusNotFound).WithError(errors.Wrap(errStatusNotFound, "App.handleUserStatusGet"))
+	}
+
+	return ar.ShallowMergeState(map[string]interface{}{
+		"status": map[string]interface{}{
+			"loading":  false,
+			"error":    nil,
+			"activity": activities[0],
+		},
+	})
+}
+
+func (a *App) userPostStatus(u *User, content, inReplyTo string) (*Activity, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, errors.Wrap(errStatusContentMissing, "App.userPostStatus")
+	}
+
+	var displayName, avatar string
+	if u.DisplayName != nil {
+		displayName = *u.DisplayName
+	}
+	if u.Avatar != nil {
+		avatar = *u.Avatar
+	}
+
+	person, err := a.storePerson(userAccountURL(u.Username), userProfileURL(u.Username), "", displayName, "", avatar)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userPostStatus")
+	}
+
+	now := time.Now()
+	id := uuid.NewV4().String()
+
+	objectType := "note"
+	if inReplyTo = strings.TrimSpace(inReplyTo); inReplyTo != "" {
+		objectType = "comment"
+	}
+
+	var e activitystreams.Entry
+
+	e.ID = makeTagURI(now, "objectId="+id+":objectType="+objectType)
+	e.Title = "New " + objectType + " by " + u.Username
+	e.Verb = "http://activitystrea.ms/schema/1.0/post"
+	e.ObjectType = "http://activitystrea.ms/schema/1.0/" + objectType
+	e.Content = []activitystreams.Content{{Type: "html", Body: strings.Replace(html.EscapeString(content), "\n", "<br>", -1)}}
+	e.Published = now
+	e.Updated = now
+	e.Link = []commonxml.Link{{Rel: "alternate", Type: "text/html", Href: userStatusURL(u.Username, id)}}
+
+	if inReplyTo != "" {
+		e.InReplyTo = &activitystreams.InReplyTo{Ref: inReplyTo}
+
+		var permalink string
+		if err := a.SQLDB.QueryRow("select permalink from activities where id = $1", inReplyTo).Scan(&permalink); err != nil && err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "App.userPostStatus: couldn't query for parent activity")
+		}
+
+		e.InReplyTo.Href = permalink
+	}
+
+	activity, err := a.storeActivity(&e, person)
+	if err != nil {
+		return nil, errors.Wrap(err, "App.userPostStatus")
+	}
+
+	if activity != nil {
+		go func() {
+			if err := a.publishUserActivity(u, activity); err != nil {
+				logrus.WithField("id", activity.ID).WithError(err).Warn("couldn't publish activity to hub")
+			}
+		}()
+
+		go func() {
+			if err := a.deliverUserActivity(u, activity); err != nil {
+				logrus.WithField("id", activity.ID).WithError(err).Warn("couldn't deliver activity to followers")
+			}
+		}()
+	}
+
+	return activity, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/activitystreams"
+)
+
+var (
+	errUserNotFound = errors.New("no user with that username could be found")
+)
+
+func (a *App) handleUserGet(r *http.Request, ar *AppResponse) *AppResponse {
+	u, err := a.getUserByUsername(mux.Vars(r)["username"])
+	if err != nil {
+		return ar.WithError(errors.Wrap(err, "App.handleUserGet"))
+	}
+	if u == nil {
+		return ar.WithStatus(http.StatusNotFound).WithError(errors.Wrap(errUserNotFound, "App.handleUserGet"))
+	}
+
+	title := u.Username
+	if u.DisplayName != nil && *u.DisplayName != "" {
+		title = *u.DisplayName
+	}
+
+	return ar.MergeMeta(map[string]string{
+		"Title":       title,
+		"Description": "Profile for " + userAccountURL(u.Username).String() + ".",
+	}).ShallowMergeState(map[string]interface{}{
+		"profile": map[string]interface{}{
+			"loading": false,
+			"error":   nil,
+			"user": map[string]interface{}{
+				"username":    u.Username,
+				"displayName": u.DisplayName,
+				"avatar":      u.Avatar,
+				"account":     userAccountURL(u.Username).String(),
+				"permalink":   userProfileURL(u.Username),
+			},
+		},
+	})
+}
+
+func (a *App) handleUserFeedGet(rw http.ResponseWriter, r *http.Request) {
+	u, err := a.getUserByUsername(mux.Vars(r)["username"])
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if u == nil {
+		http.Error(rw, errUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	var args getPublicTimelineArgs
+	if err := decoder.Decode(&args, r.URL.Query()); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	args.Account = userAccountURL(u.Username).String()
+
+	activities, err := a.getPublicTimeline(args)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d, err := activitystreams.Serialize(makeUserFeed(u, activities))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("content-type", "application/atom+xml; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+
+	if _, err := rw.Write(d); err != nil {
+		logrus.WithError(err).Warn("error sending feed")
+	}
+}
@@ -0,0 +1,112 @@
+package salmon
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"fknsrs.biz/p/don/acct"
+	"fknsrs.biz/p/don/webfinger"
+)
+
+const (
+	MagicPublicKeyRel      = "magic-public-key"
+	MagicPublicKeyMimeType = "application/magic-public-key"
+)
+
+var ErrKeyNotFound = errors.New("salmon: no magic-public-key found")
+
+func ParseMagicPublicKey(s string) (*rsa.PublicKey, error) {
+	s = stripSpace(s)
+
+	if strings.HasPrefix(s, "data:") {
+		i := strings.Index(s, ",")
+		if i == -1 {
+			return nil, errors.Errorf("ParseMagicPublicKey: invalid data url")
+		}
+
+		s = s[i+1:]
+	}
+
+	i := strings.Index(s, "RSA.")
+	if i == -1 {
+		return nil, errors.Errorf("ParseMagicPublicKey: expected RSA key")
+	}
+
+	bits := strings.Split(s[i:], ".")
+	if len(bits) < 3 {
+		return nil, errors.Errorf("ParseMagicPublicKey: expected at least 3 parts but got %d", len(bits))
+	}
+
+	n, err := decodeBase64URL(bits[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseMagicPublicKey: couldn't decode modulus")
+	}
+
+	e, err := decodeBase64URL(bits[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseMagicPublicKey: couldn't decode exponent")
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if exponent.BitLen() > 31 || exponent.Int64() < 3 {
+		return nil, errors.Errorf("ParseMagicPublicKey: invalid exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func MagicPublicKey(k *rsa.PublicKey) string {
+	return "RSA." + base64.URLEncoding.EncodeToString(k.N.Bytes()) + "." + base64.URLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+}
+
+func MagicPublicKeyDataURL(k *rsa.PublicKey) string {
+	return "data:" + MagicPublicKeyMimeType + "," + MagicPublicKey(k)
+}
+
+func KeyID(k *rsa.PublicKey) string {
+	h := sha256.Sum256([]byte(MagicPublicKey(k)))
+	return base64.URLEncoding.EncodeToString(h[:])
+}
+
+func LookupKey(resource string) (*rsa.PublicKey, error) {
+	var host string
+
+	if u, err := url.Parse(resource); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		host = u.Host
+	} else if a, err := acct.FromString(resource); err == nil {
+		host = a.Host
+		resource = a.String()
+	} else {
+		return nil, errors.Errorf("LookupKey: couldn't determine host for %q", resource)
+	}
+
+	r, err := webfinger.Fetch(webfinger.MakeURL(host, resource, nil))
+	if err != nil {
+		return nil, errors.Wrap(err, "LookupKey")
+	}
+
+	return KeyFromWebfinger(r)
+}
+
+func KeyFromWebfinger(r *webfinger.Response) (*rsa.PublicKey, error) {
+	for _, l := range r.Links {
+		if l.Rel != MagicPublicKeyRel || l.Href == "" {
+			continue
+		}
+
+		k, err := ParseMagicPublicKey(l.Href)
+		if err != nil {
+			return nil, errors.Wrap(err, "KeyFromWebfinger")
+		}
+
+		return k, nil
+	}
+
+	return nil, errors.Wrap(ErrKeyNotFound, "KeyFromWebfinger")
+}
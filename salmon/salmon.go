@@ -0,0 +1,249 @@
+package salmon
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	Namespace         = "http://salmon-protocol.org/ns/magic-env"
+	EncodingBase64URL = "base64url"
+	AlgRSASHA256      = "RSA-SHA256"
+	MimeType          = "application/magic-envelope+xml"
+)
+
+var (
+	ErrUnsupportedEncoding  = errors.New("salmon: unsupported encoding")
+	ErrUnsupportedAlgorithm = errors.New("salmon: unsupported algorithm")
+	ErrNoSignatures         = errors.New("salmon: envelope has no signatures")
+	ErrInvalidSignature     = errors.New("salmon: signature verification failed")
+)
+
+type Signature struct {
+	KeyID string
+	Value string
+}
+
+type Envelope struct {
+	Data     string
+	DataType string
+	Encoding string
+	Alg      string
+	Sigs     []Signature
+}
+
+func Sign(data []byte, dataType string, key *rsa.PrivateKey, keyID string) (*Envelope, error) {
+	e := Envelope{
+		Data:     base64.URLEncoding.EncodeToString(data),
+		DataType: dataType,
+		Encoding: EncodingBase64URL,
+		Alg:      AlgRSASHA256,
+	}
+
+	h := sha256.Sum256(e.SigningInput())
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "salmon.Sign")
+	}
+
+	e.Sigs = []Signature{{KeyID: keyID, Value: base64.URLEncoding.EncodeToString(sig)}}
+
+	return &e, nil
+}
+
+func (e *Envelope) SigningInput() []byte {
+	return []byte(strings.Join([]string{
+		e.Data,
+		base64.URLEncoding.EncodeToString([]byte(e.DataType)),
+		base64.URLEncoding.EncodeToString([]byte(e.Encoding)),
+		base64.URLEncoding.EncodeToString([]byte(e.Alg)),
+	}, "."))
+}
+
+func (e *Envelope) Payload() ([]byte, error) {
+	if e.Encoding != EncodingBase64URL {
+		return nil, errors.Wrap(ErrUnsupportedEncoding, "Envelope.Payload")
+	}
+
+	d, err := decodeBase64URL(e.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Envelope.Payload")
+	}
+
+	return d, nil
+}
+
+func (e *Envelope) Verify(key *rsa.PublicKey) error {
+	if e.Encoding != EncodingBase64URL {
+		return errors.Wrap(ErrUnsupportedEncoding, "Envelope.Verify")
+	}
+	if e.Alg != AlgRSASHA256 {
+		return errors.Wrap(ErrUnsupportedAlgorithm, "Envelope.Verify")
+	}
+	if len(e.Sigs) == 0 {
+		return errors.Wrap(ErrNoSignatures, "Envelope.Verify")
+	}
+
+	h := sha256.Sum256(e.SigningInput())
+
+	for _, s := range e.Sigs {
+		sig, err := decodeBase64URL(s.Value)
+		if err != nil {
+			continue
+		}
+
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, h[:], sig); err == nil {
+			return nil
+		}
+	}
+
+	return errors.Wrap(ErrInvalidSignature, "Envelope.Verify")
+}
+
+func Parse(d []byte) (*Envelope, error) {
+	var e Envelope
+
+	if t := bytes.TrimSpace(d); len(t) > 0 && t[0] == '{' {
+		if err := json.Unmarshal(t, &e); err != nil {
+			return nil, errors.Wrap(err, "salmon.Parse")
+		}
+	} else {
+		if err := xml.Unmarshal(d, &e); err != nil {
+			return nil, errors.Wrap(err, "salmon.Parse")
+		}
+	}
+
+	return &e, nil
+}
+
+type envelopeXML struct {
+	XMLName  xml.Name
+	Data     envelopeDataXML  `xml:"http://salmon-protocol.org/ns/magic-env data"`
+	Encoding string           `xml:"http://salmon-protocol.org/ns/magic-env encoding"`
+	Alg      string           `xml:"http://salmon-protocol.org/ns/magic-env alg"`
+	Sigs     []envelopeSigXML `xml:"http://salmon-protocol.org/ns/magic-env sig"`
+}
+
+type envelopeDataXML struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type envelopeSigXML struct {
+	KeyID string `xml:"key_id,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+func (e *Envelope) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if start.Name.Space != Namespace || (start.Name.Local != "env" && start.Name.Local != "provenance") {
+		return errors.Errorf("Envelope.UnmarshalXML: expected magic envelope but got %q %q", start.Name.Space, start.Name.Local)
+	}
+
+	var v envelopeXML
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return errors.Wrap(err, "Envelope.UnmarshalXML")
+	}
+
+	e.Data = stripSpace(v.Data.Value)
+	e.DataType = strings.TrimSpace(v.Data.Type)
+	e.Encoding = strings.TrimSpace(v.Encoding)
+	e.Alg = strings.TrimSpace(v.Alg)
+	e.Sigs = nil
+
+	for _, s := range v.Sigs {
+		e.Sigs = append(e.Sigs, Signature{KeyID: s.KeyID, Value: stripSpace(s.Value)})
+	}
+
+	return nil
+}
+
+func (e *Envelope) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	v := envelopeXML{
+		XMLName:  xml.Name{Space: Namespace, Local: "env"},
+		Data:     envelopeDataXML{Type: e.DataType, Value: e.Data},
+		Encoding: e.Encoding,
+		Alg:      e.Alg,
+	}
+
+	for _, s := range e.Sigs {
+		v.Sigs = append(v.Sigs, envelopeSigXML{KeyID: s.KeyID, Value: s.Value})
+	}
+
+	return enc.Encode(v)
+}
+
+type envelopeJSON struct {
+	Data     string            `json:"data"`
+	DataType string            `json:"data_type"`
+	Encoding string            `json:"encoding"`
+	Alg      string            `json:"alg"`
+	Sigs     []envelopeSigJSON `json:"sigs"`
+}
+
+type envelopeSigJSON struct {
+	Value   string `json:"value"`
+	KeyHash string `json:"keyhash,omitempty"`
+}
+
+func (e *Envelope) UnmarshalJSON(d []byte) error {
+	var v envelopeJSON
+	if err := json.Unmarshal(d, &v); err != nil {
+		return errors.Wrap(err, "Envelope.UnmarshalJSON")
+	}
+
+	e.Data = stripSpace(v.Data)
+	e.DataType = v.DataType
+	e.Encoding = v.Encoding
+	e.Alg = v.Alg
+	e.Sigs = nil
+
+	for _, s := range v.Sigs {
+		e.Sigs = append(e.Sigs, Signature{KeyID: s.KeyHash, Value: stripSpace(s.Value)})
+	}
+
+	return nil
+}
+
+func (e *Envelope) MarshalJSON() ([]byte, error) {
+	v := envelopeJSON{
+		Data:     e.Data,
+		DataType: e.DataType,
+		Encoding: e.Encoding,
+		Alg:      e.Alg,
+		Sigs:     []envelopeSigJSON{},
+	}
+
+	for _, s := range e.Sigs {
+		v.Sigs = append(v.Sigs, envelopeSigJSON{Value: s.Value, KeyHash: s.KeyID})
+	}
+
+	return json.Marshal(v)
+}
+
+func stripSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+
+		return r
+	}, s)
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	s = strings.TrimRight(stripSpace(s), "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,193 @@
+package salmon
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/don/webfinger"
+)
+
+func fixtureKey() *rsa.PrivateKey {
+	b, _ := pem.Decode([]byte(fixtureKeyPEM))
+	if b == nil {
+		panic("couldn't decode fixture key")
+	}
+
+	k, err := x509.ParsePKCS1PrivateKey(b.Bytes)
+	if err != nil {
+		panic(err)
+	}
+
+	return k
+}
+
+func TestMagicPublicKey(t *testing.T) {
+	k := fixtureKey()
+
+	assert.Equal(t, fixtureMagicPublicKey, MagicPublicKey(&k.PublicKey), "MagicPublicKey")
+	assert.Equal(t, "data:application/magic-public-key,"+fixtureMagicPublicKey, MagicPublicKeyDataURL(&k.PublicKey), "MagicPublicKeyDataURL")
+
+	for _, s := range []string{
+		fixtureMagicPublicKey,
+		"data:application/magic-public-key," + fixtureMagicPublicKey,
+		"data:application/magic-public-key,key_id." + fixtureMagicPublicKey,
+	} {
+		pk, err := ParseMagicPublicKey(s)
+		if err != nil {
+			panic(err)
+		}
+
+		assert.Equal(t, 0, k.PublicKey.N.Cmp(pk.N), "PublicKey.N")
+		assert.Equal(t, k.PublicKey.E, pk.E, "PublicKey.E")
+	}
+
+	_, err := ParseMagicPublicKey("data:application/magic-public-key,DSA.abc.def")
+	assert.Error(t, err, "ParseMagicPublicKey")
+}
+
+func TestKeyFromWebfinger(t *testing.T) {
+	k := fixtureKey()
+
+	pk, err := KeyFromWebfinger(&webfinger.Response{
+		Subject: "acct:alice@mastodon.example",
+		Links: []webfinger.Link{
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: "https://mastodon.example/@alice"},
+			{Rel: "magic-public-key", Href: "data:application/magic-public-key," + fixtureMagicPublicKey},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, 0, k.PublicKey.N.Cmp(pk.N), "PublicKey.N")
+
+	_, err = KeyFromWebfinger(&webfinger.Response{Subject: "acct:alice@mastodon.example"})
+	assert.Equal(t, ErrKeyNotFound, errors.Cause(err), "KeyFromWebfinger")
+}
+
+func TestVerifyMastodonEnvelope(t *testing.T) {
+	k := fixtureKey()
+
+	e, err := Parse([]byte(fixtureMastodonEnvelope))
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, "application/atom+xml", e.DataType, "Envelope.DataType")
+	assert.Equal(t, "base64url", e.Encoding, "Envelope.Encoding")
+	assert.Equal(t, "RSA-SHA256", e.Alg, "Envelope.Alg")
+	assert.Len(t, e.Sigs, 1, "Envelope.Sigs")
+
+	payload, err := e.Payload()
+	assert.NoError(t, err, "Envelope.Payload")
+	assert.Equal(t, fixtureMastodonPayload, string(payload), "Envelope.Payload")
+
+	assert.NoError(t, e.Verify(&k.PublicKey), "Envelope.Verify")
+
+	signed, err := Sign([]byte(fixtureMastodonPayload), "application/atom+xml", k, "")
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, e.Data, signed.Data, "Sign.Data")
+	assert.Equal(t, e.Sigs[0].Value, signed.Sigs[0].Value, "Sign.Sigs")
+}
+
+func TestVerifyGNUSocialEnvelope(t *testing.T) {
+	k := fixtureKey()
+
+	e, err := Parse([]byte(fixtureGNUSocialEnvelope))
+	if err != nil {
+		panic(err)
+	}
+
+	payload, err := e.Payload()
+	assert.NoError(t, err, "Envelope.Payload")
+	assert.Equal(t, fixtureGNUSocialPayload, string(payload), "Envelope.Payload")
+
+	assert.NoError(t, e.Verify(&k.PublicKey), "Envelope.Verify")
+}
+
+func TestVerifyJSONEnvelope(t *testing.T) {
+	k := fixtureKey()
+
+	e, err := Parse([]byte(fixtureJSONEnvelope))
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, "text/plain", e.DataType, "Envelope.DataType")
+	assert.Equal(t, fixtureJSONSigningInput, string(e.SigningInput()), "Envelope.SigningInput")
+
+	payload, err := e.Payload()
+	assert.NoError(t, err, "Envelope.Payload")
+	assert.Equal(t, "Not really Atom", string(payload), "Envelope.Payload")
+
+	assert.NoError(t, e.Verify(&k.PublicKey), "Envelope.Verify")
+}
+
+func TestVerifyTamperedEnvelope(t *testing.T) {
+	k := fixtureKey()
+
+	e, err := Parse([]byte(fixtureJSONEnvelope))
+	if err != nil {
+		panic(err)
+	}
+
+	e.DataType = "application/atom+xml"
+	assert.Equal(t, ErrInvalidSignature, errors.Cause(e.Verify(&k.PublicKey)), "Envelope.Verify")
+
+	e.DataType = "text/plain"
+	e.Alg = "RSA-SHA1"
+	assert.Equal(t, ErrUnsupportedAlgorithm, errors.Cause(e.Verify(&k.PublicKey)), "Envelope.Verify")
+
+	other, err := ParseMagicPublicKey("RSA.mVgY8RN6URBTstndvmUUPb4UZTdwvwmddSKE5z_jvKUEK6yk1u3rrC9yN8k6FilGj9K0eeUPe2hf4Pj-5CmHww==.AQAB")
+	if err != nil {
+		panic(err)
+	}
+
+	e.Alg = "RSA-SHA256"
+	assert.Equal(t, ErrInvalidSignature, errors.Cause(e.Verify(other)), "Envelope.Verify")
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	k := fixtureKey()
+
+	e1, err := Sign([]byte(fixtureGNUSocialPayload), "application/atom+xml", k, KeyID(&k.PublicKey))
+	if err != nil {
+		panic(err)
+	}
+
+	x, err := xml.Marshal(e1)
+	if err != nil {
+		panic(err)
+	}
+
+	e2, err := Parse(x)
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, e1, e2, "XML round trip")
+	assert.NoError(t, e2.Verify(&k.PublicKey), "Envelope.Verify")
+
+	j, err := json.Marshal(e1)
+	if err != nil {
+		panic(err)
+	}
+
+	e3, err := Parse(j)
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, e1, e3, "JSON round trip")
+	assert.NoError(t, e3.Verify(&k.PublicKey), "Envelope.Verify")
+}
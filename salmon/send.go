@@ -0,0 +1,33 @@
+package salmon
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Send delivers a signed envelope to a salmon endpoint.
+func Send(endpoint string, e *Envelope) error {
+	d, err := xml.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "Send")
+	}
+
+	res, err := http.Post(endpoint, MimeType, bytes.NewReader(append([]byte(xml.Header), d...)))
+	if err != nil {
+		return errors.Wrap(err, "Send")
+	}
+	defer res.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("Send: invalid status code; expected 2xx but got %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"net/url"
 
 	"github.com/pkg/errors"
+	"github.com/timewasted/go-accept-headers"
 )
 
 var ErrNotFound = errors.New("Webfinger: resource not found")
@@ -200,6 +201,11 @@ func (s *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	res, err := s.Fetch(subject, q["rel"])
 	if err != nil {
+		if errors.Cause(err) == ErrNotFound {
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		}
+
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -221,10 +227,30 @@ func (s *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		res.Links = a
 	}
 
-	rw.Header().Set("content-type", "application/jrd+json")
-	rw.WriteHeader(http.StatusOK)
+	ct, err := accept.Parse(r.Header.Get("accept")).Negotiate("application/jrd+json", "application/json", "application/xrd+xml", "application/xml", "text/xml")
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch ct {
+	case "application/xrd+xml", "application/xml", "text/xml":
+		rw.Header().Set("content-type", ct)
+		rw.WriteHeader(http.StatusOK)
 
-	if err := json.NewEncoder(rw).Encode(res); err != nil {
-		panic(err)
+		if _, err := rw.Write([]byte(xml.Header)); err != nil {
+			panic(err)
+		}
+
+		if err := xml.NewEncoder(rw).Encode(res); err != nil {
+			panic(err)
+		}
+	default:
+		rw.Header().Set("content-type", "application/jrd+json")
+		rw.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(rw).Encode(res); err != nil {
+			panic(err)
+		}
 	}
 }